@@ -41,7 +41,7 @@ func (b *binder) Bind(i interface{}, c Context) (err error) {
 				err = NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unmarshal type error: expected=%v, got=%v, offset=%v", ute.Type, ute.Value, ute.Offset))
 			} else if se, ok := err.(*json.SyntaxError); ok {
 				err = NewHTTPError(http.StatusBadRequest, fmt.Sprintf("syntax error: offset=%v, error=%v", se.Offset, se.Error()))
-			} else {
+			} else if _, ok := err.(*HTTPError); !ok {
 				err = NewHTTPError(http.StatusBadRequest, err.Error())
 			}
 		}
@@ -51,7 +51,7 @@ func (b *binder) Bind(i interface{}, c Context) (err error) {
 				err = NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported type error: type=%v, error=%v", ute.Type, ute.Error()))
 			} else if se, ok := err.(*xml.SyntaxError); ok {
 				err = NewHTTPError(http.StatusBadRequest, fmt.Sprintf("syntax error: line=%v, error=%v", se.Line, se.Error()))
-			} else {
+			} else if _, ok := err.(*HTTPError); !ok {
 				err = NewHTTPError(http.StatusBadRequest, err.Error())
 			}
 		}
@@ -0,0 +1,105 @@
+package vodka
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+type (
+	// bodyBuffer holds a request body buffered by `Context#BodyBytes()`. Bodies up
+	// to the buffer size are kept in memory, larger ones are spilled to a
+	// temporary file.
+	bodyBuffer struct {
+		buf  []byte
+		file *os.File
+		size int64
+		err  error
+	}
+
+	// replayReader reads a buffered body from the start. Each consumer gets its
+	// own, see `bodyBuffer#reader()`.
+	replayReader struct {
+		body   *bodyBuffer
+		offset int64
+	}
+)
+
+const (
+	// DefaultBodyBufferSize is the default size up to which `Context#BodyBytes()`
+	// keeps request bodies in memory.
+	DefaultBodyBufferSize = 4 << 20 // 4 MB
+
+	// DefaultMaxBodySize is the default maximum size of request bodies read by
+	// `Context#BodyBytes()`.
+	DefaultMaxBodySize = 32 << 20 // 32 MB
+)
+
+// fill reads r into the buffer, spilling it to a temporary file once it's
+// larger than max bytes. It stops with `ErrStatusRequestEntityTooLarge` once
+// the body is larger than limit bytes, unless limit is zero.
+func (b *bodyBuffer) fill(r io.Reader, max, limit int64) {
+	if limit > 0 {
+		if max > limit {
+			max = limit
+		}
+		r = io.LimitReader(r, limit+1)
+	}
+	buf := bytes.NewBuffer(b.buf[:0])
+	n, err := io.CopyN(buf, r, max+1)
+	b.buf = buf.Bytes()
+	b.size = n
+	if err != nil {
+		if err != io.EOF {
+			b.err = err
+		}
+		return
+	}
+	if limit > 0 && b.size > limit {
+		b.err = ErrStatusRequestEntityTooLarge
+		return
+	}
+
+	// Spill
+	if b.file, b.err = ioutil.TempFile("", "vodka-body-"); b.err != nil {
+		return
+	}
+	if _, b.err = b.file.Write(b.buf); b.err != nil {
+		return
+	}
+	n, b.err = io.Copy(b.file, r)
+	b.size += n
+	b.buf = b.buf[:0]
+	if b.err == nil && limit > 0 && b.size > limit {
+		b.err = ErrStatusRequestEntityTooLarge
+	}
+}
+
+// reader returns a new reader over the buffered body.
+func (b *bodyBuffer) reader() io.Reader {
+	return &replayReader{body: b}
+}
+
+// release removes the temporary file.
+func (b *bodyBuffer) release() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+	}
+}
+
+func (r *replayReader) Read(p []byte) (n int, err error) {
+	if r.offset >= r.body.size {
+		return 0, io.EOF
+	}
+	if r.body.file != nil {
+		if n, err = r.body.file.ReadAt(p, r.offset); err == io.EOF {
+			err = nil
+		}
+	} else {
+		n = copy(p, r.body.buf[r.offset:r.body.size])
+	}
+	r.offset += int64(n)
+	return
+}
@@ -0,0 +1,69 @@
+package vodka
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/insionng/vodka/engine"
+)
+
+// checkPreconditions evaluates the conditional headers of req against the
+// validators of the current representation, in the order of RFC 7232 section
+// 6. It returns 0 if the request can proceed, otherwise `304 Not Modified` or
+// `412 Precondition Failed`. An empty etag means the resource doesn't exist:
+// `If-Match` fails and `If-None-Match` passes. A zero lastModified skips the
+// conditions on the dates.
+func checkPreconditions(req engine.Request, etag string, lastModified time.Time) int {
+	h := req.Header()
+	method := req.Method()
+	safe := method == GET || method == HEAD
+	lastModified = lastModified.Truncate(time.Second)
+
+	if v := h.Get(HeaderIfMatch); v != "" {
+		if !matchETag(v, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(h.Get(HeaderIfUnmodifiedSince)); err == nil && !lastModified.IsZero() {
+		if lastModified.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if v := h.Get(HeaderIfNoneMatch); v != "" {
+		if matchETag(v, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(h.Get(HeaderIfModifiedSince)); err == nil && safe && !lastModified.IsZero() {
+		if !lastModified.After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// matchETag reports whether the list of entity tags of an `If-Match` or
+// `If-None-Match` header matches etag, with the weak or the strong comparison.
+// Nothing matches an empty etag, not even "*".
+func matchETag(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "*":
+			return true
+		case weak:
+			if strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		case !strings.HasPrefix(t, "W/") && !strings.HasPrefix(etag, "W/") && t == etag:
+			return true
+		}
+	}
+	return false
+}
@@ -36,6 +36,11 @@ type (
 		// Request returns `engine.Response` interface.
 		Response() engine.Response
 
+		// RealIP returns the client IP address using the IP extractor registered
+		// with `Vodka#SetIPExtractor()`, by default `ExtractIPDirect()`, which
+		// ignores headers like `X-Forwarded-For`.
+		RealIP() string
+
 		// Path returns the registered path for the handler.
 		Path() string
 
@@ -92,6 +97,12 @@ type (
 		// It is an alias for `engine.Response#SetCookie()`.
 		SetCookie(engine.Cookie)
 
+		// Push initiates an HTTP/2 server push of the provided target path with the
+		// optional request headers. It returns `engine.ErrNotSupported` if the engine,
+		// the protocol or the client doesn't support push.
+		// It is an alias for `engine.Response#Push()`.
+		Push(string, map[string][]string) error
+
 		// Cookies returns the HTTP cookies sent with the request.
 		// It is an alias for `engine.Request#Cookies()`.
 		Cookies() []engine.Cookie
@@ -110,6 +121,15 @@ type (
 
 		At(string, string, HandlerFunc, ...MiddlewareFunc)
 
+		// BodyBytes reads the request body into a buffer and returns it. The body
+		// stays readable: each call to BodyBytes sets a new `engine.Request#Body()`
+		// reading it from the start, and `Bind()` reads it from the start. Bodies
+		// larger than `Vodka#BodyBufferSize()` are spilled to a temporary file,
+		// BodyBytes returns `ErrStatusRequestEntityTooLarge` for them. Bodies larger
+		// than `Vodka#MaxBodySize()` aren't read further, `Bind()` fails with the
+		// same error then. The buffer is released with the context.
+		BodyBytes() ([]byte, error)
+
 		// Bind binds the request body into provided type `i`. The default binder
 		// does it based on Content-Type header.
 		Bind(interface{}) error
@@ -182,11 +202,25 @@ type (
 		// Vodka returns the `Vodka` instance.
 		Vodka() *Vodka
 
-		// ServeContent sends static content from `io.Reader` and handles caching
-		// via `If-Modified-Since` request header. It automatically sets `Content-Type`
-		// and `Last-Modified` response headers.
+		// ServeContent sends static content from `io.Reader` and handles conditional
+		// requests, see `CheckPreconditions()`. It automatically sets `Content-Type`
+		// and, unless the modification time is zero, `Last-Modified` response
+		// headers. The `ETag` response header, if set, is used as entity tag, or a
+		// weak one is derived from the modification time and the size. Being weak,
+		// the derived one never satisfies `If-Match`, set a strong `ETag` for that.
 		ServeContent(io.ReadSeeker, string, time.Time) error
 
+		// CheckPreconditions evaluates the conditional request headers `If-Match`,
+		// `If-Unmodified-Since`, `If-None-Match` and `If-Modified-Since` against the
+		// entity tag, quoted like in the `ETag` header, and the modification time of
+		// the current representation, e.g. for optimistic concurrency on PUT and
+		// PATCH. An empty entity tag means the resource doesn't exist, so that
+		// `If-Match` fails and `If-None-Match: *` passes, e.g. on create. A zero
+		// time skips the conditions on dates. It returns `ErrPreconditionFailed`
+		// or, for GET and HEAD, `ErrNotModified` if the request must not proceed.
+		// `If-Match` uses the strong comparison, weak entity tags never match it.
+		CheckPreconditions(string, time.Time) error
+
 		// Reset resets the context after request completes. It must be called along
 		// with `Vodka#AcquireContext()` and `Vodka#ReleaseContext()`.
 		// See `Vodka#ServeHTTP()`
@@ -202,6 +236,7 @@ type (
 		pvalues    []string
 		handler    HandlerFunc
 		store      store
+		body       *bodyBuffer
 		vodka      *Vodka
 	}
 
@@ -228,6 +263,13 @@ func (c *context) Response() engine.Response {
 	return c.response
 }
 
+func (c *context) RealIP() string {
+	if c.vodka.ipExtractor != nil {
+		return c.vodka.ipExtractor(c.request)
+	}
+	return directIP(c.request)
+}
+
 func (c *context) Path() string {
 	return c.path
 }
@@ -303,6 +345,10 @@ func (c *context) SetCookie(cookie engine.Cookie) {
 	c.response.SetCookie(cookie)
 }
 
+func (c *context) Push(target string, header map[string][]string) error {
+	return c.response.Push(target, header)
+}
+
 func (c *context) Cookies() []engine.Cookie {
 	return c.request.Cookies()
 }
@@ -351,7 +397,32 @@ func (c *context) At(method, path string, handler HandlerFunc, middleware ...Mid
 	}
 }
 
+func (c *context) BodyBytes() ([]byte, error) {
+	if c.body == nil {
+		c.body = new(bodyBuffer)
+		if body := c.request.Body(); body != nil {
+			c.body.fill(body, c.vodka.bodyBufferSize, c.vodka.maxBodySize)
+		}
+	}
+	c.request.SetBody(c.body.reader())
+	if c.body.err != nil {
+		return nil, c.body.err
+	}
+	if c.body.file != nil {
+		return nil, ErrStatusRequestEntityTooLarge
+	}
+	return c.body.buf[:c.body.size], nil
+}
+
 func (c *context) Bind(i interface{}) error {
+	if c.body == nil {
+		return c.vodka.binder.Bind(i, c)
+	}
+	if c.body.err != nil {
+		return c.body.err
+	}
+	c.request.SetBody(c.body.reader())
+	defer c.request.SetBody(c.body.reader())
 	return c.vodka.binder.Bind(i, c)
 }
 
@@ -485,11 +556,8 @@ func (c *context) Inline(r io.ReadSeeker, name string) (err error) {
 }
 
 func (c *context) contentDisposition(r io.ReadSeeker, name, dispositionType string) (err error) {
-	c.response.Header().Set(HeaderContentType, ContentTypeByExtension(name))
 	c.response.Header().Set(HeaderContentDisposition, fmt.Sprintf("%s; filename=%s", dispositionType, name))
-	c.response.WriteHeader(http.StatusOK)
-	_, err = io.Copy(c.response, r)
-	return
+	return c.ServeContent(r, name, time.Time{})
 }
 
 func (c *context) NoContent(code int) error {
@@ -527,22 +595,53 @@ func (c *context) Logger() log.Logger {
 }
 
 func (c *context) ServeContent(content io.ReadSeeker, name string, modtime time.Time) error {
-	req := c.Request()
 	res := c.Response()
 
-	if t, err := time.Parse(http.TimeFormat, req.Header().Get(HeaderIfModifiedSince)); err == nil && modtime.Before(t.Add(1*time.Second)) {
+	etag := res.Header().Get(HeaderETag)
+	if !modtime.IsZero() {
+		if etag == "" {
+			if size, err := contentSize(content); err == nil {
+				etag = fmt.Sprintf(`W/"%x-%x"`, modtime.Unix(), size)
+				res.Header().Set(HeaderETag, etag)
+			}
+		}
+		res.Header().Set(HeaderLastModified, modtime.UTC().Format(http.TimeFormat))
+	}
+	switch checkPreconditions(c.request, etag, modtime) {
+	case http.StatusNotModified:
 		res.Header().Del(HeaderContentType)
 		res.Header().Del(HeaderContentLength)
 		return c.NoContent(http.StatusNotModified)
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
 	}
 
 	res.Header().Set(HeaderContentType, ContentTypeByExtension(name))
-	res.Header().Set(HeaderLastModified, modtime.UTC().Format(http.TimeFormat))
 	res.WriteHeader(http.StatusOK)
 	_, err := io.Copy(res, content)
 	return err
 }
 
+func (c *context) CheckPreconditions(etag string, lastModified time.Time) error {
+	switch checkPreconditions(c.request, etag, lastModified) {
+	case http.StatusNotModified:
+		return ErrNotModified
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// contentSize returns the size of content and seeks back to its start.
+func contentSize(content io.Seeker) (int64, error) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	return size, err
+}
+
 // ContentTypeByExtension returns the MIME type associated with the file based on
 // its extension. It returns `application/octet-stream` incase MIME type is not
 // found.
@@ -558,5 +657,14 @@ func (c *context) Reset(req engine.Request, res engine.Response) {
 	c.request = req
 	c.response = res
 	c.store = nil
+	c.body = nil
 	c.handler = NotFoundHandler
 }
+
+// release frees the resources held for the request.
+func (c *context) release() {
+	if c.body != nil {
+		c.body.release()
+		c.body = nil
+	}
+}
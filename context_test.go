@@ -3,6 +3,7 @@ package vodka
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -342,6 +343,79 @@ func TestContextMultipartForm(t *testing.T) {
 	}
 }
 
+func TestContextBodyBytes(t *testing.T) {
+	e := New()
+	req := test.NewRequest(POST, "/", strings.NewReader(userJSON))
+	req.Header().Set(HeaderContentType, MIMEApplicationJSON)
+	c := e.NewContext(req, test.NewResponseRecorder()).(*context)
+
+	// Replay
+	b, err := c.BodyBytes()
+	if assert.NoError(t, err) {
+		assert.Equal(t, userJSON, string(b))
+	}
+	u := new(user)
+	if assert.NoError(t, c.Bind(u)) {
+		assert.Equal(t, "Jon Snow", u.Name)
+	}
+	body := new(bytes.Buffer)
+	body.ReadFrom(req.Body())
+	assert.Equal(t, userJSON, body.String())
+
+	// The reader is consumed, BodyBytes sets a new one
+	n, err := req.Body().Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+	b, _ = c.BodyBytes()
+	assert.Equal(t, userJSON, string(b))
+	body.Reset()
+	body.ReadFrom(req.Body())
+	assert.Equal(t, userJSON, body.String())
+	e.ReleaseContext(c)
+	assert.Nil(t, c.body)
+
+	// Spill
+	e.SetBodyBufferSize(8)
+	req = test.NewRequest(POST, "/", strings.NewReader(userJSON))
+	req.Header().Set(HeaderContentType, MIMEApplicationJSON)
+	c.Reset(req, test.NewResponseRecorder())
+	_, err = c.BodyBytes()
+	assert.Equal(t, ErrStatusRequestEntityTooLarge, err)
+	if assert.NotNil(t, c.body.file) {
+		u = new(user)
+		if assert.NoError(t, c.Bind(u)) {
+			assert.Equal(t, "Jon Snow", u.Name)
+		}
+		name := c.body.file.Name()
+		c.release()
+		_, err = os.Stat(name)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// Limit
+	e.SetMaxBodySize(16)
+	for _, size := range []int64{8, DefaultBodyBufferSize} {
+		e.SetBodyBufferSize(size)
+		r := strings.NewReader(userJSON)
+		req = test.NewRequest(POST, "/", r)
+		req.Header().Set(HeaderContentType, MIMEApplicationJSON)
+		c.Reset(req, test.NewResponseRecorder())
+		_, err = c.BodyBytes()
+		assert.Equal(t, ErrStatusRequestEntityTooLarge, err)
+		assert.Equal(t, ErrStatusRequestEntityTooLarge, c.Bind(new(user)))
+		assert.Equal(t, len(userJSON)-17, r.Len())
+		c.release()
+	}
+	e.SetMaxBodySize(int64(len(userJSON)))
+	req = test.NewRequest(POST, "/", strings.NewReader(userJSON))
+	c.Reset(req, test.NewResponseRecorder())
+	b, err = c.BodyBytes()
+	if assert.NoError(t, err) {
+		assert.Equal(t, userJSON, string(b))
+	}
+	c.release()
+}
+
 func TestContextRedirect(t *testing.T) {
 	e := New()
 	req := test.NewRequest(GET, "/", nil)
@@ -383,6 +457,9 @@ func TestContextServeContent(t *testing.T) {
 				assert.Equal(t, http.StatusOK, rec.Status())
 			}
 
+			etag := rec.Header().Get(HeaderETag)
+			assert.Equal(t, fmt.Sprintf(`W/"%x-%x"`, fi.ModTime().Unix(), fi.Size()), etag)
+
 			// Cached
 			rec = test.NewResponseRecorder()
 			c = e.NewContext(req, rec)
@@ -390,7 +467,62 @@ func TestContextServeContent(t *testing.T) {
 			if assert.NoError(t, c.ServeContent(f, fi.Name(), fi.ModTime())) {
 				assert.Equal(t, http.StatusNotModified, rec.Status())
 			}
+			req.Header().Del(HeaderIfModifiedSince)
+			rec = test.NewResponseRecorder()
+			c = e.NewContext(req, rec)
+			req.Header().Set(HeaderIfNoneMatch, etag)
+			if assert.NoError(t, c.ServeContent(f, fi.Name(), fi.ModTime())) {
+				assert.Equal(t, http.StatusNotModified, rec.Status())
+			}
+
+			// Attachment
+			rec = test.NewResponseRecorder()
+			c = e.NewContext(req, rec)
+			rec.Header().Set(HeaderETag, `"walle"`)
+			req.Header().Set(HeaderIfNoneMatch, `"walle"`)
+			if assert.NoError(t, c.Attachment(f, fi.Name())) {
+				assert.Equal(t, http.StatusNotModified, rec.Status())
+			}
+			req.Header().Del(HeaderIfNoneMatch)
+			req.Header().Set(HeaderIfMatch, `"eve"`)
+			assert.Equal(t, ErrPreconditionFailed, c.Attachment(f, fi.Name()))
+		}
+	}
+}
+
+func TestContextCheckPreconditions(t *testing.T) {
+	e := New()
+	modtime := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		method, header, value string
+		etag                  string
+		err                   error
+	}{
+		{GET, "", "", `"v1"`, nil},
+		{PUT, HeaderIfMatch, `"v1"`, `"v1"`, nil},
+		{PUT, HeaderIfMatch, `"v0", "v1"`, `"v1"`, nil},
+		{PUT, HeaderIfMatch, "*", `"v1"`, nil},
+		{PUT, HeaderIfMatch, `"v2"`, `"v1"`, ErrPreconditionFailed},
+		{PUT, HeaderIfMatch, `W/"v1"`, `"v1"`, ErrPreconditionFailed},
+		{PUT, HeaderIfUnmodifiedSince, modtime.Format(http.TimeFormat), `"v1"`, nil},
+		{PUT, HeaderIfUnmodifiedSince, modtime.Add(-time.Second).Format(http.TimeFormat), `"v1"`, ErrPreconditionFailed},
+		{PUT, HeaderIfNoneMatch, "*", `"v1"`, ErrPreconditionFailed},
+		{GET, HeaderIfNoneMatch, `W/"v1"`, `"v1"`, ErrNotModified},
+		{GET, HeaderIfNoneMatch, `"v2"`, `"v1"`, nil},
+		{GET, HeaderIfModifiedSince, modtime.Format(http.TimeFormat), `"v1"`, ErrNotModified},
+		{GET, HeaderIfModifiedSince, modtime.Add(-time.Second).Format(http.TimeFormat), `"v1"`, nil},
+		{PUT, HeaderIfModifiedSince, modtime.Format(http.TimeFormat), `"v1"`, nil},
+		{PUT, HeaderIfMatch, "*", "", ErrPreconditionFailed},
+		{PUT, HeaderIfMatch, `"v1"`, "", ErrPreconditionFailed},
+		{PUT, HeaderIfNoneMatch, "*", "", nil},
+		{PUT, HeaderIfMatch, `W/"v1"`, `W/"v1"`, ErrPreconditionFailed},
+	} {
+		req := test.NewRequest(tt.method, "/", nil)
+		if tt.header != "" {
+			req.Header().Set(tt.header, tt.value)
 		}
+		c := e.NewContext(req, test.NewResponseRecorder())
+		assert.Equal(t, tt.err, c.CheckPreconditions(tt.etag, modtime), tt.method+" "+tt.header+": "+tt.value)
 	}
 }
 
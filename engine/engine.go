@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"bufio"
+	"crypto/tls"
+	"errors"
 	"io"
 	"mime/multipart"
 	"time"
@@ -19,11 +22,26 @@ type (
 		// SetLogger sets the logger for the HTTP server.
 		SetLogger(log.Logger)
 
+		// Listen binds the listener for the HTTP server without serving requests.
+		// `Start()` calls it implicitly if the listener is not bound yet.
+		Listen() error
+
+		// Addr returns the network address the server is listening on, or nil if
+		// the listener is not bound yet.
+		Addr() net.Addr
+
 		// Start starts the HTTP server.
 		Start() error
 
 		// Stop stops the HTTP server by closing underlying TCP connection.
 		Stop() error
+
+		// Ready returns a channel which is closed once the listener is bound.
+		Ready() <-chan struct{}
+
+		// Done returns a channel which receives the error `Start()` stopped with,
+		// nil if the server was stopped with `Stop()`, and is closed afterwards.
+		Done() <-chan error
 	}
 
 	// Request defines the interface for HTTP request.
@@ -31,6 +49,10 @@ type (
 		// IsTLS returns true if HTTP connection is TLS otherwise false.
 		IsTLS() bool
 
+		// TLSState returns the state of the TLS connection, including the verified
+		// client certificates, or nil if the connection is not TLS.
+		TLSState() *tls.ConnectionState
+
 		// Scheme returns the HTTP protocol scheme, `http` or `https`.
 		Scheme() string
 
@@ -56,26 +78,45 @@ type (
 		// Referer returns the referring URL, if sent in the request.
 		Referer() string
 
-		// Protocol returns the protocol version string of the HTTP request.
-		// Protocol() string
+		// Proto returns the protocol version string of the HTTP request, e.g.
+		// "HTTP/1.1" or "HTTP/2.0".
+		Proto() string
 
-		// ProtocolMajor returns the major protocol version of the HTTP request.
-		// ProtocolMajor() int
+		// ProtoMajor returns the major protocol version of the HTTP request.
+		ProtoMajor() int
 
-		// ProtocolMinor returns the minor protocol version of the HTTP request.
-		// ProtocolMinor() int
+		// ProtoMinor returns the minor protocol version of the HTTP request.
+		ProtoMinor() int
 
 		// ContentLength returns the size of request's body.
 		ContentLength() int64
 
+		// SetContentLength sets the size of request's body, -1 if unknown, e.g.
+		// after replacing it with `SetBody()`. The `Content-Length` header is
+		// removed if unknown.
+		SetContentLength(int64)
+
 		// UserAgent returns the client's `User-Agent`.
 		UserAgent() string
 
-		// RemoteAddress returns the client's network address.
+		// RemoteAddress returns the client's network address. With `Config#ProxyProtocol`
+		// enabled it is the client address reported by the proxy.
 		RemoteAddress() string
 
+		// LocalAddress returns the server's network address the request was received on.
+		LocalAddress() string
+
+		// ConnID returns the ID of the connection the request was received on. IDs are
+		// unique per server, it is 0 if unknown.
+		ConnID() uint64
+
+		// ConnRequestNum returns the sequence number of the request on its
+		// connection, starting at 1. It is 0 if unknown.
+		ConnRequestNum() uint64
+
 		// RealIP returns the client's network address based on `X-Forwarded-For`
-		// or `X-Real-IP` request header.
+		// or `X-Real-IP` request header. The headers are trusted regardless of the
+		// sender, prefer `vodka.Context#RealIP()` with a configured IP extractor.
 		RealIP() string
 
 		// Method returns the request's HTTP function.
@@ -137,6 +178,37 @@ type (
 
 		// SetWriter sets the HTTP response writer.
 		SetWriter(io.Writer)
+
+		// Before registers a function which is called just before the response
+		// header is written, e.g. to set headers depending on the handler.
+		Before(func())
+
+		// After registers a function which is called once the handler has returned
+		// and the response body is written. Trailers can still be set.
+		After(func())
+
+		// Flush sends the buffered response to the client. If the writer set with
+		// `SetWriter()` has a `Flush() error` method, like `bufio.Writer` or
+		// `gzip.Writer`, it's flushed first. Engines which send the response only
+		// after the handler has returned ignore it.
+		Flush()
+
+		// SetTrailer sets an HTTP trailer, sent after the response body. Trailers set
+		// after the response is committed are only sent if their names were announced
+		// before, by calling `SetTrailer()` earlier or with the `Trailer` header. It
+		// returns `ErrNotSupported` if the engine doesn't support trailers.
+		SetTrailer(string, string) error
+
+		// Hijack lets the caller take over the connection, e.g. for WebSocket or
+		// CONNECT tunnels. The caller is responsible for closing it, the response
+		// counts as committed. It returns `ErrNotSupported` if the engine or the
+		// protocol, e.g. HTTP/2, doesn't allow it.
+		Hijack() (net.Conn, *bufio.ReadWriter, error)
+
+		// Push initiates an HTTP/2 server push of the provided target path with
+		// the optional request headers. It returns `ErrNotSupported` if the engine,
+		// the protocol or the client doesn't support push.
+		Push(string, map[string][]string) error
 	}
 
 	// Header defines the interface for HTTP header.
@@ -156,6 +228,10 @@ type (
 		// no values associated with the key, Get returns "".
 		Get(string) string
 
+		// Values returns all values associated with the given key, in the order
+		// they were received. It returns nil if the key is not set.
+		Values(string) []string
+
 		// Keys returns the header keys.
 		Keys() []string
 
@@ -207,13 +283,30 @@ type (
 
 	// Config defines engine config.
 	Config struct {
-		Address      string        // TCP address to listen on.
-		Listener     net.Listener  // Custom `net.Listener`. If set, server accepts connections on it.
-		TLSCertFile  string        // TLS certificate file path.
-		TLSKeyFile   string        // TLS key file path.
-		DisableHTTP2 bool          // Disables HTTP/2.
-		ReadTimeout  time.Duration // Maximum duration before timing out read of the request.
-		WriteTimeout time.Duration // Maximum duration before timing out write of the response.
+		Address            string             // Address to listen on, see `ParseAddress()`. E.g. ":1323" or "unix:///run/app.sock".
+		Listener           net.Listener       // Custom `net.Listener`. If set, server accepts connections on it.
+		ProxyProtocol      bool               // Expects the PROXY protocol header (v1 or v2) on accepted connections.
+		ProxyHeaderTimeout time.Duration      // Maximum duration to wait for the PROXY protocol header.
+		TLSCertFile        string             // TLS certificate file path.
+		TLSKeyFile         string             // TLS key file path.
+		TLSCertificates    []TLSCertificate   // Additional TLS certificates, selected by SNI.
+		TLSClientCAFile    string             // CA bundle to verify client certificates against. Requires them by default.
+		TLSClientAuth      tls.ClientAuthType // Client certificate policy, e.g. `tls.VerifyClientCertIfGiven`.
+		TLSReloadInterval  time.Duration      // Interval to check TLS certificate files for changes. Zero disables it.
+		TLSReloadOnSIGHUP  bool               // Reloads TLS certificates when the process receives SIGHUP.
+		DisableHTTP2       bool               // Disables HTTP/2.
+		H2C                bool               // Serves HTTP/2 without TLS, to clients with prior knowledge or upgrading from HTTP/1.1 with `Upgrade: h2c`. Not supported by fasthttp.
+		ReadTimeout        time.Duration      // Maximum duration before timing out read of the request.
+		WriteTimeout       time.Duration      // Maximum duration before timing out write of the response.
+		ReadHeaderTimeout  time.Duration      // Maximum duration to read the request headers. Not supported by fasthttp.
+		IdleTimeout        time.Duration      // Maximum duration to wait for the next request on a keep-alive connection. Not supported by fasthttp, where `ReadTimeout` covers it.
+		MaxHeaderBytes     int                // Maximum size of the request headers. Zero means the engine default, 1 MB for standard and 4 KB for fasthttp.
+		MaxRequestBodySize int64              // Maximum size of the request body. Zero means the engine default, unlimited for standard and 4 MB for fasthttp, unlimited with `StreamRequestBody`.
+		StreamRequestBody  bool               // Passes request bodies to the handler as a stream read from the connection, instead of reading them into memory first. fasthttp only, standard always streams.
+		MaxMultipartMemory int64              // Maximum memory for the parts of a multipart form, larger files are spooled to temporary files. Zero means `DefaultMaxMultipartMemory`.
+		MaxConns           int                // Maximum number of open connections, further connections wait to be accepted. Zero means unlimited.
+		MaxConnsPerIP      int                // Maximum number of open connections per client IP, further connections are closed. Zero means unlimited.
+		DisableKeepAlive   bool               // Closes the connection after each request.
 	}
 
 	// Handler defines an interface to server HTTP requests via `ServeHTTP(Request, Response)`
@@ -227,6 +320,12 @@ type (
 	HandlerFunc func(Request, Response)
 )
 
+var (
+	// ErrNotSupported is returned if a feature isn't supported by the engine or
+	// the protocol of the request.
+	ErrNotSupported = errors.New("not supported")
+)
+
 // ServeHTTP serves HTTP request.
 func (h HandlerFunc) ServeHTTP(req Request, res Response) {
 	h(req, res)
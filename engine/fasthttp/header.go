@@ -2,7 +2,11 @@
 
 package fasthttp
 
-import "github.com/valyala/fasthttp"
+import (
+	"bytes"
+
+	"github.com/valyala/fasthttp"
+)
 
 type (
 	// RequestHeader holds `fasthttp.RequestHeader`.
@@ -36,6 +40,16 @@ func (h *RequestHeader) Get(key string) string {
 	return string(h.Peek(key))
 }
 
+// Values implements `engine.Header#Values` function.
+func (h *RequestHeader) Values(key string) (values []string) {
+	h.VisitAll(func(k, v []byte) {
+		if bytes.EqualFold(k, []byte(key)) {
+			values = append(values, string(v))
+		}
+	})
+	return
+}
+
 // Keys implements `engine.Header#Keys` function.
 func (h *RequestHeader) Keys() (keys []string) {
 	keys = make([]string, h.Len())
@@ -76,6 +90,16 @@ func (h *ResponseHeader) Set(key, val string) {
 	h.ResponseHeader.Set(key, val)
 }
 
+// Values implements `engine.Header#Values` function.
+func (h *ResponseHeader) Values(key string) (values []string) {
+	h.VisitAll(func(k, v []byte) {
+		if bytes.EqualFold(k, []byte(key)) {
+			values = append(values, string(v))
+		}
+	})
+	return
+}
+
 // Keys implements `engine.Header#Keys` function.
 func (h *ResponseHeader) Keys() (keys []string) {
 	keys = make([]string, h.Len())
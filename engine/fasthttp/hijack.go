@@ -0,0 +1,205 @@
+// +build !appengine
+
+package fasthttp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// hijackListener wraps accepted connections so that `Response#Hijack()` can
+	// take them over while the handler is running, fasthttp itself only hands
+	// over the connection after the handler has returned, and so that
+	// `Response#SetTrailer()` can write the trailer. The request headers are only
+	// parsed by a `bodyStreamer` with `engine.Config#StreamRequestBody`.
+	hijackListener struct {
+		net.Listener
+		// stream enables `bodyStreamer` on the connections.
+		stream bool
+	}
+
+	// hijackConn detaches fasthttp from the connection once hijacked: reads
+	// return EOF, writes are discarded and closing it is left to the new owner.
+	hijackConn struct {
+		net.Conn
+		stream   *bodyStreamer
+		mutex    sync.RWMutex
+		hijacked bool
+		// trailer is written at the end of the chunked body being sent, see
+		// `trailerBody`.
+		trailer []byte
+		// held is the start of the last chunk, written along with the trailer.
+		held []byte
+	}
+
+	// bufferedConn returns the data read ahead by `bodyStreamer` first.
+	bufferedConn struct {
+		net.Conn
+		reader io.Reader
+	}
+
+	// tlsHijackConn keeps `fasthttp.RequestCtx#IsTLS()` and
+	// `fasthttp.RequestCtx#TLSConnectionState()` working for TLS connections.
+	tlsHijackConn struct {
+		*hijackConn
+	}
+
+	// hijackAddr is returned by `hijackConn#LocalAddr()`, it's the only way from
+	// `fasthttp.RequestCtx` back to the connection.
+	hijackAddr struct {
+		net.Addr
+		conn *hijackConn
+	}
+
+	connectionStater interface {
+		ConnectionState() tls.ConnectionState
+	}
+)
+
+var (
+	errAlreadyHijacked = errors.New("vodka: connection already hijacked")
+	lastChunk          = []byte("0\r\n\r\n")
+)
+
+func (l hijackListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	hc := &hijackConn{Conn: c}
+	if l.stream {
+		hc.stream = newBodyStreamer(c)
+	}
+	if _, ok := c.(connectionStater); ok {
+		return tlsHijackConn{hc}, nil
+	}
+	return hc, nil
+}
+
+// hijack detaches fasthttp from the connection and returns the underlying
+// connection, with its deadlines cleared.
+func (c *hijackConn) hijack() (net.Conn, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.hijacked {
+		return nil, errAlreadyHijacked
+	}
+	c.hijacked = true
+	c.Conn.SetDeadline(time.Time{})
+	if c.stream != nil {
+		return &bufferedConn{Conn: c.Conn, reader: c.stream.br}, nil
+	}
+	return c.Conn, nil
+}
+
+func (c *hijackConn) isHijacked() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.hijacked
+}
+
+func (c *hijackConn) Read(b []byte) (int, error) {
+	if c.isHijacked() {
+		return 0, io.EOF
+	}
+	if c.stream != nil {
+		return c.stream.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// Write writes b to the connection. Once a `trailerBody` is read, fasthttp
+// writes the last chunk of the body next, the trailer is inserted before its
+// final CRLF. Bytes which may start the last chunk are held back until it's
+// complete, in case it's split across writes.
+func (c *hijackConn) Write(b []byte) (int, error) {
+	if c.isHijacked() {
+		return len(b), nil
+	}
+	if c.trailer == nil {
+		return c.Conn.Write(b)
+	}
+	buf := append(c.held, b...)
+	c.held = nil
+	if bytes.HasSuffix(buf, lastChunk) {
+		buf = append(buf[:len(buf)-2], c.trailer...)
+		buf = append(buf, "\r\n"...)
+		c.trailer = nil
+	} else {
+		n := len(buf)
+		for i := len(lastChunk) - 1; i > 0; i-- {
+			if bytes.HasSuffix(buf, lastChunk[:i]) {
+				n -= i
+				break
+			}
+		}
+		c.held = buf[n:]
+		buf = buf[:n]
+	}
+	if len(buf) > 0 {
+		if _, err := c.Conn.Write(buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *hijackConn) Close() error {
+	if c.isHijacked() {
+		return nil
+	}
+	return c.Conn.Close()
+}
+
+func (c *hijackConn) SetDeadline(t time.Time) error {
+	if c.isHijacked() {
+		return nil
+	}
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *hijackConn) SetReadDeadline(t time.Time) error {
+	if c.isHijacked() {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *hijackConn) SetWriteDeadline(t time.Time) error {
+	if c.isHijacked() {
+		return nil
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *hijackConn) LocalAddr() net.Addr {
+	return &hijackAddr{Addr: c.Conn.LocalAddr(), conn: c}
+}
+
+func (c tlsHijackConn) ConnectionState() tls.ConnectionState {
+	return c.Conn.(connectionStater).ConnectionState()
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (a *hijackAddr) Network() string {
+	if a.Addr == nil {
+		return "tcp"
+	}
+	return a.Addr.Network()
+}
+
+func (a *hijackAddr) String() string {
+	if a.Addr == nil {
+		return "0.0.0.0:0"
+	}
+	return a.Addr.String()
+}
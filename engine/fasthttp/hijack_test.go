@@ -0,0 +1,40 @@
+package fasthttp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
+
+func TestHijackConnTrailer(t *testing.T) {
+	for _, writes := range [][]string{
+		{"5\r\nvodka\r\n0\r\n\r\n"},
+		{"5\r\nvodka\r\n0\r\n", "\r\n"},
+		{"5\r\nvodka\r\n0", "\r", "\n\r", "\n"},
+		{"5\r\nvodka\r\n", "0\r\n\r\n"},
+	} {
+		rc := new(recordConn)
+		c := &hijackConn{Conn: rc, trailer: []byte("X-Checksum: 5\r\n")}
+		for _, w := range writes {
+			n, err := c.Write([]byte(w))
+			assert.NoError(t, err)
+			assert.Equal(t, len(w), n)
+		}
+		assert.Equal(t, "5\r\nvodka\r\n0\r\nX-Checksum: 5\r\n\r\n", rc.buf.String(), "%q", writes)
+
+		// Written as is afterwards
+		c.Write([]byte("0\r\n\r\n"))
+		assert.Equal(t, "5\r\nvodka\r\n0\r\nX-Checksum: 5\r\n\r\n0\r\n\r\n", rc.buf.String())
+	}
+}
@@ -4,9 +4,12 @@ package fasthttp
 
 import (
 	"bytes"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net"
+	"net/http"
 
 	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/engine"
@@ -18,9 +21,15 @@ type (
 	// Request implements `engine.Request`.
 	Request struct {
 		*fasthttp.RequestCtx
-		header engine.Header
-		url    engine.URL
-		logger log.Logger
+		header    engine.Header
+		url       engine.URL
+		logger    log.Logger
+		body      io.Reader
+		bodySet   bool
+		stream    *streamBody
+		form      *multipart.Form
+		bodyRead  bool
+		maxMemory int64
 	}
 )
 
@@ -31,6 +40,7 @@ func NewRequest(c *fasthttp.RequestCtx, l log.Logger) *Request {
 		url:        &URL{URI: c.URI()},
 		header:     &RequestHeader{RequestHeader: &c.Request.Header},
 		logger:     l,
+		maxMemory:  engine.DefaultMaxMultipartMemory,
 	}
 }
 
@@ -39,6 +49,11 @@ func (r *Request) IsTLS() bool {
 	return r.RequestCtx.IsTLS()
 }
 
+// TLSState implements `engine.Request#TLSState` function.
+func (r *Request) TLSState() *tls.ConnectionState {
+	return r.RequestCtx.TLSConnectionState()
+}
+
 // Scheme implements `engine.Request#Scheme` function.
 func (r *Request) Scheme() string {
 	return string(r.RequestCtx.URI().Scheme())
@@ -74,11 +89,46 @@ func (r *Request) ContentLength() int64 {
 	return int64(r.Request.Header.ContentLength())
 }
 
+// SetContentLength implements `engine.Request#SetContentLength` function.
+func (r *Request) SetContentLength(length int64) {
+	r.Request.Header.SetContentLength(int(length))
+	if length < 0 {
+		// Not to announce a chunked body, which was already decoded
+		r.Request.Header.Del("Transfer-Encoding")
+	}
+}
+
 // UserAgent implements `engine.Request#UserAgent` function.
 func (r *Request) UserAgent() string {
 	return string(r.RequestCtx.UserAgent())
 }
 
+// Proto implements `engine.Request#Proto` function.
+func (r *Request) Proto() string {
+	if r.Request.Header.IsHTTP11() {
+		return "HTTP/1.1"
+	}
+	return "HTTP/1.0"
+}
+
+// ProtoMajor implements `engine.Request#ProtoMajor` function.
+func (r *Request) ProtoMajor() int {
+	return 1
+}
+
+// ProtoMinor implements `engine.Request#ProtoMinor` function.
+func (r *Request) ProtoMinor() int {
+	if r.Request.Header.IsHTTP11() {
+		return 1
+	}
+	return 0
+}
+
+// LocalAddress implements `engine.Request#LocalAddress` function.
+func (r *Request) LocalAddress() string {
+	return r.LocalAddr().String()
+}
+
 // RemoteAddress implements `engine.Request#RemoteAddress` function.
 func (r *Request) RemoteAddress() string {
 	return r.RemoteAddr().String()
@@ -117,27 +167,49 @@ func (r *Request) SetURI(uri string) {
 	r.Request.Header.SetRequestURI(uri)
 }
 
-// Body implements `engine.Request#Body` function.
+// Body implements `engine.Request#Body` function. Like with the standard engine,
+// the body can be read once. With `engine.Config#StreamRequestBody` it's read
+// from the connection.
 func (r *Request) Body() io.Reader {
-	return bytes.NewBuffer(r.Request.Body())
+	if r.body == nil {
+		if r.stream != nil {
+			r.body = r.stream
+		} else {
+			r.body = bytes.NewReader(r.Request.Body())
+		}
+	}
+	return r.body
 }
 
-// SetBody implements `engine.Request#SetBody` function.
+// SetBody implements `engine.Request#SetBody` function. URL encoded forms are
+// parsed from the new body.
 func (r *Request) SetBody(reader io.Reader) {
-	r.Request.SetBodyStream(reader, 0)
+	r.body = reader
+	r.bodySet = true
 }
 
 // FormValue implements `engine.Request#FormValue` function.
 func (r *Request) FormValue(name string) string {
+	if r.isMultipartForm() {
+		if v := r.QueryArgs().Peek(name); len(v) > 0 {
+			return string(v)
+		}
+		if form, err := r.MultipartForm(); err == nil && len(form.Value[name]) > 0 {
+			return form.Value[name][0]
+		}
+		return ""
+	}
+	r.readForm()
 	return string(r.RequestCtx.FormValue(name))
 }
 
 // FormParams implements `engine.Request#FormParams` function.
 func (r *Request) FormParams() (params map[string][]string) {
 	params = make(map[string][]string)
-	mf, err := r.RequestCtx.MultipartForm()
+	mf, err := r.MultipartForm()
 
-	if err == fasthttp.ErrNoMultipartForm {
+	if err == http.ErrNotMultipart {
+		r.readForm()
 		r.PostArgs().VisitAll(func(k, v []byte) {
 			key := string(k)
 			if _, ok := params[key]; ok {
@@ -159,12 +231,28 @@ func (r *Request) FormParams() (params map[string][]string) {
 
 // FormFile implements `engine.Request#FormFile` function.
 func (r *Request) FormFile(name string) (*multipart.FileHeader, error) {
-	return r.RequestCtx.FormFile(name)
+	form, err := r.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if fhs := form.File[name]; len(fhs) > 0 {
+		return fhs[0], nil
+	}
+	return nil, fasthttp.ErrMissingFile
 }
 
-// MultipartForm implements `engine.Request#MultipartForm` function.
+// MultipartForm implements `engine.Request#MultipartForm` function. Files larger
+// than `engine.Config#MaxMultipartMemory` are spooled to temporary files, which
+// are removed once the request is served.
 func (r *Request) MultipartForm() (*multipart.Form, error) {
-	return r.RequestCtx.MultipartForm()
+	if r.form == nil {
+		form, err := engine.ReadMultipartForm(r.Body(), string(r.Request.Header.ContentType()), r.maxMemory)
+		if err != nil {
+			return nil, err
+		}
+		r.form = form
+	}
+	return r.form, nil
 }
 
 // Cookie implements `engine.Request#Cookie` function.
@@ -191,8 +279,59 @@ func (r *Request) Cookies() []engine.Cookie {
 	return cookies
 }
 
+func (r *Request) isMultipartForm() bool {
+	return len(r.Request.Header.MultipartFormBoundary()) > 0
+}
+
+// readForm reads a streamed URL encoded form, or one set with `SetBody()`, into
+// the request body, where fasthttp parses it.
+func (r *Request) readForm() {
+	if bytes.HasPrefix(r.Request.Header.ContentType(), []byte(vodka.MIMEApplicationForm)) {
+		r.readBody()
+	}
+}
+
+// readBody reads a streamed body, or one set with `SetBody()`, into the fasthttp
+// request body, e.g. for fasthttp handlers.
+func (r *Request) readBody() {
+	if r.stream == nil && !r.bodySet || r.bodyRead {
+		return
+	}
+	r.bodyRead = true
+	b, err := ioutil.ReadAll(r.Body())
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	r.Request.SetBody(b)
+}
+
+// setStream sets the body read from the connection, with limit as maximum size.
+func (r *Request) setStream(b *streamBody, limit int64) {
+	b.limit = limit
+	r.stream = b
+	r.Request.Header.SetContentLength(int(b.length))
+}
+
+// finish removes the temporary files of the multipart form and discards the
+// unread body. It returns false if the connection can't be reused.
+func (r *Request) finish() bool {
+	if r.form != nil {
+		r.form.RemoveAll()
+	}
+	if r.stream != nil {
+		return r.stream.close()
+	}
+	return true
+}
+
 func (r *Request) reset(c *fasthttp.RequestCtx, h engine.Header, u engine.URL) {
 	r.RequestCtx = c
 	r.header = h
 	r.url = u
+	r.body = nil
+	r.bodySet = false
+	r.stream = nil
+	r.form = nil
+	r.bodyRead = false
 }
@@ -5,10 +5,12 @@ import (
 	"bytes"
 	"net"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/insionng/vodka/engine/test"
 	"github.com/insionng/vodka/libraries/gommon/log"
+	"github.com/stretchr/testify/assert"
 	fast "github.com/valyala/fasthttp"
 )
 
@@ -29,3 +31,17 @@ func TestRequest(t *testing.T) {
 	ctx.Request.SetRequestURI(url.String())
 	test.RequestTest(t, NewRequest(ctx, log.New("vodka")))
 }
+
+func TestRequestSetBodyForm(t *testing.T) {
+	ctx := new(fast.RequestCtx)
+	ctx.Init(&fast.Request{}, fakeAddr{addr: "127.0.0.1"}, nil)
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.Header.SetContentType("application/x-www-form-urlencoded")
+	ctx.Request.SetBodyString("name=arya")
+
+	// Forms are parsed from the replaced body, e.g. decompressed
+	req := NewRequest(ctx, log.New("vodka"))
+	req.SetBody(strings.NewReader("name=jon&house=stark"))
+	assert.Equal(t, "jon", req.FormValue("name"))
+	assert.Equal(t, map[string][]string{"name": {"jon"}, "house": {"stark"}}, req.FormParams())
+}
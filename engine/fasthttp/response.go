@@ -3,9 +3,15 @@
 package fasthttp
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"io"
+	"net"
 	"net/http"
+	"strings"
 
+	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/engine"
 	"github.com/insionng/vodka/log"
 	"github.com/valyala/fasthttp"
@@ -15,13 +21,34 @@ type (
 	// Response implements `engine.Response`.
 	Response struct {
 		*fasthttp.RequestCtx
-		header    engine.Header
-		status    int
-		size      int64
-		committed bool
-		writer    io.Writer
-		logger    log.Logger
+		header      engine.Header
+		status      int
+		size        int64
+		committed   bool
+		writer      io.Writer
+		logger      log.Logger
+		beforeFuncs []func()
+		afterFuncs  []func()
+		trailer     http.Header
+		trailerKeys []string
 	}
+
+	// trailerBody is the body of a response with trailers, sent chunked. It
+	// hands the trailer over to the connection at the end of the body, see
+	// `hijackConn#Write()`.
+	trailerBody struct {
+		io.Reader
+		conn    *hijackConn
+		trailer []byte
+	}
+)
+
+var (
+	errInvalidTrailer = errors.New("vodka: invalid trailer name")
+
+	// trailerNewlines are replaced in trailer values, as by `net/http`, so they
+	// can't start another field.
+	trailerNewlines = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
 )
 
 // NewResponse returns `Response` instance.
@@ -29,6 +56,7 @@ func NewResponse(c *fasthttp.RequestCtx, l log.Logger) *Response {
 	return &Response{
 		RequestCtx: c,
 		header:     &ResponseHeader{ResponseHeader: &c.Response.Header},
+		status:     http.StatusOK,
 		writer:     c,
 		logger:     l,
 	}
@@ -45,6 +73,9 @@ func (r *Response) WriteHeader(code int) {
 		r.logger.Warn("response already committed")
 		return
 	}
+	for _, fn := range r.beforeFuncs {
+		fn()
+	}
 	r.status = code
 	r.SetStatusCode(code)
 	r.committed = true
@@ -98,6 +129,80 @@ func (r *Response) SetWriter(w io.Writer) {
 	r.writer = w
 }
 
+// Before implements `engine.Response#Before` function.
+func (r *Response) Before(fn func()) {
+	r.beforeFuncs = append(r.beforeFuncs, fn)
+}
+
+// After implements `engine.Response#After` function.
+func (r *Response) After(fn func()) {
+	r.afterFuncs = append(r.afterFuncs, fn)
+}
+
+// Flush implements `engine.Response#Flush` function. fasthttp sends the response
+// once the handler has returned, only the writer set with `SetWriter()` is
+// flushed.
+func (r *Response) Flush() {
+	if !r.committed {
+		r.WriteHeader(r.status)
+	}
+	if f, ok := r.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+}
+
+// SetTrailer implements `engine.Response#SetTrailer` function. As fasthttp sends
+// the response once the handler has returned, trailers can be set until then,
+// the response is sent chunked. The connection must have been accepted by
+// `Server` and the request must be HTTP/1.1, otherwise `engine.ErrNotSupported`
+// is returned. Trailers aren't sent with a body set with
+// `fasthttp.Response#SetBodyStream()`. Names must be valid header field names,
+// newlines in values are replaced with spaces.
+func (r *Response) SetTrailer(name, value string) error {
+	if _, ok := r.LocalAddr().(*hijackAddr); !ok || !r.Request.Header.IsHTTP11() {
+		return engine.ErrNotSupported
+	}
+	if !validHeaderName(name) {
+		return errInvalidTrailer
+	}
+	name = http.CanonicalHeaderKey(name)
+	value = trailerNewlines.Replace(value)
+	if r.trailer == nil {
+		r.trailer = make(http.Header)
+	}
+	if _, ok := r.trailer[name]; !ok {
+		r.trailerKeys = append(r.trailerKeys, name)
+	}
+	r.trailer[name] = []string{value}
+	return nil
+}
+
+// Hijack implements `engine.Response#Hijack` function. The connection must have
+// been accepted by `Server`, otherwise `engine.ErrNotSupported` is returned.
+// Data the client sent after the request, before receiving a response, may have
+// been buffered by fasthttp and is lost.
+func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	a, ok := r.LocalAddr().(*hijackAddr)
+	if !ok {
+		return nil, nil, engine.ErrNotSupported
+	}
+	c, err := a.conn.hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.SetConnectionClose()
+	r.committed = true
+	return c, bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c)), nil
+}
+
+// Push implements `engine.Response#Push` function. fasthttp doesn't support
+// HTTP/2, it always returns `engine.ErrNotSupported`.
+func (r *Response) Push(target string, header map[string][]string) error {
+	return engine.ErrNotSupported
+}
+
 func (r *Response) reset(c *fasthttp.RequestCtx, h engine.Header) {
 	r.RequestCtx = c
 	r.header = h
@@ -105,4 +210,66 @@ func (r *Response) reset(c *fasthttp.RequestCtx, h engine.Header) {
 	r.size = 0
 	r.committed = false
 	r.writer = c
+	r.beforeFuncs = nil
+	r.afterFuncs = nil
+	r.trailer = nil
+	r.trailerKeys = nil
+}
+
+// finish commits the response if the handler didn't and calls the functions
+// registered with `After()`.
+func (r *Response) finish() {
+	if !r.committed {
+		r.WriteHeader(r.status)
+	}
+	for _, fn := range r.afterFuncs {
+		fn()
+	}
+	r.sendTrailer()
+}
+
+// sendTrailer streams the response body chunked, with the trailers at the end.
+func (r *Response) sendTrailer() {
+	if len(r.trailerKeys) == 0 || r.IsHead() || r.Response.IsBodyStream() {
+		return
+	}
+	if code := r.Response.StatusCode(); code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		return
+	}
+	buf := new(bytes.Buffer)
+	for _, k := range r.trailerKeys {
+		buf.WriteString(k + ": " + r.trailer.Get(k) + "\r\n")
+	}
+	r.Response.Header.Set(vodka.HeaderTrailer, strings.Join(r.trailerKeys, ", "))
+	body := append([]byte(nil), r.Response.Body()...)
+	r.Response.SetBodyStream(&trailerBody{
+		Reader:  bytes.NewReader(body),
+		conn:    r.LocalAddr().(*hijackAddr).conn,
+		trailer: buf.Bytes(),
+	}, -1)
+}
+
+// validHeaderName checks if name is a token, see RFC 7230 section 3.2.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (b *trailerBody) Read(p []byte) (n int, err error) {
+	n, err = b.Reader.Read(p)
+	if err == io.EOF {
+		b.conn.trailer = b.trailer
+	}
+	return
 }
@@ -1,12 +1,15 @@
 package fasthttp
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
 
+	"github.com/insionng/vodka/engine"
 	"github.com/insionng/vodka/libraries/gommon/log"
 )
 
@@ -39,3 +42,66 @@ func TestResponseSetCookie(t *testing.T) {
 	assert.True(t, c.Response.Header.Cookie(ck))
 	assert.Equal(t, "Jon Snow", string(ck.Value()))
 }
+
+func TestResponsePush(t *testing.T) {
+	c := new(fasthttp.RequestCtx)
+	res := NewResponse(c, log.New("test"))
+	assert.Equal(t, engine.ErrNotSupported, res.Push("/app.js", nil))
+}
+
+func TestResponseHooks(t *testing.T) {
+	c := new(fasthttp.RequestCtx)
+	res := NewResponse(c, log.New("test"))
+	calls := ""
+	res.Before(func() {
+		calls += "before"
+		res.Header().Set("X-Before", "before")
+	})
+	res.After(func() {
+		calls += " after"
+	})
+	res.Write([]byte("test"))
+	assert.Equal(t, "before", calls)
+	assert.Equal(t, "before", string(c.Response.Header.Peek("X-Before")))
+	res.finish()
+	assert.Equal(t, "before after", calls)
+}
+
+func TestResponseFlush(t *testing.T) {
+	c := new(fasthttp.RequestCtx)
+	res := NewResponse(c, log.New("test"))
+	bw := bufio.NewWriter(c)
+	res.SetWriter(bw)
+	res.Write([]byte("test"))
+	assert.Equal(t, "", string(c.Response.Body()))
+	res.Flush()
+	assert.Equal(t, "test", string(c.Response.Body()))
+}
+
+func TestResponseSetTrailer(t *testing.T) {
+	// Not accepted by `Server`
+	c := new(fasthttp.RequestCtx)
+	c.Init(new(fasthttp.Request), nil, nil)
+	res := NewResponse(c, log.New("test"))
+	assert.Equal(t, engine.ErrNotSupported, res.SetTrailer("X-Checksum", "sum"))
+
+	// Accepted by `Server`
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	c.Init2(&hijackConn{Conn: conn}, nil, true)
+	res = NewResponse(c, log.New("test"))
+	assert.Equal(t, errInvalidTrailer, res.SetTrailer("X-Checksum: sum\r\nX-Injected", "yes"))
+	assert.Equal(t, errInvalidTrailer, res.SetTrailer("", "sum"))
+	if assert.NoError(t, res.SetTrailer("x-checksum", "sum\r\nX-Injected: yes")) {
+		assert.Equal(t, []string{"X-Checksum"}, res.trailerKeys)
+		assert.Equal(t, "sum X-Injected: yes", res.trailer.Get("X-Checksum"))
+	}
+}
+
+func TestResponseHijack(t *testing.T) {
+	c := new(fasthttp.RequestCtx)
+	c.Init(new(fasthttp.Request), nil, nil)
+	res := NewResponse(c, log.New("test"))
+	_, _, err := res.Hijack()
+	assert.Equal(t, engine.ErrNotSupported, err)
+}
@@ -3,6 +3,9 @@
 package fasthttp
 
 import (
+	"crypto/tls"
+	"errors"
+	"net"
 	"sync"
 
 	"github.com/insionng/vodka"
@@ -16,10 +19,13 @@ type (
 	// Server implements `engine.Server`.
 	Server struct {
 		*fasthttp.Server
-		config  engine.Config
-		handler engine.Handler
-		logger  log.Logger
-		pool    *pool
+		config   engine.Config
+		listener net.Listener
+		certs    *engine.CertificateStore
+		state    *engine.ServerState
+		handler  engine.Handler
+		logger   log.Logger
+		pool     *pool
 	}
 
 	pool struct {
@@ -49,13 +55,18 @@ func WithTLS(addr, certFile, keyFile string) *Server {
 
 // WithConfig returns `Server` with provided config.
 func WithConfig(c engine.Config) (s *Server) {
+	maxMemory := c.MaxMultipartMemory
+	if maxMemory == 0 {
+		maxMemory = engine.DefaultMaxMultipartMemory
+	}
 	s = &Server{
 		Server: new(fasthttp.Server),
 		config: c,
+		state:  engine.NewServerState(),
 		pool: &pool{
 			request: sync.Pool{
 				New: func() interface{} {
-					return &Request{logger: s.logger}
+					return &Request{logger: s.logger, maxMemory: maxMemory}
 				},
 			},
 			response: sync.Pool{
@@ -86,6 +97,9 @@ func WithConfig(c engine.Config) (s *Server) {
 	}
 	s.ReadTimeout = c.ReadTimeout
 	s.WriteTimeout = c.WriteTimeout
+	s.ReadBufferSize = c.MaxHeaderBytes
+	s.MaxRequestBodySize = int(c.MaxRequestBodySize)
+	s.DisableKeepalive = c.DisableKeepAlive
 	s.Handler = s.ServeHTTP
 	return
 }
@@ -100,35 +114,90 @@ func (s *Server) SetLogger(l log.Logger) {
 	s.logger = l
 }
 
-// Start implements `engine.Server#Start` function.
-func (s *Server) Start() error {
-	if s.config.Listener == nil {
-		return s.startDefaultListener()
+// Listen implements `engine.Server#Listen` function.
+func (s *Server) Listen() error {
+	if s.listener != nil {
+		return nil
+	}
+	if err := checkConfig(s.config); err != nil {
+		return err
+	}
+
+	config, certs, err := engine.NewTLSConfig(s.config)
+	if err != nil {
+		return err
+	}
+	ln, err := engine.NewListener(s.config)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		certs.Watch(s.config.TLSReloadInterval, s.config.TLSReloadOnSIGHUP, s.logger)
+		s.certs = certs
+		ln = tls.NewListener(ln, config)
 	}
-	return s.startCustomListener()
+	s.listener = hijackListener{Listener: ln, stream: s.config.StreamRequestBody}
+	s.state.SetReady()
+	return nil
+}
+
+// Addr implements `engine.Server#Addr` function.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
 
+// Start implements `engine.Server#Start` function.
+func (s *Server) Start() (err error) {
+	defer func() {
+		s.state.SetDone(err)
+	}()
+	if err = s.Listen(); err != nil {
+		return
+	}
+	return s.Serve(s.listener)
 }
 
 // Stop implements `engine.Server#Stop` function.
 func (s *Server) Stop() error {
-	// TODO: implement `engine.Server#Stop` function
-	return nil
+	s.state.SetStopped()
+	if s.listener == nil {
+		return nil
+	}
+	if s.certs != nil {
+		s.certs.Close()
+	}
+	return s.listener.Close()
 }
 
-func (s *Server) startDefaultListener() error {
-	c := s.config
-	if c.TLSCertFile != "" && c.TLSKeyFile != "" {
-		return s.ListenAndServeTLS(c.Address, c.TLSCertFile, c.TLSKeyFile)
-	}
-	return s.ListenAndServe(c.Address)
+// Ready implements `engine.Server#Ready` function.
+func (s *Server) Ready() <-chan struct{} {
+	return s.state.Ready()
+}
+
+// Done implements `engine.Server#Done` function.
+func (s *Server) Done() <-chan error {
+	return s.state.Done()
 }
 
-func (s *Server) startCustomListener() error {
-	c := s.config
-	if c.TLSCertFile != "" && c.TLSKeyFile != "" {
-		return s.ServeTLS(c.Listener, c.TLSCertFile, c.TLSKeyFile)
+// checkConfig returns an error for the `engine.Config` settings fasthttp can't
+// honor, rather than silently ignoring them.
+func checkConfig(c engine.Config) error {
+	if c.ReadHeaderTimeout > 0 {
+		return errors.New("vodka: fasthttp doesn't support ReadHeaderTimeout, use ReadTimeout")
+	}
+	if c.IdleTimeout > 0 {
+		return errors.New("vodka: fasthttp doesn't support IdleTimeout, ReadTimeout applies to idle keep-alive connections")
 	}
-	return s.Serve(c.Listener)
+	if c.H2C {
+		return errors.New("vodka: fasthttp doesn't support HTTP/2")
+	}
+	if c.MaxRequestBodySize < 0 || int64(int(c.MaxRequestBodySize)) != c.MaxRequestBodySize {
+		return errors.New("vodka: invalid MaxRequestBodySize")
+	}
+	return nil
 }
 
 func (s *Server) ServeHTTP(c *fasthttp.RequestCtx) {
@@ -139,6 +208,11 @@ func (s *Server) ServeHTTP(c *fasthttp.RequestCtx) {
 	reqHdr.reset(&c.Request.Header)
 	reqURL.reset(c.URI())
 	req.reset(c, reqHdr, reqURL)
+	if s.config.StreamRequestBody {
+		if a, ok := c.LocalAddr().(*hijackAddr); ok && a.conn.stream != nil && a.conn.stream.body != nil {
+			req.setStream(a.conn.stream.body, s.config.MaxRequestBodySize)
+		}
+	}
 
 	// Response
 	res := s.pool.response.Get().(*Response)
@@ -146,7 +220,20 @@ func (s *Server) ServeHTTP(c *fasthttp.RequestCtx) {
 	resHdr.reset(&c.Response.Header)
 	res.reset(c, resHdr)
 
-	s.handler.ServeHTTP(req, res)
+	if max := s.config.MaxRequestBodySize; req.stream != nil && max > 0 && req.stream.length > max {
+		c.Error(fasthttp.StatusMessage(fasthttp.StatusRequestEntityTooLarge), fasthttp.StatusRequestEntityTooLarge)
+	} else {
+		s.handler.ServeHTTP(req, res)
+		res.finish()
+	}
+	if !req.finish() {
+		c.SetConnectionClose()
+	}
+	if c.Request.Header.ConnectionClose() {
+		// fasthttp parses the request header lazily and misses `Connection: close`
+		// unless the handler has looked at the header.
+		c.SetConnectionClose()
+	}
 
 	// Return to pool
 	s.pool.request.Put(req)
@@ -156,12 +243,15 @@ func (s *Server) ServeHTTP(c *fasthttp.RequestCtx) {
 	s.pool.responseHeader.Put(resHdr)
 }
 
-// WrapHandler wraps `fasthttp.RequestHandler` into `vodka.HandlerFunc`.
+// WrapHandler wraps `fasthttp.RequestHandler` into `vodka.HandlerFunc`. A
+// streamed request body, or one set with `engine.Request#SetBody()`, is read
+// into `fasthttp.RequestCtx` first.
 func WrapHandler(h fasthttp.RequestHandler) vodka.HandlerFunc {
 	return func(c vodka.Context) error {
 		req := c.Request().(*Request)
 		res := c.Response().(*Response)
 		ctx := req.RequestCtx
+		req.readBody()
 		h(ctx)
 		res.status = ctx.Response.StatusCode()
 		res.size = int64(ctx.Response.Header.ContentLength())
@@ -1,12 +1,24 @@
 package fasthttp
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/engine/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
 )
@@ -28,11 +40,22 @@ func TestServerWrapHandler(t *testing.T) {
 	c := e.NewContext(req, res)
 	h := WrapHandler(func(ctx *fasthttp.RequestCtx) {
 		ctx.Write([]byte("test"))
+		ctx.Write(ctx.PostBody())
 	})
 	if assert.NoError(t, h(c)) {
 		assert.Equal(t, http.StatusOK, ctx.Response.StatusCode())
 		assert.Equal(t, "test", string(ctx.Response.Body()))
 	}
+
+	// Replaced body
+	ctx = new(fasthttp.RequestCtx)
+	ctx.Request.SetBodyString("arya")
+	req = NewRequest(ctx, nil)
+	req.SetBody(strings.NewReader("jon"))
+	c = e.NewContext(req, NewResponse(ctx, nil))
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, "testjon", string(ctx.Response.Body()))
+	}
 }
 
 func TestServerWrapMiddleware(t *testing.T) {
@@ -57,3 +80,512 @@ func TestServerWrapMiddleware(t *testing.T) {
 		assert.Equal(t, "OK", string(ctx.Response.Body()))
 	}
 }
+
+func TestServerListen(t *testing.T) {
+	s := New("127.0.0.1:0")
+	assert.Nil(t, s.Addr())
+	if assert.NoError(t, s.Listen()) {
+		assert.NotNil(t, s.Addr())
+		assert.NotEqual(t, "127.0.0.1:0", s.Addr().String())
+		assert.NoError(t, s.Stop())
+	}
+
+	// Address in use
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		defer ln.Close()
+		assert.Error(t, New(ln.Addr().String()).Listen())
+	}
+}
+
+func TestServerProxyProtocol(t *testing.T) {
+	s := WithConfig(engine.Config{Address: "127.0.0.1:0", ProxyProtocol: true})
+	addr := make(chan string, 1)
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		addr <- req.RemoteAddress()
+		res.WriteHeader(http.StatusOK)
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	c, err := net.Dial("tcp", s.Addr().String())
+	if assert.NoError(t, err) {
+		defer c.Close()
+		c.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 56324 80\r\nGET / HTTP/1.1\r\nHost: vodka\r\n\r\n"))
+		assert.Equal(t, "203.0.113.7:56324", <-addr)
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ca, err := test.NewTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	certFile, keyFile, _ := ca.WriteIssued(dir, "server", "127.0.0.1")
+	caFile, _ := ca.WriteCert(dir)
+	client, _ := ca.Issue("client")
+
+	s := WithConfig(engine.Config{
+		Address:         "127.0.0.1:0",
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+	})
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte(req.TLSState().PeerCertificates[0].Subject.CommonName))
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	url := "https://" + s.Addr().String()
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      ca.Pool(),
+		Certificates: []tls.Certificate{client},
+	}}}
+	r, err := c.Get(url)
+	if assert.NoError(t, err) {
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "client", string(b))
+	}
+
+	// No client certificate
+	c = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.Pool()}}}
+	_, err = c.Get(url)
+	assert.Error(t, err)
+}
+
+func TestServerLimits(t *testing.T) {
+	s := WithConfig(engine.Config{
+		MaxHeaderBytes:     8192,
+		MaxRequestBodySize: 1024,
+		DisableKeepAlive:   true,
+	})
+	assert.Equal(t, 8192, s.ReadBufferSize)
+	assert.Equal(t, 1024, s.MaxRequestBodySize)
+	assert.True(t, s.DisableKeepalive)
+
+	// Unsupported
+	for _, c := range []engine.Config{
+		{Address: "127.0.0.1:0", ReadHeaderTimeout: time.Second},
+		{Address: "127.0.0.1:0", IdleTimeout: time.Second},
+		{Address: "127.0.0.1:0", MaxRequestBodySize: -1},
+	} {
+		assert.Error(t, WithConfig(c).Listen())
+	}
+}
+
+func TestServerH2C(t *testing.T) {
+	assert.Error(t, WithConfig(engine.Config{Address: "127.0.0.1:0", H2C: true}).Listen())
+}
+
+func TestServerConnInfo(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+		fmt.Fprintf(res, "%s %d.%d %s %d %d", req.Proto(), req.ProtoMajor(), req.ProtoMinor(),
+			req.LocalAddress(), req.ConnID(), req.ConnRequestNum())
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	addr := s.Addr().String()
+	get := func(c *http.Client) string {
+		r, err := c.Get("http://" + addr)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		return string(b)
+	}
+
+	// Keep-alive
+	c := &http.Client{Transport: &http.Transport{}}
+	var id uint64
+	fmt.Sscanf(get(c), "HTTP/1.1 1.1 "+addr+" %d 1", &id)
+	assert.NotZero(t, id)
+	assert.Equal(t, fmt.Sprintf("HTTP/1.1 1.1 %s %d 2", addr, id), get(c))
+
+	// New connection
+	c = &http.Client{Transport: &http.Transport{}}
+	assert.NotEqual(t, fmt.Sprintf("HTTP/1.1 1.1 %s %d 1", addr, id), get(c))
+}
+
+func TestServerHijack(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		c, rw, err := res.Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, res.Committed())
+		go func() {
+			defer c.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString(line)
+			rw.Flush()
+		}()
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	c, err := net.Dial("tcp", s.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte("GET / HTTP/1.1\r\nHost: vodka\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	br := bufio.NewReader(c)
+	r, err := http.ReadResponse(br, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusSwitchingProtocols, r.StatusCode)
+		c.Write([]byte("vodka\n"))
+		line, err := br.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "vodka\n", line)
+		// Nothing else is written to the connection
+		_, err = br.ReadByte()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestServerWrapHTTPHandler(t *testing.T) {
+	e := vodka.New()
+	fr := new(fasthttp.Request)
+	fr.Header.SetMethod(vodka.POST)
+	fr.SetRequestURI("/users?id=1")
+	fr.Header.Set(vodka.HeaderCookie, "session=vodka")
+	fr.SetBodyString("Jon Snow")
+	fr.Header.SetContentLength(8)
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(fr, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4711}, nil)
+	req := NewRequest(ctx, nil)
+	res := NewResponse(ctx, nil)
+	c := e.NewContext(req, res)
+	h := vodka.WrapHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("id"))
+		assert.Equal(t, "192.0.2.1:4711", r.RemoteAddr)
+		assert.Equal(t, int64(8), r.ContentLength)
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "Jon Snow", string(b))
+		if cookie, err := r.Cookie("session"); assert.NoError(t, err) {
+			assert.Equal(t, "vodka", cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "user", Value: "jon"})
+		w.Header().Set(http.TrailerPrefix+"X-Checksum", "sum")
+		w.WriteHeader(http.StatusCreated)
+		for _, s := range []string{"crea", "ted"} {
+			w.Write([]byte(s))
+			w.(http.Flusher).Flush()
+		}
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.Equal(t, http.ErrNotSupported, err)
+	}))
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, http.StatusCreated, ctx.Response.StatusCode())
+		assert.Equal(t, "created", string(ctx.Response.Body()))
+		assert.Equal(t, "user=jon", string(ctx.Response.Header.Peek(vodka.HeaderSetCookie)))
+		assert.Empty(t, ctx.Response.Header.Peek("X-Checksum"))
+	}
+}
+
+func TestServerTrailer(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		if req.URL().Path() == "/trailer" {
+			res.Before(func() {
+				res.SetTrailer("X-Checksum", "")
+			})
+			res.After(func() {
+				res.SetTrailer("X-Checksum", fmt.Sprint(res.Size()))
+			})
+		}
+		res.Write([]byte("vodka"))
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	// The connection is reused after the trailer
+	url := "http://" + s.Addr().String()
+	for _, path := range []string{"/trailer", "/trailer", "/"} {
+		r, err := http.Get(url + path)
+		if assert.NoError(t, err) {
+			b, _ := ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			assert.Equal(t, "vodka", string(b))
+			if path == "/trailer" {
+				assert.Equal(t, []string{"chunked"}, r.TransferEncoding)
+				assert.Equal(t, "5", r.Trailer.Get("X-Checksum"))
+			} else {
+				assert.Empty(t, r.Trailer)
+			}
+		}
+	}
+
+	// HEAD
+	r, err := http.Head(url + "/trailer")
+	if assert.NoError(t, err) {
+		r.Body.Close()
+		assert.Equal(t, http.StatusOK, r.StatusCode)
+	}
+}
+
+func TestServerConformance(t *testing.T) {
+	test.ServerTest(t, func(addr string) engine.Server {
+		return New(addr)
+	})
+}
+
+func TestServerStart(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	go s.Start()
+	select {
+	case <-s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not ready")
+	}
+	if assert.NotNil(t, s.Addr()) {
+		r, err := http.Get("http://" + s.Addr().String())
+		if assert.NoError(t, err) {
+			r.Body.Close()
+			assert.Equal(t, http.StatusOK, r.StatusCode)
+		}
+	}
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-s.Done())
+
+	// Address in use
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		defer ln.Close()
+		s = New(ln.Addr().String())
+		assert.Error(t, s.Start())
+		assert.Error(t, <-s.Done())
+	}
+}
+
+func TestServerConformanceStreamRequestBody(t *testing.T) {
+	test.ServerTest(t, func(addr string) engine.Server {
+		return WithConfig(engine.Config{Address: addr, StreamRequestBody: true})
+	})
+}
+
+func TestServerStreamRequestBody(t *testing.T) {
+	got := make(chan struct{})
+	files := make(chan string, 1)
+	s := WithConfig(engine.Config{
+		Address:            "127.0.0.1:0",
+		StreamRequestBody:  true,
+		MaxRequestBodySize: 64,
+		MaxMultipartMemory: 1,
+	})
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		switch req.URL().Path() {
+		case "/stream":
+			b := make([]byte, 5)
+			io.ReadFull(req.Body(), b)
+			close(got)
+			rest, _ := ioutil.ReadAll(req.Body())
+			res.WriteHeader(http.StatusOK)
+			res.Write(append(b, rest...))
+		case "/upload":
+			if fh, err := req.FormFile("file"); assert.NoError(t, err) {
+				f, _ := fh.Open()
+				if osf, ok := f.(*os.File); assert.True(t, ok, "file not spooled") {
+					files <- osf.Name()
+				}
+				f.Close()
+			}
+			res.WriteHeader(http.StatusOK)
+		case "/unread":
+			fmt.Fprintf(res, "%d", req.ConnRequestNum())
+		case "/form":
+			// Bodies replaced with `SetBody()` are parsed
+			b, _ := ioutil.ReadAll(req.Body())
+			req.SetBody(bytes.NewReader(b))
+			fmt.Fprint(res, req.FormValue("name"))
+		default:
+			_, err := ioutil.ReadAll(req.Body())
+			res.WriteHeader(http.StatusOK)
+			fmt.Fprint(res, err)
+		}
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+	url := "http://" + s.Addr().String()
+
+	// The handler reads the body while it's sent
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("hello"))
+		select {
+		case <-got:
+			pw.Write([]byte(" world"))
+			pw.Close()
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(errors.New("body not streamed"))
+		}
+	}()
+	r, err := http.Post(url+"/stream", "text/plain", pr)
+	if assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		assert.Equal(t, "hello world", string(b))
+	}
+
+	r, err = http.PostForm(url+"/form", map[string][]string{"name": {"jon"}})
+	if assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		assert.Equal(t, "jon", string(b))
+	}
+
+	// Multipart files are spooled to temporary files and removed afterwards
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	w, _ := mw.CreateFormFile("file", "notes.txt")
+	w.Write([]byte("winter is coming"))
+	mw.Close()
+	s.config.MaxRequestBodySize = 0
+	r, err = http.Post(url+"/upload", mw.FormDataContentType(), buf)
+	s.config.MaxRequestBodySize = 64
+	if assert.NoError(t, err) {
+		r.Body.Close()
+		assert.Equal(t, http.StatusOK, r.StatusCode)
+		select {
+		case name := <-files:
+			_, err = os.Stat(name)
+			assert.True(t, os.IsNotExist(err))
+		default:
+		}
+	}
+
+	// Limits
+	r, err = http.Post(url, "text/plain", strings.NewReader(strings.Repeat("a", 65)))
+	if assert.NoError(t, err) {
+		r.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, r.StatusCode)
+	}
+	r, err = http.Post(url, "text/plain", ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 65))))
+	if assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		assert.Equal(t, "http: request body too large", string(b))
+		assert.True(t, r.Close)
+	}
+
+	// Unread bodies are discarded, `Expect: 100-continue`
+	c, err := net.Dial("tcp", s.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(c)
+	c.Write([]byte("POST /unread HTTP/1.1\r\nHost: vodka\r\nContent-Length: 5\r\n\r\nhello"))
+	if r, err := http.ReadResponse(br, nil); assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "1", string(b))
+	}
+	c.Write([]byte("POST / HTTP/1.1\r\nHost: vodka\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	if r, err := http.ReadResponse(br, nil); assert.NoError(t, err) {
+		assert.Equal(t, http.StatusContinue, r.StatusCode)
+	}
+	c.Write([]byte("hello"))
+	if r, err := http.ReadResponse(br, nil); assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "<nil>", string(b))
+	}
+}
+
+func TestServerStreamRequestBodyFraming(t *testing.T) {
+	s := WithConfig(engine.Config{Address: "127.0.0.1:0", StreamRequestBody: true})
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		b, _ := ioutil.ReadAll(req.Body())
+		res.Write(b)
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	request := func(header string) (*http.Response, []byte, error) {
+		c, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			return nil, nil, err
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		c.Write([]byte("POST / HTTP/1.1\r\nHost: vodka\r\n" + header + "\r\n5\r\nhello\r\n0\r\n\r\n"))
+		br := bufio.NewReader(c)
+		r, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		rest, _ := ioutil.ReadAll(br)
+		return r, append(b, rest...), nil
+	}
+
+	// Chunked
+	r, b, err := request("Transfer-Encoding: chunked\r\nConnection: close\r\n")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, r.StatusCode)
+		assert.Equal(t, "hello", string(b))
+	}
+
+	for _, header := range []string{
+		"Content-Length: 3\r\nTransfer-Encoding: chunked\r\n",
+		"Transfer-Encoding: chunked\r\nContent-Length: 3\r\n",
+		"Content-Length: 3\r\nContent-Length: 3\r\n",
+		"Content-Length: 3, 4\r\n",
+		"Content-Length: +3\r\n",
+		"Transfer-Encoding: gzip\r\n",
+		"Transfer-Encoding: chunked, gzip\r\n",
+		"Transfer-Encoding: gzip, chunked\r\n",
+		"Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n",
+		"Transfer-Encoding: xchunked\r\n",
+		"Transfer-Encoding : chunked\r\n",
+		"X-Name: jon\r\n Transfer-Encoding: chunked\r\n",
+	} {
+		r, b, err := request(header)
+		if assert.NoError(t, err, header) {
+			assert.Equal(t, http.StatusBadRequest, r.StatusCode, header)
+			assert.True(t, r.Close, header)
+			assert.Empty(t, b, header)
+		}
+	}
+}
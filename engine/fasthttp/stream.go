@@ -0,0 +1,306 @@
+// +build !appengine
+
+package fasthttp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+)
+
+type (
+	// bodyStreamer splits the request bodies off a connection for
+	// `engine.Config#StreamRequestBody`. fasthttp only reads the request header,
+	// without the body framing headers, the handler reads the body from the
+	// connection with `Request#Body()`.
+	bodyStreamer struct {
+		conn    net.Conn
+		br      *bufio.Reader
+		pending []byte
+		// body is the body of the request whose header was passed to fasthttp last.
+		body *streamBody
+	}
+
+	// streamBody is a request body read from the connection.
+	streamBody struct {
+		streamer *bodyStreamer
+		reader   io.Reader
+		length   int64
+		limit    int64
+		read     int64
+		chunked  bool
+		// expect is true if the client waits for `100 Continue` before sending
+		// the body.
+		expect bool
+		eof    bool
+		err    error
+	}
+)
+
+const (
+	// maxHeaderSize limits the request header read by the streamer, fasthttp
+	// applies its own limit to the header passed on.
+	maxHeaderSize = 1 << 20 // 1 MB
+
+	// maxDrainSize is the maximum size of an unread request body which is
+	// discarded to reuse the connection, larger bodies close it.
+	maxDrainSize = 256 << 10 // 256 KB
+)
+
+var (
+	errBodyTooLarge  = errors.New("http: request body too large")
+	errHeaderTooLong = errors.New("vodka: request header too large")
+	errBodyUnread    = errors.New("vodka: request body not read")
+	errBodyFraming   = errors.New("vodka: invalid request body framing")
+	crlf             = []byte("\r\n")
+	continueResponse = []byte("HTTP/1.1 100 Continue\r\n\r\n")
+	badRequest       = []byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+)
+
+func newBodyStreamer(c net.Conn) *bodyStreamer {
+	return &bodyStreamer{conn: c, br: bufio.NewReader(c)}
+}
+
+// Read passes the request headers to fasthttp. It returns `io.EOF` if the body
+// of the previous request wasn't read completely, the next request can't be
+// found then.
+func (s *bodyStreamer) Read(b []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if s.body != nil && !s.body.eof {
+			return 0, io.EOF
+		}
+		s.body = nil
+		if err := s.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// readHeader reads the next request header. If the request has a body, the
+// `Content-Length`, `Transfer-Encoding` and `Expect` headers are removed and
+// `body` is set up to be read by the handler. Requests whose header or body
+// framing is ambiguous, e.g. with both `Content-Length` and `Transfer-Encoding`,
+// with unsupported transfer codings, folded lines or lines not ending with
+// CRLF, are rejected, see `reject()`.
+func (s *bodyStreamer) readHeader() error {
+	var header []byte
+	start := 0
+	for {
+		line, err := s.br.ReadSlice('\n')
+		header = append(header, line...)
+		if len(header) > maxHeaderSize {
+			return errHeaderTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if len(header) > 0 && err == io.EOF {
+				// Let fasthttp report the incomplete request
+				s.pending = header
+				return nil
+			}
+			return err
+		}
+		// The whole line, it may have been read in parts
+		line = header[start:]
+		start = len(header)
+		if string(line) == "\r\n" || string(line) == "\n" {
+			if len(header) == len(line) {
+				// Empty lines between requests
+				header = header[:0]
+				start = 0
+				continue
+			}
+			break
+		}
+	}
+
+	var (
+		length    int64
+		hasLength bool
+		codings   []string
+		hasCoding bool
+		chunked   bool
+		expect    bool
+	)
+	lines := bytes.SplitAfter(header, []byte("\n"))
+	lines = lines[:len(lines)-1] // Empty after the last LF
+	for _, line := range lines {
+		// Parsers disagree on bare LF and CR
+		if !bytes.HasSuffix(line, crlf) || bytes.IndexByte(line[:len(line)-2], '\r') >= 0 {
+			return s.reject()
+		}
+	}
+	out := append([]byte(nil), lines[0]...)
+	for _, line := range lines[1 : len(lines)-1] {
+		if line[0] == ' ' || line[0] == '\t' {
+			// Obsolete line folding, which could hide framing headers
+			return s.reject()
+		}
+		i := bytes.IndexByte(line, ':')
+		if i < 0 || !validHeaderName(string(line[:i])) {
+			// E.g. whitespace in the name, parsers disagree on it
+			return s.reject()
+		}
+		key := string(line[:i])
+		value := string(bytes.TrimSpace(line[i+1:]))
+		switch {
+		case strings.EqualFold(key, "Content-Length"):
+			if hasLength || !isDigits(value) {
+				return s.reject()
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return s.reject()
+			}
+			length = n
+			hasLength = true
+			continue
+		case strings.EqualFold(key, "Transfer-Encoding"):
+			hasCoding = true
+			for _, c := range strings.Split(value, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					codings = append(codings, strings.ToLower(c))
+				}
+			}
+			continue
+		case strings.EqualFold(key, "Expect"):
+			expect = strings.EqualFold(value, "100-continue")
+			continue
+		}
+		out = append(out, line...)
+	}
+	out = append(out, crlf...)
+	if hasCoding {
+		// Only chunked is supported, applied once as the final coding
+		if hasLength || len(codings) != 1 || codings[0] != "chunked" {
+			return s.reject()
+		}
+		chunked = true
+	}
+	if length == 0 && !chunked {
+		s.pending = header
+		return nil
+	}
+
+	s.pending = out
+	s.body = &streamBody{
+		streamer: s,
+		length:   length,
+		chunked:  chunked,
+		expect:   expect,
+	}
+	if chunked {
+		s.body.length = -1
+		s.body.reader = httputil.NewChunkedReader(s.br)
+	} else {
+		s.body.reader = io.LimitReader(s.br, length)
+	}
+	return nil
+}
+
+// reject answers "400 - Bad Request" to a request whose body framing can't be
+// trusted and returns an error, so that the connection is closed: where the
+// next request starts is unknown.
+func (s *bodyStreamer) reject() error {
+	s.conn.Write(badRequest)
+	return errBodyFraming
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (b *streamBody) Read(p []byte) (n int, err error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.eof {
+		return 0, io.EOF
+	}
+	if b.expect {
+		b.expect = false
+		if _, err = b.streamer.conn.Write(continueResponse); err != nil {
+			b.err = err
+			return
+		}
+	}
+	n, err = b.reader.Read(p)
+	b.read += int64(n)
+	if b.limit > 0 && b.read > b.limit {
+		b.err = errBodyTooLarge
+		return n, b.err
+	}
+	if err == nil && !b.chunked && b.read == b.length {
+		// Done without waiting for `io.EOF` from the connection
+		b.eof = true
+		return
+	}
+	if err == io.EOF {
+		if !b.chunked && b.read < b.length {
+			b.err = io.ErrUnexpectedEOF
+			return n, b.err
+		}
+		if b.chunked {
+			if err = b.readTrailer(); err != nil {
+				b.err = err
+				return n, err
+			}
+		}
+		b.eof = true
+		err = io.EOF
+	} else if err != nil {
+		b.err = err
+	}
+	return
+}
+
+// readTrailer skips the trailer section of a chunked body. Like the header,
+// its lines must end with CRLF.
+func (b *streamBody) readTrailer() error {
+	for {
+		line, err := b.streamer.br.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(line, crlf) {
+			return errBodyFraming
+		}
+		if len(line) == len(crlf) {
+			return nil
+		}
+	}
+}
+
+// close discards what is left of the body, it returns false if the connection
+// can't be reused.
+func (b *streamBody) close() bool {
+	if b.eof {
+		return true
+	}
+	if b.err != nil || b.expect {
+		// The client hasn't sent the body, or it's broken
+		b.err = errBodyUnread
+		return false
+	}
+	if b.length < 0 || b.length-b.read <= maxDrainSize {
+		io.CopyN(ioutil.Discard, b, maxDrainSize+1)
+	}
+	return b.eof
+}
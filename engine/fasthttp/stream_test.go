@@ -0,0 +1,80 @@
+package fasthttp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyStreamerFraming(t *testing.T) {
+	// Fills the read buffer up to the CRLF of the line
+	long := "X-Long: " + strings.Repeat("a", 4096-len("X-Long: ")) + "\r\n"
+
+	for _, tc := range []struct {
+		request string
+		ok      bool
+		chunked bool
+		length  int64
+	}{
+		{"GET / HTTP/1.1\r\nHost: vodka\r\n\r\n", true, false, 0},
+		{"\r\n\r\nGET / HTTP/1.1\r\nHost: vodka\r\n\r\n", true, false, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nvodka", true, false, 5},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n", true, true, -1},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\n\r\n", true, true, -1},
+		{"POST / HTTP/1.1\r\n" + long + "Transfer-Encoding: chunked\r\n\r\n", true, true, -1},
+
+		// Obsolete line folding
+		{"POST / HTTP/1.1\r\nX-Name: jon\r\n Transfer-Encoding: chunked\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nX-Name: jon\r\n\tContent-Length: 5\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nX-Name: jon\r\n \r\nContent-Length: 5\r\n\r\n", false, false, 0},
+
+		// Duplicate `Content-Length`
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\ncontent-length: 6\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\n", false, false, 0},
+
+		// Transfer codings
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked, identity\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: identity, chunked\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: identity\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: \r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n", false, false, 0},
+
+		// Line endings
+		{"POST / HTTP/1.1\nContent-Length: 5\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nX-Name: jon\rTransfer-Encoding: chunked\r\n\r\n", false, false, 0},
+
+		// Field names
+		{"POST / HTTP/1.1\r\nTransfer-Encoding : chunked\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding\r\n\r\n", false, false, 0},
+		{"POST / HTTP/1.1\r\nX\x00Name: jon\r\n\r\n", false, false, 0},
+	} {
+		rc := new(recordConn)
+		s := &bodyStreamer{conn: rc, br: bufio.NewReader(strings.NewReader(tc.request))}
+		err := s.readHeader()
+		if !tc.ok {
+			assert.Equal(t, errBodyFraming, err, "%q", tc.request)
+			assert.Equal(t, string(badRequest), rc.buf.String(), "%q", tc.request)
+			continue
+		}
+		if !assert.NoError(t, err, "%q", tc.request) {
+			continue
+		}
+		assert.Empty(t, rc.buf.String())
+		if tc.length == 0 {
+			assert.Nil(t, s.body, "%q", tc.request)
+			continue
+		}
+		if assert.NotNil(t, s.body, "%q", tc.request) {
+			assert.Equal(t, tc.chunked, s.body.chunked)
+			assert.Equal(t, tc.length, s.body.length)
+			assert.NotContains(t, string(s.pending), "Content-Length")
+			assert.NotContains(t, string(s.pending), "Transfer-Encoding")
+			assert.True(t, strings.HasSuffix(string(s.pending), "\r\n\r\n"))
+		}
+	}
+}
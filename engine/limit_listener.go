@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"net"
+	"sync"
+)
+
+type (
+	// limitListener caps the number of open connections, in total and per remote
+	// IP address. Once `maxConns` is reached it stops accepting until a connection
+	// is closed, connections exceeding `maxConnsPerIP` are closed right away.
+	limitListener struct {
+		net.Listener
+		sem           chan struct{}
+		maxConnsPerIP int
+		mutex         sync.Mutex
+		conns         map[string]int
+		done          chan struct{}
+		once          sync.Once
+	}
+
+	limitConn struct {
+		net.Conn
+		listener *limitListener
+		ip       string
+		once     sync.Once
+	}
+)
+
+func newLimitListener(ln net.Listener, maxConns, maxConnsPerIP int) net.Listener {
+	l := &limitListener{
+		Listener:      ln,
+		maxConnsPerIP: maxConnsPerIP,
+		conns:         map[string]int{},
+		done:          make(chan struct{}),
+	}
+	if maxConns > 0 {
+		l.sem = make(chan struct{}, maxConns)
+	}
+	return l
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if l.sem != nil {
+			select {
+			case l.sem <- struct{}{}:
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.release("")
+			return nil, err
+		}
+		ip := ""
+		if l.maxConnsPerIP > 0 {
+			if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+				ip = addr.IP.String()
+			}
+		}
+		if ip != "" {
+			l.mutex.Lock()
+			if l.conns[ip] >= l.maxConnsPerIP {
+				l.mutex.Unlock()
+				c.Close()
+				l.release("")
+				continue
+			}
+			l.conns[ip]++
+			l.mutex.Unlock()
+		}
+		return &limitConn{Conn: c, listener: l, ip: ip}, nil
+	}
+}
+
+func (l *limitListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+func (l *limitListener) release(ip string) {
+	if ip != "" {
+		l.mutex.Lock()
+		if l.conns[ip]--; l.conns[ip] <= 0 {
+			delete(l.conns, ip)
+		}
+		l.mutex.Unlock()
+	}
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.listener.release(c.ip)
+	})
+	return err
+}
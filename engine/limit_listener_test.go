@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitListener(t *testing.T) {
+	ln, err := NewListener(Config{Address: "127.0.0.1:0", MaxConns: 2, MaxConnsPerIP: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	// Per IP
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c1.Close()
+	s1 := <-accepted
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	if assert.NoError(t, err) {
+		c2.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = c2.Read(make([]byte, 1))
+		assert.Error(t, err) // Closed by the listener
+		assert.NotContains(t, err.Error(), "timeout")
+		c2.Close()
+	}
+
+	// Closing a connection releases its slot
+	s1.Close()
+	c3, err := net.Dial("tcp", ln.Addr().String())
+	if assert.NoError(t, err) {
+		defer c3.Close()
+		select {
+		case c := <-accepted:
+			c.Close()
+		case <-time.After(time.Second):
+			t.Error("connection not accepted")
+		}
+	}
+}
+
+func TestLimitListenerMaxConns(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	l := newLimitListener(ln, 1, 0)
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if assert.NoError(t, err) {
+			defer c.Close()
+		}
+	}
+	s1 := <-accepted
+	select {
+	case <-accepted:
+		t.Error("second connection accepted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s1.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Error("second connection not accepted")
+	}
+
+	// Close unblocks a waiting `Accept()`
+	l.Close()
+	select {
+	case _, ok := <-accepted:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Error("accept not unblocked")
+	}
+}
+
+func TestNewListenerLimitErrors(t *testing.T) {
+	_, err := NewListener(Config{Address: "127.0.0.1:0", MaxConns: -1})
+	assert.Error(t, err)
+	_, err = NewListener(Config{Address: "127.0.0.1:0", MaxConnsPerIP: 1, ProxyProtocol: true})
+	assert.Error(t, err)
+}
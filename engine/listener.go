@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type (
+	// tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
+	// connections. It's used by ListenAndServe and ListenAndServeTLS so
+	// dead TCP connections (e.g. closing laptop mid-download) eventually
+	// go away.
+	tcpKeepAliveListener struct {
+		*net.TCPListener
+	}
+)
+
+// NewListener returns a `net.Listener` for the provided config. It uses the
+// custom `Config#Listener` if set, otherwise it listens on `Config#Address`.
+// If `Config#ProxyProtocol` is enabled, accepted connections are expected to
+// start with a PROXY protocol header. `Config#MaxConns` and
+// `Config#MaxConnsPerIP` are enforced on accepted connections. TLS is left to
+// the engine.
+func NewListener(c Config) (ln net.Listener, err error) {
+	if c.MaxConns < 0 || c.MaxConnsPerIP < 0 {
+		return nil, errors.New("vodka: connection limits must not be negative")
+	}
+	if c.MaxConnsPerIP > 0 && c.ProxyProtocol {
+		// The client address is only known after reading the PROXY header, per-IP
+		// limits would apply to the proxy instead.
+		return nil, errors.New("vodka: MaxConnsPerIP is not supported with ProxyProtocol")
+	}
+
+	ln = c.Listener
+	if ln == nil {
+		network, address := ParseAddress(c.Address)
+		if network == "unix" {
+			removeStaleSocket(address)
+		}
+		if ln, err = net.Listen(network, address); err != nil {
+			return
+		}
+		if l, ok := ln.(*net.TCPListener); ok {
+			ln = tcpKeepAliveListener{l}
+		}
+	}
+	if c.MaxConns > 0 || c.MaxConnsPerIP > 0 {
+		ln = newLimitListener(ln, c.MaxConns, c.MaxConnsPerIP)
+	}
+	if c.ProxyProtocol {
+		ln = NewProxyListener(ln, c.ProxyHeaderTimeout)
+	}
+	return
+}
+
+// ParseAddress splits a listen address into network and address, as expected by
+// `net.Listen()`. Supported forms are:
+//
+// - "host:port" or "tcp://host:port"
+// - "tcp4://host:port" and "tcp6://host:port"
+// - "unix:///path/to/socket"
+// - "unix://@name" for a Linux abstract socket
+//
+// The scheme requires "://", e.g. "tcp:8080" is the port 8080 of the host tcp.
+func ParseAddress(addr string) (network, address string) {
+	if i := strings.Index(addr, "://"); i > 0 {
+		switch scheme := addr[:i]; scheme {
+		case "tcp", "tcp4", "tcp6", "unix":
+			return scheme, addr[i+3:]
+		}
+	}
+	return "tcp", addr
+}
+
+// removeStaleSocket removes a socket file left behind by a previous process, so
+// that listening on it doesn't fail with "address already in use". Sockets
+// which still accept connections are kept.
+func removeStaleSocket(path string) {
+	if strings.HasPrefix(path, "@") {
+		return // Abstract sockets have no file.
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
+	tc, err := ln.AcceptTCP()
+	if err != nil {
+		return
+	}
+	tc.SetKeepAlive(true)
+	tc.SetKeepAlivePeriod(3 * time.Minute)
+	return tc, nil
+}
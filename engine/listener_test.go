@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddress(t *testing.T) {
+	for _, tt := range []struct {
+		addr, network, address string
+	}{
+		{":1323", "tcp", ":1323"},
+		{"localhost:1323", "tcp", "localhost:1323"},
+		{"[::1]:1323", "tcp", "[::1]:1323"},
+		{"tcp://:1323", "tcp", ":1323"},
+		{"tcp4://127.0.0.1:1323", "tcp4", "127.0.0.1:1323"},
+		{"tcp6://[::1]:1323", "tcp6", "[::1]:1323"},
+		{"unix:///run/app.sock", "unix", "/run/app.sock"},
+		{"unix://@app", "unix", "@app"},
+		{"tcp:1323", "tcp", "tcp:1323"},
+		{"unix:1323", "tcp", "unix:1323"},
+	} {
+		network, address := ParseAddress(tt.addr)
+		assert.Equal(t, tt.network, network, tt.addr)
+		assert.Equal(t, tt.address, address, tt.addr)
+	}
+}
+
+func TestNewListenerUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	ln, err := NewListener(Config{Address: "unix://" + path})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "unix", ln.Addr().Network())
+		assert.Equal(t, path, ln.Addr().String())
+		go func(ln net.Listener) {
+			if c, err := ln.Accept(); err == nil {
+				c.Close()
+			}
+		}(ln)
+		c, err := net.Dial("unix", path)
+		if assert.NoError(t, err) {
+			c.Close()
+		}
+		ln.Close()
+	}
+
+	// Stale socket
+	l, err := net.Listen("unix", path)
+	if assert.NoError(t, err) {
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+		ln2, err := NewListener(Config{Address: "unix://" + path})
+		if assert.NoError(t, err) {
+			ln2.Close()
+		}
+	}
+}
+
+func TestNewListenerAbstractUnix(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are Linux only")
+	}
+	ln, err := NewListener(Config{Address: "unix://@vodka-test"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "@vodka-test", ln.Addr().String())
+		ln.Close()
+	}
+}
+
+func TestNewListenerProxyProtocol(t *testing.T) {
+	ln, err := NewListener(Config{Address: "127.0.0.1:0", ProxyProtocol: true})
+	if assert.NoError(t, err) {
+		defer ln.Close()
+		assert.IsType(t, new(proxyListener), ln)
+	}
+}
@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	// DefaultMaxMultipartMemory is the default `Config#MaxMultipartMemory`.
+	DefaultMaxMultipartMemory = 32 << 20 // 32 MB
+)
+
+// ReadMultipartForm parses a `multipart/form-data` body with the provided
+// `Content-Type`. Files are kept in memory up to maxMemory bytes in total, the
+// others are spooled to temporary files, remove them with
+// `multipart.Form#RemoveAll()`. A maxMemory of zero means
+// `DefaultMaxMultipartMemory`. It returns `http.ErrNotMultipart` if the body
+// isn't a multipart form.
+func ReadMultipartForm(body io.Reader, contentType string, maxMemory int64) (*multipart.Form, error) {
+	t, params, err := mime.ParseMediaType(contentType)
+	if err != nil || t != "multipart/form-data" {
+		return nil, http.ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, http.ErrMissingBoundary
+	}
+	if maxMemory <= 0 {
+		maxMemory = DefaultMaxMultipartMemory
+	}
+	return multipart.NewReader(body, boundary).ReadForm(maxMemory)
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMultipartForm(t *testing.T) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	mw.WriteField("name", "Jon Snow")
+	w, _ := mw.CreateFormFile("file", "notes.txt")
+	w.Write([]byte("winter is coming"))
+	mw.Close()
+
+	// Spooled to a temporary file
+	f, err := ReadMultipartForm(bytes.NewReader(buf.Bytes()), mw.FormDataContentType(), 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Jon Snow"}, f.Value["name"])
+		if assert.Len(t, f.File["file"], 1) {
+			file, err := f.File["file"][0].Open()
+			if assert.NoError(t, err) {
+				osf, ok := file.(*os.File)
+				assert.True(t, ok)
+				b, _ := ioutil.ReadAll(file)
+				assert.Equal(t, "winter is coming", string(b))
+				file.Close()
+				f.RemoveAll()
+				if ok {
+					_, err = os.Stat(osf.Name())
+					assert.True(t, os.IsNotExist(err))
+				}
+			}
+		}
+	}
+
+	// In memory
+	f, err = ReadMultipartForm(bytes.NewReader(buf.Bytes()), mw.FormDataContentType(), 0)
+	if assert.NoError(t, err) {
+		file, _ := f.File["file"][0].Open()
+		_, ok := file.(*os.File)
+		assert.False(t, ok)
+	}
+
+	_, err = ReadMultipartForm(buf, "application/x-www-form-urlencoded", 0)
+	assert.Equal(t, http.ErrNotMultipart, err)
+	_, err = ReadMultipartForm(buf, "multipart/form-data", 0)
+	assert.Equal(t, http.ErrMissingBoundary, err)
+}
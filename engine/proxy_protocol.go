@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// proxyListener wraps a `net.Listener` and returns connections which parse
+	// the HAProxy PROXY protocol header sent ahead of the client data.
+	// See https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+	proxyListener struct {
+		net.Listener
+		timeout time.Duration
+	}
+
+	// proxyConn parses the PROXY protocol header lazily, on the first call to
+	// `Read()`, `RemoteAddr()` or `LocalAddr()`, so that slow clients can't block
+	// the accept loop.
+	proxyConn struct {
+		net.Conn
+		reader       *bufio.Reader
+		timeout      time.Duration
+		once         sync.Once
+		remoteAddr   net.Addr
+		localAddr    net.Addr
+		readDeadline time.Time
+		mutex        sync.Mutex
+		err          error
+	}
+)
+
+const (
+	// DefaultProxyHeaderTimeout is the default maximum duration to wait for the
+	// PROXY protocol header.
+	DefaultProxyHeaderTimeout = 5 * time.Second
+
+	proxyV1MaxLength = 107
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrInvalidProxyHeader is returned when reading from a connection which
+	// sent a malformed PROXY protocol header.
+	ErrInvalidProxyHeader = errors.New("invalid proxy protocol header")
+)
+
+// NewProxyListener returns a `net.Listener` which accepts connections speaking
+// the PROXY protocol, version 1 or 2. The addresses in the header are reported
+// by `net.Conn#RemoteAddr()` and `net.Conn#LocalAddr()`. Connections without
+// the header are served as is. `timeout` bounds the time to wait for the header,
+// it defaults to `DefaultProxyHeaderTimeout`.
+//
+// Only use it on listeners which are reachable exclusively through the proxy,
+// otherwise any client can claim an arbitrary address.
+func NewProxyListener(ln net.Listener, timeout time.Duration) net.Listener {
+	if timeout == 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	return &proxyListener{Listener: ln, timeout: timeout}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:    c,
+		reader:  bufio.NewReader(c),
+		timeout: l.timeout,
+	}, nil
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline = t
+	c.mutex.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline = t
+	c.mutex.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer func() {
+		// Restore the deadline set by the server, if any.
+		c.mutex.Lock()
+		c.Conn.SetReadDeadline(c.readDeadline)
+		c.mutex.Unlock()
+	}()
+
+	b, err := c.reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+	switch b[0] {
+	case proxyV1Prefix[0]:
+		if b, _ = c.reader.Peek(len(proxyV1Prefix)); bytes.Equal(b, proxyV1Prefix) {
+			c.err = c.readV1()
+		}
+	case proxyV2Signature[0]:
+		if b, _ = c.reader.Peek(len(proxyV2Signature)); bytes.Equal(b, proxyV2Signature) {
+			c.err = c.readV2()
+		}
+	}
+	if c.err != nil && c.err != io.EOF {
+		c.err = fmt.Errorf("%v from %s: %v", ErrInvalidProxyHeader, c.Conn.RemoteAddr(), c.err)
+	}
+}
+
+// readV1 parses the human-readable header, e.g.
+// "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n".
+func (c *proxyConn) readV1() error {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) == proxyV1MaxLength {
+			return errors.New("header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errors.New("header not terminated by CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return errors.New("missing protocol")
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return fmt.Errorf("unsupported protocol %q", fields[1])
+	}
+	if len(fields) != 6 {
+		return errors.New("wrong number of fields")
+	}
+	src, err := parseProxyTCPAddr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseProxyTCPAddr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	c.remoteAddr, c.localAddr = src, dst
+	return nil
+}
+
+// readV2 parses the binary header.
+func (c *proxyConn) readV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	if header[12]>>4 != 2 {
+		return fmt.Errorf("unsupported version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	switch command {
+	case 0x0: // LOCAL, e.g. health checks by the proxy itself
+		return nil
+	case 0x1: // PROXY
+	default:
+		return fmt.Errorf("unsupported command %d", command)
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return errors.New("short IPv4 address block")
+		}
+		c.remoteAddr = proxyV2Addr(family, payload[0:4], payload[8:10])
+		c.localAddr = proxyV2Addr(family, payload[4:8], payload[10:12])
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return errors.New("short IPv6 address block")
+		}
+		c.remoteAddr = proxyV2Addr(family, payload[0:16], payload[32:34])
+		c.localAddr = proxyV2Addr(family, payload[16:32], payload[34:36])
+	case 0x3: // AF_UNIX
+		if len(payload) < 216 {
+			return errors.New("short unix address block")
+		}
+		c.remoteAddr = &net.UnixAddr{Name: string(bytes.TrimRight(payload[0:108], "\x00")), Net: "unix"}
+		c.localAddr = &net.UnixAddr{Name: string(bytes.TrimRight(payload[108:216], "\x00")), Net: "unix"}
+	}
+	return nil
+}
+
+func proxyV2Addr(family byte, ip, port []byte) net.Addr {
+	p := int(binary.BigEndian.Uint16(port))
+	if family&0x0f == 0x2 { // DGRAM
+		return &net.UDPAddr{IP: net.IP(append([]byte(nil), ip...)), Port: p}
+	}
+	return &net.TCPAddr{IP: net.IP(append([]byte(nil), ip...)), Port: p}
+}
+
+func parseProxyTCPAddr(ip, port string) (*net.TCPAddr, error) {
+	a := net.ParseIP(ip)
+	if a == nil {
+		return nil, fmt.Errorf("invalid address %q", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: a, Port: int(p)}, nil
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pipeListener struct {
+	net.Listener
+	conn net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	return l.conn, nil
+}
+
+func proxyTest(t *testing.T, data []byte) (net.Conn, []byte, error) {
+	server, client := net.Pipe()
+	go func() {
+		client.Write(data)
+		client.Close()
+	}()
+	ln := NewProxyListener(&pipeListener{conn: server}, 0)
+	c, err := ln.Accept()
+	if !assert.NoError(t, err) {
+		return nil, nil, err
+	}
+	b, err := ioutil.ReadAll(c)
+	return c, b, err
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	c, b, err := proxyTest(t, []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET / HTTP/1.1\r\n\r\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "192.168.0.1:56324", c.RemoteAddr().String())
+		assert.Equal(t, "192.168.0.11:443", c.LocalAddr().String())
+		assert.Equal(t, "GET / HTTP/1.1\r\n\r\n", string(b))
+	}
+
+	c, _, err = proxyTest(t, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[2001:db8::1]:56324", c.RemoteAddr().String())
+	}
+
+	c, b, err = proxyTest(t, []byte("PROXY UNKNOWN\r\nPING"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "pipe", c.RemoteAddr().String())
+		assert.Equal(t, "PING", string(b))
+	}
+
+	_, _, err = proxyTest(t, []byte("PROXY TCP4 192.168.0.1\r\n"))
+	assert.Error(t, err)
+	_, _, err = proxyTest(t, []byte("PROXY TCP4 999.168.0.1 192.168.0.11 56324 443\r\n"))
+	assert.Error(t, err)
+	_, _, err = proxyTest(t, append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), 200)...))
+	assert.Error(t, err)
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	header := func(command, family byte, payload []byte) []byte {
+		b := append([]byte(nil), proxyV2Signature...)
+		b = append(b, 0x20|command, family, 0, 0)
+		binary.BigEndian.PutUint16(b[14:], uint16(len(payload)))
+		return append(b, payload...)
+	}
+
+	// TCP over IPv4
+	payload := []byte{10, 0, 0, 1, 10, 0, 0, 2, 0xdb, 0xfc, 0x01, 0xbb}
+	c, b, err := proxyTest(t, append(header(0x1, 0x11, payload), "GET"...))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "10.0.0.1:56316", c.RemoteAddr().String())
+		assert.Equal(t, "10.0.0.2:443", c.LocalAddr().String())
+		assert.Equal(t, "GET", string(b))
+	}
+
+	// TCP over IPv6
+	payload = make([]byte, 36)
+	copy(payload, net.ParseIP("2001:db8::1"))
+	copy(payload[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(payload[32:], 56316)
+	binary.BigEndian.PutUint16(payload[34:], 443)
+	c, _, err = proxyTest(t, header(0x1, 0x21, payload))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[2001:db8::1]:56316", c.RemoteAddr().String())
+	}
+
+	// LOCAL
+	c, b, err = proxyTest(t, append(header(0x0, 0x00, nil), "PING"...))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "pipe", c.RemoteAddr().String())
+		assert.Equal(t, "PING", string(b))
+	}
+
+	// Short address block
+	_, _, err = proxyTest(t, header(0x1, 0x11, []byte{10, 0, 0, 1}))
+	assert.Error(t, err)
+}
+
+func TestProxyProtocolNoHeader(t *testing.T) {
+	c, b, err := proxyTest(t, []byte("POST / HTTP/1.1\r\n\r\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "pipe", c.RemoteAddr().String())
+		assert.Equal(t, "POST / HTTP/1.1\r\n\r\n", string(b))
+	}
+}
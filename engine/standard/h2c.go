@@ -0,0 +1,309 @@
+package standard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// h2cConn is a connection switched from HTTP/1.1 to HTTP/2 with
+	// `Upgrade: h2c`. It passes the upgrade request to the HTTP/2 server as
+	// stream 1, right after the client's connection preface.
+	h2cConn struct {
+		net.Conn
+		reader   io.Reader
+		settings []byte
+		request  []byte
+		listener *h2cListener
+		server   *Server
+	}
+
+	// h2cListener accepts a single upgraded connection, it's closed along with
+	// the connection.
+	h2cListener struct {
+		conns chan net.Conn
+		done  chan struct{}
+		once  sync.Once
+		addr  net.Addr
+	}
+)
+
+const (
+	h2cPreface      = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	h2cMaxFrameSize = 16384
+)
+
+var (
+	errH2CPreface  = errors.New("vodka: invalid HTTP/2 connection preface")
+	errH2CSettings = errors.New("vodka: invalid HTTP2-Settings header")
+)
+
+// isH2CUpgrade checks if the request asks to switch to HTTP/2 without TLS, see
+// RFC 7540 section 3.2. Requests with a body are served over HTTP/1.1, as the
+// body would have to be read before switching.
+func isH2CUpgrade(r *http.Request) bool {
+	if r.ProtoMajor != 1 || r.TLS != nil || r.Method == http.MethodConnect ||
+		r.ContentLength != 0 || len(r.TransferEncoding) > 0 {
+		return false
+	}
+	if !headerHasToken(r.Header, "Upgrade", "h2c") ||
+		!headerHasToken(r.Header, "Connection", "Upgrade") ||
+		!headerHasToken(r.Header, "Connection", "HTTP2-Settings") {
+		return false
+	}
+	_, err := h2cSettings(r)
+	return err == nil
+}
+
+// h2cSettings decodes the SETTINGS frame payload of the `HTTP2-Settings`
+// request header.
+func h2cSettings(r *http.Request) ([]byte, error) {
+	settings := r.Header["Http2-Settings"]
+	if len(settings) != 1 {
+		return nil, errH2CSettings
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(settings[0], "="))
+	if err != nil || len(b)%6 != 0 || len(b) > h2cMaxFrameSize {
+		return nil, errH2CSettings
+	}
+	return b, nil
+}
+
+// upgradeH2C switches the connection of an `Upgrade: h2c` request to HTTP/2
+// and serves the request as its first stream. It returns false if the
+// connection can't be taken over, the request is served over HTTP/1.1 then.
+// Upgraded connections are closed by `Server#Stop()`.
+func (s *Server) upgradeH2C(w http.ResponseWriter, r *http.Request) bool {
+	settings, err := h2cSettings(r)
+	if err != nil {
+		return false
+	}
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return false
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return false
+	}
+	l := &h2cListener{
+		conns: make(chan net.Conn, 1),
+		done:  make(chan struct{}),
+		addr:  conn.LocalAddr(),
+	}
+	c := &h2cConn{
+		Conn:     conn,
+		reader:   rw.Reader,
+		settings: settings,
+		request:  h2cHeaderFrames(r),
+		listener: l,
+		server:   s,
+	}
+	if !s.trackH2C(c, true) {
+		conn.Close()
+		return true
+	}
+	conn.SetDeadline(time.Time{})
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		c.Close()
+		return true
+	}
+
+	l.conns <- c
+	go func() {
+		s.Serve(l)
+		// Not accepted if the server is shutting down
+		select {
+		case c := <-l.conns:
+			c.Close()
+		default:
+		}
+	}()
+	return true
+}
+
+// h2cHeaderFrames encodes the request as HEADERS and CONTINUATION frames of
+// stream 1. Header fields are sent as HPACK literals without indexing, as the
+// decoder state of the server starts empty.
+func h2cHeaderFrames(r *http.Request) []byte {
+	var block []byte
+	field := func(name, value string) {
+		block = append(block, 0)
+		block = appendHPACKString(block, name)
+		block = appendHPACKString(block, value)
+	}
+	field(":method", r.Method)
+	field(":scheme", "http")
+	field(":authority", r.Host)
+	field(":path", r.RequestURI)
+	for k, v := range r.Header {
+		if isH2CHopHeader(r.Header, k) {
+			continue
+		}
+		name := strings.ToLower(k)
+		for _, value := range v {
+			if name == "te" && value != "trailers" {
+				continue
+			}
+			field(name, value)
+		}
+	}
+
+	var frames []byte
+	typ, flags := byte(0x1), byte(0x1) // HEADERS, END_STREAM
+	for {
+		n := len(block)
+		if n > h2cMaxFrameSize {
+			n = h2cMaxFrameSize
+		}
+		if n == len(block) {
+			flags |= 0x4 // END_HEADERS
+		}
+		frames = append(frames, byte(n>>16), byte(n>>8), byte(n), typ, flags, 0, 0, 0, 1)
+		frames = append(frames, block[:n]...)
+		if block = block[n:]; len(block) == 0 {
+			return frames
+		}
+		typ, flags = 0x9, 0 // CONTINUATION
+	}
+}
+
+// appendHPACKString appends a string literal without Huffman encoding.
+func appendHPACKString(b []byte, s string) []byte {
+	n := len(s)
+	if n < 127 {
+		b = append(b, byte(n))
+	} else {
+		b = append(b, 127)
+		for n -= 127; n >= 128; n >>= 7 {
+			b = append(b, byte(n&0x7f|0x80))
+		}
+		b = append(b, byte(n))
+	}
+	return append(b, s...)
+}
+
+// isH2CHopHeader checks if the header is specific to the HTTP/1.1 connection,
+// HTTP/2 doesn't allow to forward it.
+func isH2CHopHeader(h http.Header, key string) bool {
+	switch key {
+	case "Connection", "Upgrade", "Http2-Settings", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Host":
+		return true
+	}
+	return headerHasToken(h, "Connection", key)
+}
+
+// headerHasToken checks if the comma separated values of the header contain
+// the token, ignoring case.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h[key] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *h2cConn) Read(b []byte) (int, error) {
+	if c.request != nil {
+		prefix, err := readH2CPreface(c.reader, c.settings)
+		if err != nil {
+			return 0, err
+		}
+		c.reader = io.MultiReader(bytes.NewReader(append(prefix, c.request...)), c.reader)
+		c.request = nil
+	}
+	return c.reader.Read(b)
+}
+
+func (c *h2cConn) Close() error {
+	err := c.Conn.Close()
+	c.listener.Close()
+	c.server.trackH2C(c, false)
+	return err
+}
+
+// trackH2C adds or removes an upgraded connection to be closed by `Stop()`. It
+// returns false if the server is already stopped.
+func (s *Server) trackH2C(c *h2cConn, add bool) bool {
+	s.h2cMutex.Lock()
+	defer s.h2cMutex.Unlock()
+	if !add {
+		delete(s.h2cConns, c)
+		return true
+	}
+	if s.h2cConns == nil {
+		return false
+	}
+	s.h2cConns[c] = struct{}{}
+	return true
+}
+
+// closeH2C closes the upgraded connections and stops tracking new ones.
+func (s *Server) closeH2C() {
+	s.h2cMutex.Lock()
+	conns := s.h2cConns
+	s.h2cConns = nil
+	s.h2cMutex.Unlock()
+	for c := range conns {
+		c.Close()
+	}
+}
+
+// readH2CPreface reads the connection preface of the client, followed by its
+// SETTINGS frame. The settings of the `HTTP2-Settings` header are prepended to
+// the frame, so that the HTTP/2 server applies them first, as the initial
+// settings of the client, and acknowledges both with one SETTINGS frame, as
+// the client expects. See RFC 7540 section 3.2.1.
+func readH2CPreface(r io.Reader, settings []byte) ([]byte, error) {
+	b := make([]byte, len(h2cPreface)+9)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	header := b[len(h2cPreface):]
+	if string(b[:len(h2cPreface)]) != h2cPreface || header[3] != 0x4 || header[4]&0x1 != 0 {
+		return nil, errH2CPreface
+	}
+	n := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if n+len(settings) > h2cMaxFrameSize {
+		return nil, errH2CPreface
+	}
+	size := n + len(settings)
+	header[0], header[1], header[2] = byte(size>>16), byte(size>>8), byte(size)
+	b = append(b, settings...)
+	b = append(b, make([]byte, n)...)
+	if _, err := io.ReadFull(r, b[len(b)-n:]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (l *h2cListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *h2cListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *h2cListener) Addr() net.Addr {
+	return l.addr
+}
@@ -29,6 +29,11 @@ func (h *Header) Get(key string) string {
 	return h.Header.Get(key)
 }
 
+// Values implements `engine.Header#Values` function.
+func (h *Header) Values(key string) []string {
+	return h.Header[http.CanonicalHeaderKey(key)]
+}
+
 // Keys implements `engine.Header#Keys` function.
 func (h *Header) Keys() (keys []string) {
 	keys = make([]string, len(h.Header))
@@ -42,7 +47,7 @@ func (h *Header) Keys() (keys []string) {
 
 // Contains implements `engine.Header#Contains` function.
 func (h *Header) Contains(key string) bool {
-	_, ok := h.Header[key]
+	_, ok := h.Header[http.CanonicalHeaderKey(key)]
 	return ok
 }
 
@@ -1,12 +1,14 @@
 package standard
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/insionng/vodka"
@@ -18,23 +20,23 @@ type (
 	// Request implements `engine.Request`.
 	Request struct {
 		*http.Request
-		header engine.Header
-		url    engine.URL
-		logger log.Logger
+		header         engine.Header
+		url            engine.URL
+		logger         log.Logger
+		connID         uint64
+		connRequestNum uint64
+		maxMemory      int64
 	}
 )
 
-const (
-	defaultMemory = 32 << 20 // 32 MB
-)
-
 // NewRequest returns `Request` instance.
 func NewRequest(r *http.Request, l log.Logger) *Request {
 	return &Request{
-		Request: r,
-		url:     &URL{URL: r.URL},
-		header:  &Header{Header: r.Header},
-		logger:  l,
+		Request:   r,
+		url:       &URL{URL: r.URL},
+		header:    &Header{Header: r.Header},
+		logger:    l,
+		maxMemory: engine.DefaultMaxMultipartMemory,
 	}
 }
 
@@ -43,6 +45,16 @@ func (r *Request) IsTLS() bool {
 	return r.Request.TLS != nil
 }
 
+// StdRequest returns the native `*http.Request`.
+func (r *Request) StdRequest() *http.Request {
+	return r.Request
+}
+
+// TLSState implements `engine.Request#TLSState` function.
+func (r *Request) TLSState() *tls.ConnectionState {
+	return r.Request.TLS
+}
+
 // Scheme implements `engine.Request#Scheme` function.
 func (r *Request) Scheme() string {
 	// Can't use `r.Request.URL.Scheme`
@@ -78,23 +90,36 @@ func (r *Request) Referer() string {
 	return r.Request.Referer()
 }
 
-// func Proto() string {
-// 	return r.request.Proto()
-// }
-//
-// func ProtoMajor() int {
-// 	return r.request.ProtoMajor()
-// }
-//
-// func ProtoMinor() int {
-// 	return r.request.ProtoMinor()
-// }
+// Proto implements `engine.Request#Proto` function.
+func (r *Request) Proto() string {
+	return r.Request.Proto
+}
+
+// ProtoMajor implements `engine.Request#ProtoMajor` function.
+func (r *Request) ProtoMajor() int {
+	return r.Request.ProtoMajor
+}
+
+// ProtoMinor implements `engine.Request#ProtoMinor` function.
+func (r *Request) ProtoMinor() int {
+	return r.Request.ProtoMinor
+}
 
 // ContentLength implements `engine.Request#ContentLength` function.
 func (r *Request) ContentLength() int64 {
 	return r.Request.ContentLength
 }
 
+// SetContentLength implements `engine.Request#SetContentLength` function.
+func (r *Request) SetContentLength(length int64) {
+	r.Request.ContentLength = length
+	if length < 0 {
+		r.Request.Header.Del(vodka.HeaderContentLength)
+	} else {
+		r.Request.Header.Set(vodka.HeaderContentLength, strconv.FormatInt(length, 10))
+	}
+}
+
 // UserAgent implements `engine.Request#UserAgent` function.
 func (r *Request) UserAgent() string {
 	return r.Request.UserAgent()
@@ -105,6 +130,24 @@ func (r *Request) RemoteAddress() string {
 	return r.RemoteAddr
 }
 
+// LocalAddress implements `engine.Request#LocalAddress` function.
+func (r *Request) LocalAddress() string {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+// ConnID implements `engine.Request#ConnID` function.
+func (r *Request) ConnID() uint64 {
+	return r.connID
+}
+
+// ConnRequestNum implements `engine.Request#ConnRequestNum` function.
+func (r *Request) ConnRequestNum() uint64 {
+	return r.connRequestNum
+}
+
 // RealIP implements `engine.Request#RealIP` function.
 func (r *Request) RealIP() string {
 	ra := r.RemoteAddress()
@@ -150,13 +193,14 @@ func (r *Request) SetBody(reader io.Reader) {
 
 // FormValue implements `engine.Request#FormValue` function.
 func (r *Request) FormValue(name string) string {
+	r.parseMultipartForm()
 	return r.Request.FormValue(name)
 }
 
 // FormParams implements `engine.Request#FormParams` function.
 func (r *Request) FormParams() map[string][]string {
 	if strings.HasPrefix(r.header.Get(vodka.HeaderContentType), vodka.MIMEMultipartForm) {
-		if err := r.ParseMultipartForm(defaultMemory); err != nil {
+		if err := r.ParseMultipartForm(r.maxMemory); err != nil {
 			panic(fmt.Sprintf("vodka: %v", err))
 		}
 	} else {
@@ -169,13 +213,15 @@ func (r *Request) FormParams() map[string][]string {
 
 // FormFile implements `engine.Request#FormFile` function.
 func (r *Request) FormFile(name string) (*multipart.FileHeader, error) {
+	r.parseMultipartForm()
 	_, fh, err := r.Request.FormFile(name)
 	return fh, err
 }
 
-// MultipartForm implements `engine.Request#MultipartForm` function.
+// MultipartForm implements `engine.Request#MultipartForm` function. Files larger
+// than `engine.Config#MaxMultipartMemory` are spooled to temporary files.
 func (r *Request) MultipartForm() (*multipart.Form, error) {
-	err := r.ParseMultipartForm(defaultMemory)
+	err := r.ParseMultipartForm(r.maxMemory)
 	return r.Request.MultipartForm, err
 }
 
@@ -198,8 +244,18 @@ func (r *Request) Cookies() []engine.Cookie {
 	return cookies
 }
 
+// parseMultipartForm parses a multipart form with the configured memory limit,
+// before net/http would parse it with its default.
+func (r *Request) parseMultipartForm() {
+	if strings.HasPrefix(r.header.Get(vodka.HeaderContentType), vodka.MIMEMultipartForm) {
+		r.ParseMultipartForm(r.maxMemory)
+	}
+}
+
 func (r *Request) reset(req *http.Request, h engine.Header, u engine.URL) {
 	r.Request = req
 	r.header = h
 	r.url = u
+	r.connID = 0
+	r.connRequestNum = 0
 }
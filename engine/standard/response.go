@@ -2,10 +2,13 @@ package standard
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
 	"net/http"
+	"strings"
 
+	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/engine"
 	"github.com/insionng/vodka/log"
 )
@@ -14,13 +17,15 @@ type (
 	// Response implements `engine.Response`.
 	Response struct {
 		http.ResponseWriter
-		adapter   *responseAdapter
-		header    engine.Header
-		status    int
-		size      int64
-		committed bool
-		writer    io.Writer
-		logger    log.Logger
+		adapter     *responseAdapter
+		header      engine.Header
+		status      int
+		size        int64
+		committed   bool
+		writer      io.Writer
+		logger      log.Logger
+		beforeFuncs []func()
+		afterFuncs  []func()
 	}
 
 	responseAdapter struct {
@@ -32,6 +37,7 @@ type (
 func NewResponse(w http.ResponseWriter, l log.Logger) (r *Response) {
 	r = &Response{
 		ResponseWriter: w,
+		status:         http.StatusOK,
 		header:         &Header{Header: w.Header()},
 		writer:         w,
 		logger:         l,
@@ -51,6 +57,9 @@ func (r *Response) WriteHeader(code int) {
 		r.logger.Warn("response already committed")
 		return
 	}
+	for _, fn := range r.beforeFuncs {
+		fn()
+	}
 	r.status = code
 	r.ResponseWriter.WriteHeader(code)
 	r.committed = true
@@ -104,18 +113,87 @@ func (r *Response) SetWriter(w io.Writer) {
 	r.writer = w
 }
 
-// Flush implements the http.Flusher interface to allow an HTTP handler to flush
-// buffered data to the client.
+// Push implements `engine.Response#Push` function.
+func (r *Response) Push(target string, header map[string][]string) error {
+	p, ok := r.ResponseWriter.(http.Pusher)
+	if !ok {
+		return engine.ErrNotSupported
+	}
+	err := p.Push(target, &http.PushOptions{Header: header})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return engine.ErrNotSupported
+	}
+	return err
+}
+
+// StdResponseWriter returns the native `http.ResponseWriter`.
+func (r *Response) StdResponseWriter() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Before implements `engine.Response#Before` function.
+func (r *Response) Before(fn func()) {
+	r.beforeFuncs = append(r.beforeFuncs, fn)
+}
+
+// After implements `engine.Response#After` function.
+func (r *Response) After(fn func()) {
+	r.afterFuncs = append(r.afterFuncs, fn)
+}
+
+// Flush implements `engine.Response#Flush` function. It also implements the
+// http.Flusher interface to allow an HTTP handler to flush buffered data to the
+// client.
 // See https://golang.org/pkg/net/http/#Flusher
 func (r *Response) Flush() {
-	r.ResponseWriter.(http.Flusher).Flush()
+	if !r.committed {
+		r.WriteHeader(r.status)
+	}
+	if f, ok := r.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
-// Hijack implements the http.Hijacker interface to allow an HTTP handler to
-// take over the connection.
+// SetTrailer implements `engine.Response#SetTrailer` function.
+func (r *Response) SetTrailer(name, value string) error {
+	name = http.CanonicalHeaderKey(name)
+	h := r.ResponseWriter.Header()
+	if !r.committed && !trailerDeclared(h, name) {
+		h.Add(vodka.HeaderTrailer, name)
+	}
+	h[http.TrailerPrefix+name] = []string{value}
+	return nil
+}
+
+// trailerDeclared reports whether the `Trailer` header of h lists name.
+func trailerDeclared(h http.Header, name string) bool {
+	for _, v := range h[vodka.HeaderTrailer] {
+		for _, n := range strings.Split(v, ",") {
+			if http.CanonicalHeaderKey(strings.TrimSpace(n)) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Hijack implements `engine.Response#Hijack` function. It also implements the
+// http.Hijacker interface to allow an HTTP handler to take over the connection.
 // See https://golang.org/pkg/net/http/#Hijacker
-func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return r.ResponseWriter.(http.Hijacker).Hijack()
+func (r *Response) Hijack() (c net.Conn, rw *bufio.ReadWriter, err error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, engine.ErrNotSupported
+	}
+	if c, rw, err = h.Hijack(); err == nil {
+		r.committed = true
+	}
+	return
 }
 
 // CloseNotify implements the http.CloseNotifier interface to allow detecting
@@ -135,12 +213,33 @@ func (r *Response) reset(w http.ResponseWriter, a *responseAdapter, h engine.Hea
 	r.size = 0
 	r.committed = false
 	r.writer = w
+	r.beforeFuncs = nil
+	r.afterFuncs = nil
+}
+
+// finish commits the response if the handler didn't and calls the functions
+// registered with `After()`.
+func (r *Response) finish() {
+	if !r.committed {
+		r.WriteHeader(r.status)
+	}
+	for _, fn := range r.afterFuncs {
+		fn()
+	}
 }
 
 func (r *responseAdapter) Header() http.Header {
 	return r.ResponseWriter.Header()
 }
 
+// Push implements the http.Pusher interface for wrapped `http.Handler`.
+func (r *responseAdapter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := r.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
 func (r *responseAdapter) reset(res *Response) {
 	r.Response = res
 }
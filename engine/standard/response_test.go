@@ -1,10 +1,12 @@
 package standard
 
 import (
+	"bufio"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/insionng/vodka/engine"
 	"github.com/insionng/vodka/libraries/gommon/log"
 	"github.com/stretchr/testify/assert"
 )
@@ -36,3 +38,87 @@ func TestResponseSetCookie(t *testing.T) {
 	}})
 	assert.Equal(t, "name=Jon Snow", rec.Header().Get("Set-Cookie"))
 }
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	target string
+	header http.Header
+}
+
+func (r *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	r.target = target
+	r.header = opts.Header
+	return nil
+}
+
+func TestResponsePush(t *testing.T) {
+	// HTTP/1.1
+	res := NewResponse(httptest.NewRecorder(), log.New("test"))
+	assert.Equal(t, engine.ErrNotSupported, res.Push("/app.js", nil))
+
+	// HTTP/2
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	res = NewResponse(rec, log.New("test"))
+	if assert.NoError(t, res.Push("/app.js", map[string][]string{"Accept-Encoding": {"gzip"}})) {
+		assert.Equal(t, "/app.js", rec.target)
+		assert.Equal(t, "gzip", rec.header.Get("Accept-Encoding"))
+	}
+}
+
+func TestResponseHooks(t *testing.T) {
+	rec := httptest.NewRecorder()
+	res := NewResponse(rec, log.New("test"))
+	calls := ""
+	res.Before(func() {
+		calls += "before"
+		res.Header().Set("X-Before", "before")
+	})
+	res.After(func() {
+		calls += " after"
+	})
+	res.Write([]byte("test"))
+	assert.Equal(t, "before", calls)
+	assert.Equal(t, "before", rec.Header().Get("X-Before"))
+	res.finish()
+	assert.Equal(t, "before after", calls)
+
+	// Uncommitted response
+	rec = httptest.NewRecorder()
+	res = NewResponse(rec, log.New("test"))
+	res.Before(func() {
+		calls = "before"
+	})
+	res.finish()
+	assert.Equal(t, "before", calls)
+	assert.True(t, res.Committed())
+}
+
+func TestResponseSetTrailer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	res := NewResponse(rec, log.New("test"))
+	assert.NoError(t, res.SetTrailer("x-checksum", ""))
+	assert.NoError(t, res.SetTrailer("X-Checksum", ""))
+	res.Write([]byte("test"))
+	assert.NoError(t, res.SetTrailer("X-Checksum", "sum"))
+	r := rec.Result()
+	assert.Equal(t, []string{"X-Checksum"}, r.Header["Trailer"])
+	assert.Equal(t, "sum", r.Trailer.Get("X-Checksum"))
+}
+
+func TestResponseFlushWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	res := NewResponse(rec, log.New("test"))
+	bw := bufio.NewWriter(rec)
+	res.SetWriter(bw)
+	res.Write([]byte("test"))
+	assert.Equal(t, "", rec.Body.String())
+	res.Flush()
+	assert.Equal(t, "test", rec.Body.String())
+	assert.True(t, rec.Flushed)
+}
+
+func TestResponseHijack(t *testing.T) {
+	res := NewResponse(httptest.NewRecorder(), log.New("test"))
+	_, _, err := res.Hijack()
+	assert.Equal(t, engine.ErrNotSupported, err)
+}
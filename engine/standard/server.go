@@ -1,11 +1,13 @@
 package standard
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/engine"
@@ -17,12 +19,26 @@ type (
 	// Server implements `engine.Server`.
 	Server struct {
 		*http.Server
-		config  engine.Config
-		handler engine.Handler
-		logger  log.Logger
-		pool    *pool
+		config   engine.Config
+		listener net.Listener
+		certs    *engine.CertificateStore
+		state    *engine.ServerState
+		handler  engine.Handler
+		logger   log.Logger
+		pool     *pool
+		connID   uint64
+		h2cConns map[*h2cConn]struct{}
+		h2cMutex sync.Mutex
 	}
 
+	// connState counts the requests of a connection.
+	connState struct {
+		id       uint64
+		requests uint64
+	}
+
+	connStateKey struct{}
+
 	pool struct {
 		request         sync.Pool
 		response        sync.Pool
@@ -50,13 +66,18 @@ func WithTLS(addr, certFile, keyFile string) *Server {
 
 // WithConfig returns `Server` instance with provided config.
 func WithConfig(c engine.Config) (s *Server) {
+	maxMemory := c.MaxMultipartMemory
+	if maxMemory == 0 {
+		maxMemory = engine.DefaultMaxMultipartMemory
+	}
 	s = &Server{
 		Server: new(http.Server),
 		config: c,
+		state:  engine.NewServerState(),
 		pool: &pool{
 			request: sync.Pool{
 				New: func() interface{} {
-					return &Request{logger: s.logger}
+					return &Request{logger: s.logger, maxMemory: maxMemory}
 				},
 			},
 			response: sync.Pool{
@@ -83,12 +104,26 @@ func WithConfig(c engine.Config) (s *Server) {
 		handler: engine.HandlerFunc(func(req engine.Request, res engine.Response) {
 			panic("vodka: handler not set, use `Server#SetHandler()` to set it.")
 		}),
-		logger: glog.New("vodka"),
+		logger:   glog.New("vodka"),
+		h2cConns: make(map[*h2cConn]struct{}),
 	}
 	s.ReadTimeout = c.ReadTimeout
 	s.WriteTimeout = c.WriteTimeout
-	s.Addr = c.Address
+	s.ReadHeaderTimeout = c.ReadHeaderTimeout
+	s.IdleTimeout = c.IdleTimeout
+	s.MaxHeaderBytes = c.MaxHeaderBytes
+	s.SetKeepAlivesEnabled(!c.DisableKeepAlive)
+	if c.H2C {
+		s.Protocols = new(http.Protocols)
+		s.Protocols.SetHTTP1(true)
+		s.Protocols.SetHTTP2(!c.DisableHTTP2)
+		s.Protocols.SetUnencryptedHTTP2(true)
+	}
+	s.Server.Addr = c.Address
 	s.Handler = s
+	s.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, connStateKey{}, &connState{id: atomic.AddUint64(&s.connID, 1)})
+	}
 	return
 }
 
@@ -102,41 +137,92 @@ func (s *Server) SetLogger(l log.Logger) {
 	s.logger = l
 }
 
-// Start implements `engine.Server#Start` function.
-func (s *Server) Start() error {
-	if s.config.Listener == nil {
-		ln, err := net.Listen("tcp", s.config.Address)
-		if err != nil {
-			return err
-		}
+// Listen implements `engine.Server#Listen` function.
+func (s *Server) Listen() error {
+	if s.listener != nil {
+		return nil
+	}
+	if s.config.H2C && s.config.DisableHTTP2 {
+		return errors.New("vodka: H2C requires HTTP/2, unset DisableHTTP2")
+	}
 
-		if s.config.TLSCertFile != "" && s.config.TLSKeyFile != "" {
-			// TODO: https://github.com/golang/go/commit/d24f446a90ea94b87591bf16228d7d871fec3d92
-			config := &tls.Config{}
-			if !s.config.DisableHTTP2 {
-				config.NextProtos = append(config.NextProtos, "h2")
-			}
-			config.Certificates = make([]tls.Certificate, 1)
-			config.Certificates[0], err = tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
-			if err != nil {
-				return err
-			}
-			s.config.Listener = tls.NewListener(tcpKeepAliveListener{ln.(*net.TCPListener)}, config)
-		} else {
-			s.config.Listener = tcpKeepAliveListener{ln.(*net.TCPListener)}
+	config, certs, err := engine.NewTLSConfig(s.config)
+	if err != nil {
+		return err
+	}
+	ln, err := engine.NewListener(s.config)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		if !s.config.DisableHTTP2 {
+			config.NextProtos = []string{"h2", "http/1.1"}
 		}
+		certs.Watch(s.config.TLSReloadInterval, s.config.TLSReloadOnSIGHUP, s.logger)
+		s.certs = certs
+		ln = tls.NewListener(ln, config)
 	}
+	s.listener = ln
+	s.state.SetReady()
+	return nil
+}
 
-	return s.Serve(s.config.Listener)
+// Addr implements `engine.Server#Addr` function.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Start implements `engine.Server#Start` function.
+func (s *Server) Start() (err error) {
+	defer func() {
+		s.state.SetDone(err)
+	}()
+	if err = s.Listen(); err != nil {
+		return
+	}
+	return s.Serve(s.listener)
 }
 
 // Stop implements `engine.Server#Stop` function.
 func (s *Server) Stop() error {
-	return s.config.Listener.Close()
+	s.state.SetStopped()
+	if s.listener == nil {
+		return nil
+	}
+	if s.certs != nil {
+		s.certs.Close()
+	}
+	err := s.listener.Close()
+	s.closeH2C()
+	return err
+}
+
+// Ready implements `engine.Server#Ready` function.
+func (s *Server) Ready() <-chan struct{} {
+	return s.state.Ready()
+}
+
+// Done implements `engine.Server#Done` function.
+func (s *Server) Done() <-chan error {
+	return s.state.Done()
 }
 
 // ServeHTTP implements `http.Handler` interface.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.H2C && isH2CUpgrade(r) && s.upgradeH2C(w, r) {
+		return
+	}
+	if max := s.config.MaxRequestBodySize; max > 0 {
+		if r.ContentLength > max {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+	}
+
 	// Request
 	req := s.pool.request.Get().(*Request)
 	reqHdr := s.pool.header.Get().(*Header)
@@ -144,6 +230,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqHdr.reset(r.Header)
 	reqURL.reset(r.URL)
 	req.reset(r, reqHdr, reqURL)
+	if cs, ok := r.Context().Value(connStateKey{}).(*connState); ok {
+		req.connID = cs.id
+		req.connRequestNum = atomic.AddUint64(&cs.requests, 1)
+	}
 
 	// Response
 	res := s.pool.response.Get().(*Response)
@@ -154,6 +244,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	res.reset(w, resAdpt, resHdr)
 
 	s.handler.ServeHTTP(req, res)
+	res.finish()
 
 	// Return to pool
 	s.pool.request.Put(req)
@@ -163,7 +254,8 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.pool.header.Put(resHdr)
 }
 
-// WrapHandler wraps `http.Handler` into `vodka.HandlerFunc`.
+// WrapHandler wraps `http.Handler` into `vodka.HandlerFunc`. See
+// `vodka.WrapHTTPHandler()` for a version working with every engine.
 func WrapHandler(h http.Handler) vodka.HandlerFunc {
 	return func(c vodka.Context) error {
 		req := c.Request().(*Request)
@@ -173,7 +265,8 @@ func WrapHandler(h http.Handler) vodka.HandlerFunc {
 	}
 }
 
-// WrapMiddleware wraps `func(http.Handler) http.Handler` into `vodka.MiddlewareFunc`
+// WrapMiddleware wraps `func(http.Handler) http.Handler` into `vodka.MiddlewareFunc`.
+// See `vodka.WrapHTTPMiddleware()` for a version working with every engine.
 func WrapMiddleware(m func(http.Handler) http.Handler) vodka.MiddlewareFunc {
 	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
 		return func(c vodka.Context) (err error) {
@@ -186,21 +279,3 @@ func WrapMiddleware(m func(http.Handler) http.Handler) vodka.MiddlewareFunc {
 		}
 	}
 }
-
-// tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
-// connections. It's used by ListenAndServe and ListenAndServeTLS so
-// dead TCP connections (e.g. closing laptop mid-download) eventually
-// go away.
-type tcpKeepAliveListener struct {
-	*net.TCPListener
-}
-
-func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
-	tc, err := ln.AcceptTCP()
-	if err != nil {
-		return
-	}
-	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
-	return tc, nil
-}
@@ -1,13 +1,23 @@
 package standard
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/engine/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -59,3 +69,396 @@ func TestServerWrapMiddleware(t *testing.T) {
 		assert.Equal(t, "OK", rec.Body.String())
 	}
 }
+
+func TestServerListen(t *testing.T) {
+	s := New("127.0.0.1:0")
+	assert.Nil(t, s.Addr())
+	if assert.NoError(t, s.Listen()) {
+		assert.NotNil(t, s.Addr())
+		assert.NotEqual(t, "127.0.0.1:0", s.Addr().String())
+		assert.NoError(t, s.Stop())
+	}
+
+	// Address in use
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		defer ln.Close()
+		assert.Error(t, New(ln.Addr().String()).Listen())
+	}
+}
+
+func TestServerProxyProtocol(t *testing.T) {
+	s := WithConfig(engine.Config{Address: "127.0.0.1:0", ProxyProtocol: true})
+	addr := make(chan string, 1)
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		addr <- req.RemoteAddress()
+		res.WriteHeader(http.StatusOK)
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	c, err := net.Dial("tcp", s.Addr().String())
+	if assert.NoError(t, err) {
+		defer c.Close()
+		c.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 56324 80\r\nGET / HTTP/1.1\r\nHost: vodka\r\n\r\n"))
+		assert.Equal(t, "203.0.113.7:56324", <-addr)
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ca, err := test.NewTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	certFile, keyFile, _ := ca.WriteIssued(dir, "server", "127.0.0.1")
+	caFile, _ := ca.WriteCert(dir)
+	client, _ := ca.Issue("client")
+
+	s := WithConfig(engine.Config{
+		Address:         "127.0.0.1:0",
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+	})
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte(req.TLSState().PeerCertificates[0].Subject.CommonName))
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	url := "https://" + s.Addr().String()
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      ca.Pool(),
+		Certificates: []tls.Certificate{client},
+	}}}
+	r, err := c.Get(url)
+	if assert.NoError(t, err) {
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "client", string(b))
+	}
+
+	// No client certificate
+	c = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.Pool()}}}
+	_, err = c.Get(url)
+	assert.Error(t, err)
+}
+
+func TestServerLimits(t *testing.T) {
+	s := WithConfig(engine.Config{
+		ReadHeaderTimeout:  time.Second,
+		IdleTimeout:        time.Minute,
+		MaxHeaderBytes:     4096,
+		MaxRequestBodySize: 4,
+	})
+	assert.Equal(t, time.Second, s.ReadHeaderTimeout)
+	assert.Equal(t, time.Minute, s.IdleTimeout)
+	assert.Equal(t, 4096, s.MaxHeaderBytes)
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		if _, err := ioutil.ReadAll(req.Body()); err != nil {
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	// Content-Length
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(vodka.POST, "/", strings.NewReader("vodka")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// Chunked
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(vodka.POST, "/", strings.NewReader("vodka"))
+	req.ContentLength = -1
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(vodka.POST, "/", strings.NewReader("gin")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServerH2C(t *testing.T) {
+	s := WithConfig(engine.Config{Address: "127.0.0.1:0", H2C: true})
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		// Go clients disable server push
+		assert.Equal(t, engine.ErrNotSupported, res.Push("/app.js", nil))
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte(req.Proto()))
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	// Prior knowledge
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	c := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	r, err := c.Get("http://" + s.Addr().String())
+	if assert.NoError(t, err) {
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "HTTP/2.0", string(b))
+	}
+
+	// HTTP/1.1
+	r, err = http.Get("http://" + s.Addr().String())
+	if assert.NoError(t, err) {
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "HTTP/1.1", string(b))
+	}
+
+	assert.Error(t, WithConfig(engine.Config{Address: "127.0.0.1:0", H2C: true, DisableHTTP2: true}).Listen())
+}
+
+func TestServerH2CUpgrade(t *testing.T) {
+	s := WithConfig(engine.Config{Address: "127.0.0.1:0", H2C: true})
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		// `HTTP2-Settings` disables push
+		push := res.Push("/vodka", nil)
+		res.WriteHeader(http.StatusOK)
+		fmt.Fprintf(res, "%s %s %s %v", req.Proto(), req.URI(), req.Header().Get("X-Vodka"), push)
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	upgrade := func(method, body string) (net.Conn, *bufio.Reader, *http.Response) {
+		c, err := net.Dial("tcp", s.Addr().String())
+		if !assert.NoError(t, err) {
+			return nil, nil, nil
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(c, "%s /h2c?vodka=1 HTTP/1.1\r\nHost: vodka\r\nConnection: Upgrade, HTTP2-Settings\r\n"+
+			"Upgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\nX-Vodka: jon\r\nContent-Length: %d\r\n\r\n%s",
+			method, len(body), body)
+		br := bufio.NewReader(c)
+		r, err := http.ReadResponse(br, nil)
+		if !assert.NoError(t, err) {
+			c.Close()
+			return nil, nil, nil
+		}
+		return c, br, r
+	}
+
+	// Upgrade
+	c, br, r := upgrade(vodka.GET, "")
+	if c == nil {
+		return
+	}
+	defer c.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, r.StatusCode)
+	assert.Equal(t, "h2c", r.Header.Get("Upgrade"))
+	c.Write([]byte(h2cPreface + "\x00\x00\x00\x04\x00\x00\x00\x00\x00"))
+
+	// The upgrade request is answered on stream 1
+	var headers, body []byte
+	for {
+		frame := make([]byte, 9)
+		if _, err := io.ReadFull(br, frame); !assert.NoError(t, err) {
+			return
+		}
+		payload := make([]byte, int(frame[0])<<16|int(frame[1])<<8|int(frame[2]))
+		if _, err := io.ReadFull(br, payload); !assert.NoError(t, err) {
+			return
+		}
+		if stream := int(frame[5]&0x7f)<<24 | int(frame[6])<<16 | int(frame[7])<<8 | int(frame[8]); stream != 1 {
+			continue
+		}
+		switch frame[3] {
+		case 0x1: // HEADERS
+			headers = payload
+		case 0x0: // DATA
+			body = append(body, payload...)
+		}
+		if frame[4]&0x1 != 0 { // END_STREAM
+			break
+		}
+	}
+	if assert.NotEmpty(t, headers) {
+		assert.Equal(t, byte(0x88), headers[0]) // :status 200, indexed
+	}
+	assert.Equal(t, "HTTP/2.0 /h2c?vodka=1 jon not supported", string(body))
+
+	// Requests with a body are served over HTTP/1.1
+	c, br, r = upgrade(vodka.POST, "vodka")
+	if c == nil {
+		return
+	}
+	defer c.Close()
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+	b, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(t, "HTTP/1.1 /h2c?vodka=1 jon not supported", string(b))
+
+	// Upgraded connections are closed on stop
+	c, br, r = upgrade(vodka.GET, "")
+	if c == nil {
+		return
+	}
+	defer c.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, r.StatusCode)
+	s.Stop()
+	_, err := ioutil.ReadAll(br)
+	assert.NoError(t, err)
+}
+
+func TestServerConnInfo(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+		fmt.Fprintf(res, "%s %d.%d %s %d %d", req.Proto(), req.ProtoMajor(), req.ProtoMinor(),
+			req.LocalAddress(), req.ConnID(), req.ConnRequestNum())
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	addr := s.Addr().String()
+	get := func(c *http.Client) string {
+		r, err := c.Get("http://" + addr)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		return string(b)
+	}
+
+	// Keep-alive
+	c := &http.Client{Transport: &http.Transport{}}
+	var id uint64
+	fmt.Sscanf(get(c), "HTTP/1.1 1.1 "+addr+" %d 1", &id)
+	assert.NotZero(t, id)
+	assert.Equal(t, fmt.Sprintf("HTTP/1.1 1.1 %s %d 2", addr, id), get(c))
+
+	// New connection
+	c = &http.Client{Transport: &http.Transport{}}
+	assert.NotEqual(t, fmt.Sprintf("HTTP/1.1 1.1 %s %d 1", addr, id), get(c))
+}
+
+func TestServerTrailer(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.Before(func() {
+			res.SetTrailer("X-Checksum", "")
+		})
+		res.After(func() {
+			res.SetTrailer("X-Checksum", fmt.Sprint(res.Size()))
+		})
+		res.Write([]byte("vodka"))
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	r, err := http.Get("http://" + s.Addr().String())
+	if assert.NoError(t, err) {
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "vodka", string(b))
+		assert.Equal(t, "5", r.Trailer.Get("X-Checksum"))
+	}
+}
+
+func TestServerHijack(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		c, rw, err := res.Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, res.Committed())
+		go func() {
+			defer c.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString(line)
+			rw.Flush()
+		}()
+	}))
+	if !assert.NoError(t, s.Listen()) {
+		return
+	}
+	defer s.Stop()
+	go s.Start()
+
+	c, err := net.Dial("tcp", s.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte("GET / HTTP/1.1\r\nHost: vodka\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	br := bufio.NewReader(c)
+	r, err := http.ReadResponse(br, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusSwitchingProtocols, r.StatusCode)
+		c.Write([]byte("vodka\n"))
+		line, err := br.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "vodka\n", line)
+		// Nothing else is written to the connection
+		_, err = br.ReadByte()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestServerConformance(t *testing.T) {
+	test.ServerTest(t, func(addr string) engine.Server {
+		return New(addr)
+	})
+}
+
+func TestServerStart(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.SetHandler(engine.HandlerFunc(func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	go s.Start()
+	select {
+	case <-s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not ready")
+	}
+	if assert.NotNil(t, s.Addr()) {
+		r, err := http.Get("http://" + s.Addr().String())
+		if assert.NoError(t, err) {
+			r.Body.Close()
+			assert.Equal(t, http.StatusOK, r.StatusCode)
+		}
+	}
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-s.Done())
+
+	// Address in use
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		defer ln.Close()
+		s = New(ln.Addr().String())
+		assert.Error(t, s.Start())
+		assert.Error(t, <-s.Done())
+	}
+}
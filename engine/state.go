@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// ServerState tracks the lifecycle of a server for `Server#Ready()` and
+	// `Server#Done()`. Engines create it with the server and report to it from
+	// `Server#Listen()`, `Server#Start()` and `Server#Stop()`.
+	ServerState struct {
+		ready     chan struct{}
+		done      chan error
+		readyOnce sync.Once
+		doneOnce  sync.Once
+		stopped   int32
+	}
+)
+
+// NewServerState returns a new `ServerState`.
+func NewServerState() *ServerState {
+	return &ServerState{
+		ready: make(chan struct{}),
+		done:  make(chan error, 1),
+	}
+}
+
+// Ready returns a channel which is closed once the listener is bound.
+func (s *ServerState) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done returns a channel which receives the error the server stopped with and
+// is closed afterwards. The error is nil if the server was stopped with
+// `Server#Stop()`.
+func (s *ServerState) Done() <-chan error {
+	return s.done
+}
+
+// SetReady marks the listener as bound.
+func (s *ServerState) SetReady() {
+	s.readyOnce.Do(func() {
+		close(s.ready)
+	})
+}
+
+// SetStopped marks the server as stopped on purpose, the error it then returns
+// from `Server#Start()` isn't reported by `Done()`.
+func (s *ServerState) SetStopped() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
+// SetDone reports that the server stopped serving with err.
+func (s *ServerState) SetDone(err error) {
+	s.doneOnce.Do(func() {
+		if atomic.LoadInt32(&s.stopped) == 1 {
+			err = nil
+		}
+		s.done <- err
+		close(s.done)
+	})
+}
@@ -26,7 +26,10 @@ func HeaderTest(t *testing.T, header engine.Header) {
 	assert.False(t, header.Contains(h))
 
 	header.Add(h, v)
+	header.Add(h, nv)
 	header.Add(h1, v)
+	assert.Equal(t, []string{v, nv}, header.Values(h))
+	assert.Nil(t, header.Values("X-Missing-Header"))
 
 	for _, expected := range []string{h, h1} {
 		found := false
@@ -0,0 +1,396 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// NewServerFunc returns a new `engine.Server` for the address, see `ServerTest()`.
+	NewServerFunc func(addr string) engine.Server
+)
+
+// ServerTest is the conformance suite for `engine.Server` implementations. It
+// runs the servers returned by newServer on loopback sockets and checks request
+// parsing, forms, multipart, cookies, header semantics, status and size
+// accounting, streaming and keep-alive through a real HTTP client, e.g.
+//
+//	func TestServerConformance(t *testing.T) {
+//		test.ServerTest(t, func(addr string) engine.Server {
+//			return New(addr)
+//		})
+//	}
+func ServerTest(t *testing.T, newServer NewServerFunc) {
+	for _, c := range []struct {
+		name string
+		test func(*testing.T, NewServerFunc)
+	}{
+		{"Request", serverRequestTest},
+		{"RealIP", serverRealIPTest},
+		{"Form", serverFormTest},
+		{"Multipart", serverMultipartTest},
+		{"Cookie", serverCookieTest},
+		{"Header", serverHeaderTest},
+		{"Status", serverStatusTest},
+		{"Streaming", serverStreamingTest},
+		{"KeepAlive", serverKeepAliveTest},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newServer)
+		})
+	}
+}
+
+// serve starts a server with the handler and returns its address and a function
+// to stop it.
+func serve(t *testing.T, newServer NewServerFunc, h engine.HandlerFunc) (string, func()) {
+	s := newServer("127.0.0.1:0")
+	s.SetHandler(h)
+	if err := s.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go s.Start()
+	return s.Addr().String(), func() {
+		s.Stop()
+	}
+}
+
+// do sends the request and returns the response with its body read.
+func do(t *testing.T, r *http.Request) (*http.Response, string) {
+	c := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := c.Do(r)
+	if err != nil {
+		t.Fatalf("%s %s: %v", r.Method, r.URL, err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("%s %s: %v", r.Method, r.URL, err)
+	}
+	return res, string(b)
+}
+
+func serverRequestTest(t *testing.T, newServer NewServerFunc) {
+	var addr string
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		assert.Equal(t, vodka.PUT, req.Method())
+		assert.Equal(t, "/users/1?name=Jon+Snow&role=", req.URI())
+		assert.Equal(t, "/users/1", req.URL().Path())
+		assert.Equal(t, "Jon Snow", req.URL().QueryParam("name"))
+		assert.Equal(t, map[string][]string{"name": {"Jon Snow"}, "role": {""}}, req.URL().QueryParams())
+		assert.Equal(t, "vodka.test", req.Host())
+		assert.Equal(t, "http", req.Scheme())
+		assert.False(t, req.IsTLS())
+		assert.Nil(t, req.TLSState())
+		assert.Equal(t, "HTTP/1.1", req.Proto())
+		assert.Equal(t, 1, req.ProtoMajor())
+		assert.Equal(t, 1, req.ProtoMinor())
+		assert.Equal(t, "vodka-test", req.UserAgent())
+		assert.Equal(t, "http://vodka.test/", req.Referer())
+		host, _, _ := net.SplitHostPort(req.RemoteAddress())
+		assert.Equal(t, "127.0.0.1", host)
+		assert.Equal(t, addr, req.LocalAddress())
+		assert.Equal(t, int64(8), req.ContentLength())
+		b, err := ioutil.ReadAll(req.Body())
+		assert.NoError(t, err)
+		assert.Equal(t, "Jon Snow", string(b))
+		res.WriteHeader(http.StatusNoContent)
+	})
+	defer stop()
+
+	r, _ := http.NewRequest(vodka.PUT, "http://"+addr+"/users/1?name=Jon+Snow&role=", strings.NewReader("Jon Snow"))
+	r.Host = "vodka.test"
+	r.Header.Set("User-Agent", "vodka-test")
+	r.Header.Set("Referer", "http://vodka.test/")
+	res, _ := do(t, r)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+}
+
+func serverRealIPTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte(req.RealIP()))
+	})
+	defer stop()
+
+	for _, c := range []struct {
+		header, value, expected string
+	}{
+		{"", "", "127.0.0.1"},
+		{vodka.HeaderXRealIP, "203.0.113.1", "203.0.113.1"},
+		{vodka.HeaderXForwardedFor, "203.0.113.2", "203.0.113.2"},
+	} {
+		r, _ := http.NewRequest(vodka.GET, "http://"+addr, nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		_, body := do(t, r)
+		assert.Equal(t, c.expected, body, c.header)
+	}
+}
+
+func serverFormTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		assert.Equal(t, "Jon Snow", req.FormValue("name"))
+		assert.Equal(t, "", req.FormValue("missing"))
+		assert.Equal(t, map[string][]string{"name": {"Jon Snow"}, "house": {"Stark", "Targaryen"}}, req.FormParams())
+		res.WriteHeader(http.StatusOK)
+	})
+	defer stop()
+
+	form := url.Values{"name": {"Jon Snow"}, "house": {"Stark", "Targaryen"}}
+	r, _ := http.NewRequest(vodka.POST, "http://"+addr, strings.NewReader(form.Encode()))
+	r.Header.Set(vodka.HeaderContentType, vodka.MIMEApplicationForm)
+	res, _ := do(t, r)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func serverMultipartTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		assert.Equal(t, "notes", req.FormValue("title"))
+		if fh, err := req.FormFile("file"); assert.NoError(t, err) {
+			assert.Equal(t, "notes.txt", fh.Filename)
+			if f, err := fh.Open(); assert.NoError(t, err) {
+				b, _ := ioutil.ReadAll(f)
+				f.Close()
+				assert.Equal(t, "winter is coming", string(b))
+			}
+		}
+		if form, err := req.MultipartForm(); assert.NoError(t, err) {
+			assert.Equal(t, []string{"notes"}, form.Value["title"])
+			assert.Len(t, form.File["file"], 1)
+		}
+		_, err := req.FormFile("missing")
+		assert.Error(t, err)
+		res.WriteHeader(http.StatusOK)
+	})
+	defer stop()
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	mw.WriteField("title", "notes")
+	w, _ := mw.CreateFormFile("file", "notes.txt")
+	w.Write([]byte("winter is coming"))
+	mw.Close()
+	r, _ := http.NewRequest(vodka.POST, "http://"+addr, buf)
+	r.Header.Set(vodka.HeaderContentType, mw.FormDataContentType())
+	res, _ := do(t, r)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func serverCookieTest(t *testing.T, newServer NewServerFunc) {
+	expires := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		if c, err := req.Cookie("session"); assert.NoError(t, err) {
+			assert.Equal(t, "session", c.Name())
+			assert.Equal(t, "securetoken", c.Value())
+		}
+		_, err := req.Cookie("missing")
+		assert.Error(t, err)
+		cs := req.Cookies()
+		if assert.Len(t, cs, 2) {
+			assert.Equal(t, "session", cs[0].Name())
+			assert.Equal(t, "user", cs[1].Name())
+			assert.Equal(t, "123", cs[1].Value())
+		}
+
+		c := new(vodka.Cookie)
+		c.SetName("token")
+		c.SetValue("54321")
+		c.SetPath("/")
+		c.SetDomain("vodka.test")
+		c.SetExpires(expires)
+		c.SetSecure(true)
+		c.SetHTTPOnly(true)
+		res.SetCookie(c)
+		c = new(vodka.Cookie)
+		c.SetName("lang")
+		c.SetValue("en")
+		res.SetCookie(c)
+		res.WriteHeader(http.StatusOK)
+	})
+	defer stop()
+
+	r, _ := http.NewRequest(vodka.GET, "http://"+addr, nil)
+	r.Header.Set(vodka.HeaderCookie, "session=securetoken; user=123")
+	res, _ := do(t, r)
+	cs := res.Cookies()
+	if assert.Len(t, cs, 2) {
+		c := cs[0]
+		assert.Equal(t, "token", c.Name)
+		assert.Equal(t, "54321", c.Value)
+		assert.Equal(t, "/", c.Path)
+		assert.Equal(t, "vodka.test", c.Domain)
+		assert.True(t, expires.Equal(c.Expires))
+		assert.True(t, c.Secure)
+		assert.True(t, c.HttpOnly)
+		assert.Equal(t, "lang", cs[1].Name)
+		assert.Equal(t, "en", cs[1].Value)
+	}
+}
+
+func serverHeaderTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		h := req.Header()
+		assert.Equal(t, "a", h.Get("x-multi"))
+		assert.Equal(t, []string{"a", "b"}, h.Values("X-Multi"))
+		assert.True(t, h.Contains("X-MULTI"))
+		assert.False(t, h.Contains("X-Missing"))
+		assert.Nil(t, h.Values("X-Missing"))
+		found := false
+		for _, k := range h.Keys() {
+			if http.CanonicalHeaderKey(k) == "X-Multi" {
+				found = true
+			}
+		}
+		assert.True(t, found)
+
+		h = res.Header()
+		h.Set("X-Single", "a")
+		h.Add("x-multi", "a")
+		h.Add("X-Multi", "b")
+		h.Set("X-Deleted", "a")
+		h.Del("x-deleted")
+		assert.Equal(t, []string{"a", "b"}, h.Values("X-Multi"))
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte("OK"))
+	})
+	defer stop()
+
+	r, _ := http.NewRequest(vodka.GET, "http://"+addr, nil)
+	r.Header.Add("X-Multi", "a")
+	r.Header.Add("X-Multi", "b")
+	res, _ := do(t, r)
+	assert.Equal(t, "a", res.Header.Get("X-Single"))
+	assert.Equal(t, []string{"a", "b"}, res.Header["X-Multi"])
+	assert.Empty(t, res.Header.Get("X-Deleted"))
+}
+
+func serverStatusTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		switch req.URL().Path() {
+		case "/implicit":
+			// Writing commits the response with 200
+			assert.False(t, res.Committed())
+			res.Write([]byte("OK"))
+			assert.True(t, res.Committed())
+			assert.Equal(t, http.StatusOK, res.Status())
+			assert.Equal(t, int64(2), res.Size())
+		case "/created":
+			res.WriteHeader(http.StatusCreated)
+			assert.True(t, res.Committed())
+			// Already committed
+			res.WriteHeader(http.StatusAccepted)
+			assert.Equal(t, http.StatusCreated, res.Status())
+			n, err := res.Write([]byte("created"))
+			assert.NoError(t, err)
+			assert.Equal(t, 7, n)
+			res.Write([]byte("!"))
+			assert.Equal(t, int64(8), res.Size())
+		case "/empty":
+			res.WriteHeader(http.StatusNotFound)
+			assert.Equal(t, int64(0), res.Size())
+		}
+	})
+	defer stop()
+
+	for _, c := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/implicit", "OK", http.StatusOK},
+		{"/created", "created!", http.StatusCreated},
+		{"/empty", "", http.StatusNotFound},
+	} {
+		r, _ := http.NewRequest(vodka.GET, "http://"+addr+c.path, nil)
+		res, body := do(t, r)
+		assert.Equal(t, c.status, res.StatusCode, c.path)
+		assert.Equal(t, c.body, body, c.path)
+	}
+
+	// HEAD
+	r, _ := http.NewRequest(vodka.HEAD, "http://"+addr+"/created", nil)
+	res, body := do(t, r)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Empty(t, body)
+}
+
+func serverStreamingTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		// Request body without Content-Length
+		b, err := ioutil.ReadAll(req.Body())
+		assert.NoError(t, err)
+		res.WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(res, "%s %d\n", b, i)
+			res.Flush()
+		}
+		assert.Equal(t, int64(3*len("chunked 0\n")), res.Size())
+	})
+	defer stop()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("chun"))
+		pw.Write([]byte("ked"))
+		pw.Close()
+	}()
+	r, _ := http.NewRequest(vodka.POST, "http://"+addr, pr)
+	res, body := do(t, r)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "chunked 0\nchunked 1\nchunked 2\n", body)
+}
+
+func serverKeepAliveTest(t *testing.T, newServer NewServerFunc) {
+	addr, stop := serve(t, newServer, func(req engine.Request, res engine.Response) {
+		res.WriteHeader(http.StatusOK)
+		fmt.Fprintf(res, "%d %d", req.ConnID(), req.ConnRequestNum())
+	})
+	defer stop()
+
+	c, err := net.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(c)
+	get := func(header string) (*http.Response, string) {
+		fmt.Fprintf(c, "GET / HTTP/1.1\r\nHost: vodka.test\r\n%s\r\n", header)
+		res, err := http.ReadResponse(br, nil)
+		if !assert.NoError(t, err) {
+			return nil, ""
+		}
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	var id, n uint64
+	_, body := get("")
+	fmt.Sscanf(body, "%d %d", &id, &n)
+	assert.NotZero(t, id)
+	assert.Equal(t, uint64(1), n)
+	res, body := get("Connection: close\r\n")
+	assert.Equal(t, fmt.Sprintf("%d 2", id), body)
+	if res != nil {
+		assert.True(t, res.Close)
+	}
+	// The server closes the connection
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
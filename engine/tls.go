@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/insionng/vodka/log"
+)
+
+type (
+	// TLSCertificate defines a certificate and key file pair.
+	TLSCertificate struct {
+		CertFile string
+		KeyFile  string
+	}
+
+	// CertificateStore holds the TLS certificates of a server. It selects the
+	// certificate by SNI and can reload them from disk while the server is
+	// running.
+	CertificateStore struct {
+		files    []TLSCertificate
+		mutex    sync.RWMutex
+		certs    []*tls.Certificate
+		names    map[string]*tls.Certificate
+		modTimes []time.Time
+		done     chan struct{}
+		once     sync.Once
+	}
+)
+
+// NewTLSConfig returns the `tls.Config` for the provided config, or nil if TLS is
+// not configured. Certificates are served from the returned `CertificateStore`.
+// If `Config#TLSClientCAFile` is set, client certificates are verified against
+// it.
+func NewTLSConfig(c Config) (*tls.Config, *CertificateStore, error) {
+	files := c.TLSCertificates
+	if c.TLSCertFile != "" && c.TLSKeyFile != "" {
+		files = append([]TLSCertificate{{CertFile: c.TLSCertFile, KeyFile: c.TLSKeyFile}}, files...)
+	}
+	if len(files) == 0 {
+		if c.TLSClientCAFile != "" {
+			return nil, nil, errors.New("client certificate verification requires a TLS certificate")
+		}
+		return nil, nil, nil
+	}
+
+	store, err := NewCertificateStore(files...)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &tls.Config{
+		GetCertificate: store.GetCertificate,
+	}
+
+	if c.TLSClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.TLSClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificate found in %s", c.TLSClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if c.TLSClientAuth != tls.NoClientCert {
+		if c.TLSClientAuth >= tls.VerifyClientCertIfGiven && config.ClientCAs == nil {
+			return nil, nil, errors.New("client certificate verification requires TLSClientCAFile")
+		}
+		config.ClientAuth = c.TLSClientAuth
+	}
+	return config, store, nil
+}
+
+// NewCertificateStore loads the provided certificates. The first one is used if
+// no certificate matches the server name requested by the client.
+func NewCertificateStore(files ...TLSCertificate) (*CertificateStore, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no TLS certificate")
+	}
+	s := &CertificateStore{
+		files: files,
+		done:  make(chan struct{}),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload loads the certificates from disk again. If one of them fails to load,
+// the current certificates are kept and the error is returned.
+func (s *CertificateStore) Reload() error {
+	certs := make([]*tls.Certificate, len(s.files))
+	names := map[string]*tls.Certificate{}
+	modTimes := make([]time.Time, len(s.files))
+	for i, f := range s.files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return err
+		}
+		if cert.Leaf == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return err
+			}
+		}
+		certs[i] = &cert
+		for _, name := range certificateNames(cert.Leaf) {
+			if _, ok := names[name]; !ok {
+				names[name] = &cert
+			}
+		}
+		modTimes[i] = s.modTime(f)
+	}
+
+	s.mutex.Lock()
+	s.certs, s.names, s.modTimes = certs, names, modTimes
+	s.mutex.Unlock()
+	return nil
+}
+
+// GetCertificate returns the certificate matching the server name of the TLS
+// handshake. It implements `tls.Config#GetCertificate`.
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if cert, ok := s.names[name]; ok {
+		return cert, nil
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := s.names["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+// Watch reloads the certificates when their files change, checking every
+// `interval`, and when the process receives SIGHUP if `sighup` is true. Errors
+// are reported to the logger. It returns immediately, call `Close()` to stop
+// watching.
+func (s *CertificateStore) Watch(interval time.Duration, sighup bool, logger log.Logger) {
+	if interval <= 0 && !sighup {
+		return
+	}
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	signals := make(chan os.Signal, 1)
+	if sighup {
+		signal.Notify(signals, syscall.SIGHUP)
+	}
+
+	go func() {
+		defer signal.Stop(signals)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-signals:
+			case <-tick:
+				if !s.changed() {
+					continue
+				}
+			}
+			if err := s.Reload(); err != nil {
+				logger.Errorf("tls certificate reload failed: %v", err)
+			} else {
+				logger.Info("tls certificates reloaded")
+			}
+		}
+	}()
+}
+
+// Close stops watching the certificates.
+func (s *CertificateStore) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+func (s *CertificateStore) changed() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for i, f := range s.files {
+		if !s.modTime(f).Equal(s.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CertificateStore) modTime(f TLSCertificate) (t time.Time) {
+	for _, name := range []string{f.CertFile, f.KeyFile} {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return
+}
+
+func certificateNames(cert *x509.Certificate) (names []string) {
+	for _, name := range cert.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(cert.Subject.CommonName))
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return
+}
@@ -0,0 +1,159 @@
+package engine_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/engine/test"
+	glog "github.com/insionng/vodka/libraries/gommon/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ca, err := test.NewTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defaultCert, defaultKey, _ := ca.WriteIssued(dir, "default", "vodka.dev")
+	wildcardCert, wildcardKey, _ := ca.WriteIssued(dir, "wildcard", "*.example.com")
+	apiCert, apiKey, _ := ca.WriteIssued(dir, "api", "api.example.com")
+
+	s, err := engine.NewCertificateStore(
+		engine.TLSCertificate{CertFile: defaultCert, KeyFile: defaultKey},
+		engine.TLSCertificate{CertFile: wildcardCert, KeyFile: wildcardKey},
+		engine.TLSCertificate{CertFile: apiCert, KeyFile: apiKey},
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for name, expected := range map[string]string{
+		"vodka.dev":        "default",
+		"API.example.com.": "api",
+		"www.example.com":  "wildcard",
+		"a.b.example.com":  "default",
+		"unknown.org":      "default",
+		"":                 "default",
+	} {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, cert.Leaf.Subject.CommonName, name)
+		}
+	}
+
+	// Failed reload keeps the current certificates
+	os.Remove(apiKey)
+	assert.Error(t, s.Reload())
+	cert, _ := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+	assert.Equal(t, "api", cert.Leaf.Subject.CommonName)
+
+	_, err = engine.NewCertificateStore()
+	assert.Error(t, err)
+	_, err = engine.NewCertificateStore(engine.TLSCertificate{CertFile: apiCert, KeyFile: apiKey})
+	assert.Error(t, err)
+}
+
+func TestCertificateStoreWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ca, err := test.NewTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	certFile, keyFile, _ := ca.WriteIssued(dir, "vodka", "vodka.dev")
+	s, err := engine.NewCertificateStore(engine.TLSCertificate{CertFile: certFile, KeyFile: keyFile})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Watch(10*time.Millisecond, false, glog.New("test"))
+	defer s.Close()
+	old, _ := s.GetCertificate(&tls.ClientHelloInfo{})
+
+	// Replace the certificate, newer modification time
+	other := filepath.Join(dir, "other")
+	os.Mkdir(other, 0700)
+	newCert, newKey, _ := ca.WriteIssued(other, "vodka", "vodka.dev")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(newCert, later, later)
+	os.Chtimes(newKey, later, later)
+	os.Rename(newKey, keyFile)
+	os.Rename(newCert, certFile)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ := s.GetCertificate(&tls.ClientHelloInfo{})
+		if cert.Leaf.SerialNumber.Cmp(old.Leaf.SerialNumber) != 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("certificate not reloaded")
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ca, err := test.NewTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	certFile, keyFile, _ := ca.WriteIssued(dir, "vodka", "vodka.dev")
+	caFile, _ := ca.WriteCert(dir)
+
+	// No TLS
+	config, store, err := engine.NewTLSConfig(engine.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+	assert.Nil(t, store)
+
+	// Server certificate only
+	config, store, err = engine.NewTLSConfig(engine.Config{TLSCertFile: certFile, TLSKeyFile: keyFile})
+	if assert.NoError(t, err) {
+		assert.NotNil(t, store)
+		assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+	}
+
+	// Client certificates
+	config, _, err = engine.NewTLSConfig(engine.Config{
+		TLSCertificates: []engine.TLSCertificate{{CertFile: certFile, KeyFile: keyFile}},
+		TLSClientCAFile: caFile,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+		assert.NotNil(t, config.ClientCAs)
+	}
+	config, _, err = engine.NewTLSConfig(engine.Config{
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+		TLSClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+	}
+
+	// Errors
+	_, _, err = engine.NewTLSConfig(engine.Config{TLSClientCAFile: caFile})
+	assert.Error(t, err)
+	_, _, err = engine.NewTLSConfig(engine.Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientAuth: tls.RequireAndVerifyClientCert})
+	assert.Error(t, err)
+	_, _, err = engine.NewTLSConfig(engine.Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: keyFile})
+	assert.Error(t, err)
+	_, _, err = engine.NewTLSConfig(engine.Config{TLSCertFile: certFile, TLSKeyFile: certFile})
+	assert.Error(t, err)
+}
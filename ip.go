@@ -0,0 +1,226 @@
+package vodka
+
+import (
+	"net"
+	"strings"
+
+	"github.com/insionng/vodka/engine"
+)
+
+type (
+	// IPExtractor is a function to extract the client IP address from
+	// `engine.Request`. It is set with `Vodka#SetIPExtractor()` and used by
+	// `Context#RealIP()`.
+	IPExtractor func(engine.Request) string
+
+	// TrustOption configures which IP addresses are trusted as proxies.
+	TrustOption func(*ipChecker)
+
+	ipChecker struct {
+		trustLoopback   bool
+		trustLinkLocal  bool
+		trustPrivateNet bool
+		trustIPRanges   []*net.IPNet
+	}
+)
+
+var (
+	privateIPRanges = mustParseCIDRs(
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"fc00::/7",
+	)
+)
+
+// TrustLoopback configures if the loopback addresses (127.0.0.0/8, ::1) are
+// trusted. Default value true.
+func TrustLoopback(v bool) TrustOption {
+	return func(c *ipChecker) {
+		c.trustLoopback = v
+	}
+}
+
+// TrustLinkLocal configures if the link-local addresses (169.254.0.0/16,
+// fe80::/10) are trusted. Default value true.
+func TrustLinkLocal(v bool) TrustOption {
+	return func(c *ipChecker) {
+		c.trustLinkLocal = v
+	}
+}
+
+// TrustPrivateNet configures if the private network addresses (RFC 1918,
+// RFC 4193) are trusted. Default value true.
+func TrustPrivateNet(v bool) TrustOption {
+	return func(c *ipChecker) {
+		c.trustPrivateNet = v
+	}
+}
+
+// TrustIPRange adds a trusted IP range, e.g. the network of your load balancers.
+func TrustIPRange(ipRange *net.IPNet) TrustOption {
+	return func(c *ipChecker) {
+		c.trustIPRanges = append(c.trustIPRanges, ipRange)
+	}
+}
+
+// TrustCIDRs adds trusted IP ranges in CIDR notation, e.g. "10.0.0.0/8". It
+// panics if one of them is invalid.
+func TrustCIDRs(cidrs ...string) TrustOption {
+	ipRanges := mustParseCIDRs(cidrs...)
+	return func(c *ipChecker) {
+		c.trustIPRanges = append(c.trustIPRanges, ipRanges...)
+	}
+}
+
+func newIPChecker(options []TrustOption) *ipChecker {
+	c := &ipChecker{
+		trustLoopback:   true,
+		trustLinkLocal:  true,
+		trustPrivateNet: true,
+	}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+func (c *ipChecker) trust(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if c.trustLoopback && ip.IsLoopback() {
+		return true
+	}
+	if c.trustLinkLocal && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
+		return true
+	}
+	if c.trustPrivateNet {
+		for _, r := range privateIPRanges {
+			if r.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, r := range c.trustIPRanges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractIPDirect returns an `IPExtractor` which uses the network address of the
+// connection and ignores all headers. Use it if clients connect to the server
+// directly, or through a proxy speaking the PROXY protocol.
+func ExtractIPDirect() IPExtractor {
+	return directIP
+}
+
+// ExtractIPFromRealIPHeader returns an `IPExtractor` which uses the `X-Real-IP`
+// header if the request comes from a trusted proxy.
+func ExtractIPFromRealIPHeader(options ...TrustOption) IPExtractor {
+	checker := newIPChecker(options)
+	return func(req engine.Request) string {
+		direct := directIP(req)
+		if !checker.trust(net.ParseIP(direct)) {
+			return direct
+		}
+		if ip := net.ParseIP(strings.TrimSpace(req.Header().Get(HeaderXRealIP))); ip != nil {
+			return ip.String()
+		}
+		return direct
+	}
+}
+
+// ExtractIPFromXFFHeader returns an `IPExtractor` which walks the
+// `X-Forwarded-For` header from right to left, starting at the connection
+// address, and returns the first address which is not a trusted proxy. Only
+// trusted proxies can thus inject addresses.
+func ExtractIPFromXFFHeader(options ...TrustOption) IPExtractor {
+	checker := newIPChecker(options)
+	return func(req engine.Request) string {
+		return extractIPFromChain(checker, directIP(req), splitHeaderValues(req.Header().Values(HeaderXForwardedFor)))
+	}
+}
+
+// ExtractIPFromForwardedHeader returns an `IPExtractor` which walks the `for`
+// parameters of the RFC 7239 `Forwarded` header like `ExtractIPFromXFFHeader()`.
+// See https://tools.ietf.org/html/rfc7239
+func ExtractIPFromForwardedHeader(options ...TrustOption) IPExtractor {
+	checker := newIPChecker(options)
+	return func(req engine.Request) string {
+		elements := splitHeaderValues(req.Header().Values(HeaderForwarded))
+		chain := make([]string, len(elements))
+		for i, e := range elements {
+			chain[i] = forwardedFor(e)
+		}
+		return extractIPFromChain(checker, directIP(req), chain)
+	}
+}
+
+func extractIPFromChain(checker *ipChecker, direct string, chain []string) string {
+	if !checker.trust(net.ParseIP(direct)) {
+		return direct
+	}
+	ip := direct
+	for i := len(chain) - 1; i >= 0; i-- {
+		next := net.ParseIP(stripPort(chain[i]))
+		if next == nil {
+			// Malformed or obfuscated entry, the chain can't be followed any further.
+			return ip
+		}
+		ip = next.String()
+		if !checker.trust(next) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// forwardedFor returns the `for` parameter of a `Forwarded` header element,
+// e.g. `for=192.0.2.60;proto=http;by=203.0.113.43`.
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+			return strings.Trim(pair[4:], `"`)
+		}
+	}
+	return ""
+}
+
+func directIP(req engine.Request) string {
+	return stripPort(req.RemoteAddress())
+}
+
+// stripPort removes the port and the IPv6 brackets from an address, e.g.
+// "[2001:db8::1]:4711" becomes "2001:db8::1".
+func stripPort(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func splitHeaderValues(values []string) (elements []string) {
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			elements = append(elements, strings.TrimSpace(e))
+		}
+	}
+	return
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ipRanges := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("vodka: invalid CIDR " + cidr)
+		}
+		ipRanges[i] = ipRange
+	}
+	return ipRanges
+}
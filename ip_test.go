@@ -0,0 +1,129 @@
+package vodka
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type remoteRequest struct {
+	engine.Request
+	remoteAddress string
+}
+
+func (r *remoteRequest) RemoteAddress() string {
+	return r.remoteAddress
+}
+
+func ipRequest(remoteAddress string, header map[string][]string) engine.Request {
+	req := test.NewRequest(GET, "/", nil)
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header().Add(k, v)
+		}
+	}
+	return &remoteRequest{Request: req, remoteAddress: remoteAddress}
+}
+
+func TestExtractIPDirect(t *testing.T) {
+	extract := ExtractIPDirect()
+	req := ipRequest("203.0.113.7:4711", map[string][]string{
+		HeaderXForwardedFor: {"198.51.100.1"},
+		HeaderXRealIP:       {"198.51.100.1"},
+	})
+	assert.Equal(t, "203.0.113.7", extract(req))
+	assert.Equal(t, "2001:db8::1", extract(ipRequest("[2001:db8::1]:4711", nil)))
+}
+
+func TestExtractIPFromRealIPHeader(t *testing.T) {
+	extract := ExtractIPFromRealIPHeader()
+	header := map[string][]string{HeaderXRealIP: {"198.51.100.1"}}
+
+	// Untrusted peer
+	assert.Equal(t, "203.0.113.7", extract(ipRequest("203.0.113.7:4711", header)))
+
+	// Trusted peer
+	assert.Equal(t, "198.51.100.1", extract(ipRequest("10.0.0.1:4711", header)))
+	assert.Equal(t, "10.0.0.1", extract(ipRequest("10.0.0.1:4711", nil)))
+
+	// Private networks not trusted
+	extract = ExtractIPFromRealIPHeader(TrustPrivateNet(false))
+	assert.Equal(t, "10.0.0.1", extract(ipRequest("10.0.0.1:4711", header)))
+}
+
+func TestExtractIPFromXFFHeader(t *testing.T) {
+	_, lb, _ := net.ParseCIDR("203.0.113.0/24")
+	extract := ExtractIPFromXFFHeader(TrustIPRange(lb))
+
+	// Spoofed header from an untrusted client
+	req := ipRequest("198.51.100.9:4711", map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}})
+	assert.Equal(t, "198.51.100.9", extract(req))
+
+	// Walks right to left over trusted proxies
+	req = ipRequest("203.0.113.7:4711", map[string][]string{HeaderXForwardedFor: {"1.1.1.1, 198.51.100.9, 10.0.0.3"}})
+	assert.Equal(t, "198.51.100.9", extract(req))
+
+	// Multiple header lines
+	req = ipRequest("203.0.113.7:4711", map[string][]string{HeaderXForwardedFor: {"1.1.1.1", "198.51.100.9"}})
+	assert.Equal(t, "198.51.100.9", extract(req))
+
+	// Only trusted proxies
+	req = ipRequest("127.0.0.1:4711", map[string][]string{HeaderXForwardedFor: {"10.0.0.2, 10.0.0.3"}})
+	assert.Equal(t, "10.0.0.2", extract(req))
+
+	// Malformed entry
+	req = ipRequest("127.0.0.1:4711", map[string][]string{HeaderXForwardedFor: {"1.1.1.1, unknown, 10.0.0.3"}})
+	assert.Equal(t, "10.0.0.3", extract(req))
+
+	// No header
+	assert.Equal(t, "127.0.0.1", extract(ipRequest("127.0.0.1:4711", nil)))
+
+	extract = ExtractIPFromXFFHeader(TrustLoopback(false), TrustCIDRs("203.0.113.0/24"))
+	req = ipRequest("127.0.0.1:4711", map[string][]string{HeaderXForwardedFor: {"198.51.100.9"}})
+	assert.Equal(t, "127.0.0.1", extract(req))
+	req = ipRequest("203.0.113.7:4711", map[string][]string{HeaderXForwardedFor: {"198.51.100.9"}})
+	assert.Equal(t, "198.51.100.9", extract(req))
+	assert.Panics(t, func() { TrustCIDRs("invalid") })
+}
+
+func TestExtractIPFromForwardedHeader(t *testing.T) {
+	extract := ExtractIPFromForwardedHeader()
+	req := ipRequest("10.0.0.1:4711", map[string][]string{
+		HeaderForwarded: {`for=198.51.100.9;proto=https, for="[2001:db8:cafe::17]:4711";by=10.0.0.2`},
+	})
+	assert.Equal(t, "2001:db8:cafe::17", extract(req))
+
+	req = ipRequest("10.0.0.1:4711", map[string][]string{
+		HeaderForwarded: {`for=198.51.100.9`, `For="10.0.0.2:4711"`},
+	})
+	assert.Equal(t, "198.51.100.9", extract(req))
+
+	// Obfuscated identifier
+	req = ipRequest("10.0.0.1:4711", map[string][]string{HeaderForwarded: {`for=_hidden`}})
+	assert.Equal(t, "10.0.0.1", extract(req))
+}
+
+func TestContextRealIP(t *testing.T) {
+	e := New()
+	req := ipRequest("203.0.113.7:4711", map[string][]string{HeaderXForwardedFor: {"198.51.100.9"}})
+	c := e.NewContext(req, test.NewResponseRecorder())
+
+	// Headers aren't trusted by default
+	assert.Equal(t, "203.0.113.7", c.RealIP())
+
+	e.SetIPExtractor(ExtractIPFromXFFHeader(TrustCIDRs("203.0.113.0/24")))
+	assert.NotNil(t, e.IPExtractor())
+	assert.Equal(t, "198.51.100.9", c.RealIP())
+	e.SetIPExtractor(nil)
+
+	e.GET("/", func(c Context) error {
+		return c.String(http.StatusOK, c.RealIP())
+	})
+	rec := test.NewResponseRecorder()
+	e.ServeHTTP(req, rec)
+	assert.Equal(t, "203.0.113.7", rec.Body.String())
+}
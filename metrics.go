@@ -0,0 +1,322 @@
+package vodka
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// MetricsRegistry holds metrics and exposes them in the Prometheus text
+	// exposition format. Metrics are registered once by name, registering the
+	// same metric again returns the existing one.
+	MetricsRegistry struct {
+		mutex    sync.RWMutex
+		families map[string]*metricFamily
+	}
+
+	// MetricsCounter is a metric whose value only goes up, e.g. the number of
+	// requests served.
+	MetricsCounter struct {
+		family *metricFamily
+	}
+
+	// MetricsGauge is a metric whose value can go up and down, e.g. the number
+	// of requests in flight.
+	MetricsGauge struct {
+		family *metricFamily
+	}
+
+	// MetricsHistogram is a metric counting observations, e.g. request
+	// durations, in cumulative buckets.
+	MetricsHistogram struct {
+		family *metricFamily
+	}
+
+	metricFamily struct {
+		name    string
+		help    string
+		kind    string
+		labels  []string
+		buckets []float64
+		mutex   sync.Mutex
+		series  map[string]*metricSeries
+	}
+
+	metricSeries struct {
+		labelValues []string
+		value       float64
+		count       uint64
+		buckets     []uint64
+	}
+)
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+var (
+	// DefaultMetricsRegistry is the registry used by the Metrics middleware and
+	// served by `MetricsHandler()`.
+	DefaultMetricsRegistry = NewMetricsRegistry()
+
+	// DefaultMetricsBuckets are the default buckets of request duration
+	// histograms, in seconds.
+	DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	metricNameRegexp  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	metricLabelRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	metricLabelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	metricHelpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// NewMetricsRegistry returns an empty metrics registry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+// MetricsHandler returns a handler serving the metrics of
+// `DefaultMetricsRegistry` in the Prometheus text exposition format.
+func MetricsHandler() HandlerFunc {
+	return DefaultMetricsRegistry.Handler()
+}
+
+// Counter registers a counter with the label names, or returns the one
+// registered with the name. It panics if the name is already used by a
+// different metric.
+func (r *MetricsRegistry) Counter(name, help string, labels ...string) *MetricsCounter {
+	return &MetricsCounter{family: r.register(name, help, metricCounter, labels, nil)}
+}
+
+// Gauge registers a gauge with the label names, or returns the one registered
+// with the name. It panics if the name is already used by a different metric.
+func (r *MetricsRegistry) Gauge(name, help string, labels ...string) *MetricsGauge {
+	return &MetricsGauge{family: r.register(name, help, metricGauge, labels, nil)}
+}
+
+// Histogram registers a histogram with the bucket upper bounds and label names,
+// or returns the one registered with the name. It panics if the name is
+// already used by a different metric. Nil buckets default to
+// `DefaultMetricsBuckets`.
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labels ...string) *MetricsHistogram {
+	if buckets == nil {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	for _, l := range labels {
+		if l == "le" {
+			panic("vodka: histogram " + name + " can't have label le")
+		}
+	}
+	return &MetricsHistogram{family: r.register(name, help, metricHistogram, labels, buckets)}
+}
+
+// Handler returns a handler serving the metrics in the Prometheus text
+// exposition format.
+func (r *MetricsRegistry) Handler() HandlerFunc {
+	return func(c Context) error {
+		buf := new(bytes.Buffer)
+		r.WriteTo(buf)
+		return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format,
+// sorted by name.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.RLock()
+	families := make([]*metricFamily, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	buf := new(bytes.Buffer)
+	for _, f := range families {
+		f.write(buf)
+	}
+	return buf.WriteTo(w)
+}
+
+func (r *MetricsRegistry) register(name, help, kind string, labels []string, buckets []float64) *metricFamily {
+	if !metricNameRegexp.MatchString(name) {
+		panic("vodka: invalid metric name " + name)
+	}
+	for _, l := range labels {
+		if !metricLabelRegexp.MatchString(l) || strings.HasPrefix(l, "__") {
+			panic("vodka: invalid label name " + l + " of metric " + name)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || strings.Join(f.labels, ",") != strings.Join(labels, ",") || fmt.Sprint(f.buckets) != fmt.Sprint(buckets) {
+			panic("vodka: metric " + name + " already registered differently")
+		}
+		return f
+	}
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	r.families[name] = f
+	return f
+}
+
+// Inc increments the counter with the label values by 1.
+func (c *MetricsCounter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter with the label
+// values.
+func (c *MetricsCounter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("vodka: counter " + c.family.name + " can't decrease")
+	}
+	c.family.update(labelValues, func(s *metricSeries) {
+		s.value += v
+	})
+}
+
+// Set sets the gauge with the label values to v.
+func (g *MetricsGauge) Set(v float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *metricSeries) {
+		s.value = v
+	})
+}
+
+// Add adds v, which can be negative, to the gauge with the label values.
+func (g *MetricsGauge) Add(v float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *metricSeries) {
+		s.value += v
+	})
+}
+
+// Inc increments the gauge with the label values by 1.
+func (g *MetricsGauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec decrements the gauge with the label values by 1.
+func (g *MetricsGauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Observe adds the observation v to the histogram with the label values.
+func (h *MetricsHistogram) Observe(v float64, labelValues ...string) {
+	h.family.update(labelValues, func(s *metricSeries) {
+		s.value += v
+		s.count++
+		if i := sort.SearchFloat64s(h.family.buckets, v); i < len(s.buckets) {
+			s.buckets[i]++
+		}
+	})
+}
+
+func (f *metricFamily) update(labelValues []string, fn func(*metricSeries)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("vodka: metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mutex.Lock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == metricHistogram {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	fn(s)
+	f.mutex.Unlock()
+}
+
+func (f *metricFamily) write(buf *bytes.Buffer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if f.help != "" {
+		fmt.Fprintf(buf, "# HELP %s %s\n", f.name, metricHelpEscaper.Replace(f.help))
+	}
+	fmt.Fprintf(buf, "# TYPE %s %s\n", f.name, f.kind)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != metricHistogram {
+			writeMetricSample(buf, f.name, f.labels, s.labelValues, "", s.value)
+			continue
+		}
+		var count uint64
+		for i, b := range f.buckets {
+			count += s.buckets[i]
+			writeMetricSample(buf, f.name+"_bucket", f.labels, s.labelValues, formatMetricValue(b), float64(count))
+		}
+		writeMetricSample(buf, f.name+"_bucket", f.labels, s.labelValues, "+Inf", float64(s.count))
+		writeMetricSample(buf, f.name+"_sum", f.labels, s.labelValues, "", s.value)
+		writeMetricSample(buf, f.name+"_count", f.labels, s.labelValues, "", float64(s.count))
+	}
+}
+
+// writeMetricSample writes a sample line, with the `le` label of a histogram
+// bucket if not empty.
+func writeMetricSample(buf *bytes.Buffer, name string, labels, values []string, le string, v float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 || le != "" {
+		buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, l, metricLabelEscaper.Replace(values[i]))
+		}
+		if le != "" {
+			if len(labels) > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `le="%s"`, le)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatMetricValue(v))
+	buf.WriteByte('\n')
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package vodka
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	r := NewMetricsRegistry()
+	jobs := r.Counter("jobs_total", "Jobs done.\nBy queue.", "queue")
+	jobs.Inc("mail")
+	jobs.Add(2, `a"b\c`)
+	assert.Equal(t, jobs, r.Counter("jobs_total", "", "queue"))
+	r.Gauge("workers", "").Set(3)
+	h := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.5})
+	h.Observe(0.2)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	buf := new(bytes.Buffer)
+	r.WriteTo(buf)
+	assert.Equal(t, `# HELP jobs_total Jobs done.\nBy queue.
+# TYPE jobs_total counter
+jobs_total{queue="a\"b\\c"} 2
+jobs_total{queue="mail"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 2.7
+latency_seconds_count 3
+# TYPE workers gauge
+workers 3
+`, buf.String())
+
+	// Invalid
+	assert.Panics(t, func() { r.Counter("jobs_total", "") })
+	assert.Panics(t, func() { r.Gauge("jobs_total", "", "queue") })
+	assert.Panics(t, func() { r.Counter("jobs-total", "") })
+	assert.Panics(t, func() { r.Counter("jobs", "", "__queue") })
+	assert.Panics(t, func() { r.Histogram("size", "", nil, "le") })
+	assert.Panics(t, func() { jobs.Inc() })
+	assert.Panics(t, func() { jobs.Add(-1, "mail") })
+}
+
+func TestMetricsHandler(t *testing.T) {
+	e := New()
+	r := NewMetricsRegistry()
+	r.Counter("vodka_test_total", "").Inc()
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(test.NewRequest(GET, "/metrics", nil), rec)
+	if assert.NoError(t, r.Handler()(c)) {
+		assert.Equal(t, http.StatusOK, rec.Status())
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get(HeaderContentType))
+		assert.Equal(t, "# TYPE vodka_test_total counter\nvodka_test_total 1\n", rec.Body.String())
+	}
+
+	// Default registry
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(test.NewRequest(GET, "/metrics", nil), rec)
+	if assert.NoError(t, MetricsHandler()(c)) {
+		assert.Equal(t, http.StatusOK, rec.Status())
+	}
+}
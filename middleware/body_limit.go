@@ -100,6 +100,7 @@ func (r *limitedReader) Read(b []byte) (n int, err error) {
 
 func (r *limitedReader) Reset(reader io.Reader, context vodka.Context) {
 	r.reader = reader
+	r.read = 0
 	r.context = context
 }
 
@@ -50,4 +50,12 @@ func TestBodyLimit(t *testing.T) {
 	c = e.NewContext(req, rec)
 	he = BodyLimit("2B")(h)(c).(*vodka.HTTPError)
 	assert.Equal(t, http.StatusRequestEntityTooLarge, he.Code)
+
+	// Pooled readers start over
+	m := BodyLimit("20B")
+	for i := 0; i < 3; i++ {
+		req = test.NewRequest(vodka.POST, "/", bytes.NewReader(hw))
+		c = e.NewContext(req, test.NewResponseRecorder())
+		assert.NoError(t, m(h)(c))
+	}
 }
@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/engine"
+)
+
+type (
+	// bufferedResponse buffers a response to be sent, or discarded, once the
+	// handler has returned.
+	bufferedResponse struct {
+		mutex     sync.Mutex
+		header    bufferedHeader
+		status    int
+		size      int64
+		committed bool
+		discarded bool
+		err       error
+		buffer    bytes.Buffer
+		writer    io.Writer
+		cookies   []engine.Cookie
+		trailers  [][2]string
+		before    []func()
+		after     []func()
+	}
+
+	// bufferedWriter is the writer of `bufferedResponse`, writing to its buffer.
+	bufferedWriter struct {
+		response *bufferedResponse
+	}
+
+	// bufferedHeader implements `engine.Header` for `bufferedResponse`.
+	bufferedHeader struct {
+		http.Header
+		response *bufferedResponse
+	}
+)
+
+// newChildContext returns a copy of c with req and res, for handlers which
+// run apart from the request, e.g. in another goroutine. It must be released
+// with `Vodka#ReleaseContext()` once the handler is done, which removes a body
+// spilled to a temporary file by `Context#BodyBytes()`.
+func newChildContext(c vodka.Context, req engine.Request, res engine.Response) vodka.Context {
+	cc := c.Vodka().NewContext(req, res)
+	cc.SetStdContext(c.StdContext())
+	cc.SetPath(c.Path())
+	cc.SetParamNames(append([]string(nil), c.ParamNames()...)...)
+	cc.SetParamValues(append([]string(nil), c.ParamValues()...)...)
+	cc.SetStore(c.GetStore())
+	cc.SetHandler(c.Handler())
+	return cc
+}
+
+// newBufferedResponse returns a `bufferedResponse` with the headers already set
+// on res.
+func newBufferedResponse(res engine.Response) *bufferedResponse {
+	r := &bufferedResponse{status: http.StatusOK}
+	r.header = bufferedHeader{Header: make(http.Header), response: r}
+	r.writer = &bufferedWriter{response: r}
+	h := res.Header()
+	for _, k := range h.Keys() {
+		r.header.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), h.Values(k)...)
+	}
+	return r
+}
+
+func (r *bufferedResponse) Header() engine.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) WriteHeader(code int) {
+	r.mutex.Lock()
+	if r.committed || r.discarded {
+		r.mutex.Unlock()
+		return
+	}
+	r.mutex.Unlock()
+	for _, fn := range r.before {
+		fn()
+	}
+	r.mutex.Lock()
+	r.status = code
+	r.committed = true
+	r.mutex.Unlock()
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	if !r.Committed() {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.writer.Write(b)
+}
+
+func (r *bufferedResponse) SetCookie(c engine.Cookie) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.discarded {
+		r.cookies = append(r.cookies, c)
+	}
+}
+
+func (r *bufferedResponse) Status() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.status
+}
+
+func (r *bufferedResponse) Size() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.size
+}
+
+func (r *bufferedResponse) Committed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.committed
+}
+
+func (r *bufferedResponse) Writer() io.Writer {
+	return r.writer
+}
+
+func (r *bufferedResponse) SetWriter(w io.Writer) {
+	r.writer = w
+}
+
+func (r *bufferedResponse) Before(fn func()) {
+	r.before = append(r.before, fn)
+}
+
+func (r *bufferedResponse) After(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.discarded {
+		r.after = append(r.after, fn)
+	}
+}
+
+// Flush is ignored, the response is sent once the handler has returned.
+func (r *bufferedResponse) Flush() {
+}
+
+func (r *bufferedResponse) SetTrailer(name, value string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.discarded {
+		r.trailers = append(r.trailers, [2]string{name, value})
+	}
+	return nil
+}
+
+func (r *bufferedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, engine.ErrNotSupported
+}
+
+func (r *bufferedResponse) Push(target string, header map[string][]string) error {
+	return engine.ErrNotSupported
+}
+
+// discard makes the response discard everything written to it, writes return
+// err.
+func (r *bufferedResponse) discard(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.discarded = true
+	r.err = err
+	r.buffer = bytes.Buffer{}
+}
+
+// copyTo writes the buffered response to res.
+func (r *bufferedResponse) copyTo(res engine.Response) {
+	h := res.Header()
+	for _, k := range h.Keys() {
+		if _, ok := r.header.Header[http.CanonicalHeaderKey(k)]; !ok {
+			h.Del(k)
+		}
+	}
+	for k, v := range r.header.Header {
+		h.Del(k)
+		for _, v := range v {
+			h.Add(k, v)
+		}
+	}
+	for _, c := range r.cookies {
+		res.SetCookie(c)
+	}
+	for _, fn := range r.after {
+		res.After(fn)
+	}
+	for _, t := range r.trailers {
+		res.SetTrailer(t[0], t[1])
+	}
+	if r.committed {
+		res.WriteHeader(r.status)
+		res.Write(r.buffer.Bytes())
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	r := w.response
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.discarded {
+		return 0, r.err
+	}
+	n, err := r.buffer.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+func (h bufferedHeader) Add(key, value string) {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	h.Header.Add(key, value)
+}
+
+func (h bufferedHeader) Del(key string) {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	h.Header.Del(key)
+}
+
+func (h bufferedHeader) Set(key, value string) {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	h.Header.Set(key, value)
+}
+
+func (h bufferedHeader) Get(key string) string {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	return h.Header.Get(key)
+}
+
+func (h bufferedHeader) Values(key string) []string {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	return h.Header[http.CanonicalHeaderKey(key)]
+}
+
+func (h bufferedHeader) Keys() (keys []string) {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	for k := range h.Header {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func (h bufferedHeader) Contains(key string) bool {
+	h.response.mutex.Lock()
+	defer h.response.mutex.Unlock()
+	_, ok := h.Header[http.CanonicalHeaderKey(key)]
+	return ok
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChildContextRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vodka")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	tmp := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+	defer os.Setenv("TMPDIR", tmp)
+
+	e := vodka.New()
+	e.SetBodyBufferSize(10)
+	for name, m := range map[string]vodka.MiddlewareFunc{
+		"compress": Compress(),
+		"etag":     ETag(),
+		"timeout":  Timeout(time.Second),
+	} {
+		req := test.NewRequest(vodka.GET, "/", bytes.NewReader(make([]byte, 100)))
+		req.Header().Set(vodka.HeaderAcceptEncoding, "gzip")
+		rec := test.NewResponseRecorder()
+		c := e.NewContext(req, rec)
+		h := m(func(c vodka.Context) error {
+			_, err := c.BodyBytes()
+			assert.Equal(t, vodka.ErrStatusRequestEntityTooLarge, err, name)
+			files, _ := ioutil.ReadDir(dir)
+			assert.Len(t, files, 1, name)
+			return c.String(http.StatusOK, "test")
+		})
+		assert.NoError(t, h(c), name)
+
+		// The body spilled to a temporary file is removed
+		files, _ := ioutil.ReadDir(dir)
+		assert.Empty(t, files, name)
+	}
+}
@@ -0,0 +1,581 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	kontext "context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// CacheConfig defines the config for Cache middleware.
+	CacheConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Store keeps the cached responses.
+		// Optional. Default value `NewCacheMemoryStore()`.
+		Store CacheStore
+
+		// TTL is the time responses are fresh for when the handler doesn't set
+		// `Cache-Control: max-age` or `s-maxage`.
+		// Optional. Default value 1 minute.
+		TTL time.Duration `json:"ttl"`
+
+		// StaleWhileRevalidate is the time stale responses are still served for,
+		// while they are refreshed in the background, when the handler doesn't
+		// set `Cache-Control: stale-while-revalidate`.
+		// Optional. Default value 0.
+		StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"`
+	}
+
+	// CacheEntry is a cached response.
+	CacheEntry struct {
+		// Status is the response status, 0 for the entries listing the `Vary`
+		// headers of the responses of a resource.
+		Status int
+
+		Header     http.Header
+		Body       []byte
+		Vary       []string
+		Tags       []string
+		Created    time.Time
+		Expires    time.Time
+		StaleUntil time.Time
+	}
+
+	// CacheStore keeps the responses cached by `Cache`. Implementations must be
+	// safe for concurrent use.
+	CacheStore interface {
+		// Get returns the entry for key, nil if there is none.
+		Get(key string) *CacheEntry
+
+		// Set stores the entry for key.
+		Set(key string, entry *CacheEntry)
+
+		// Delete removes the entry for key.
+		Delete(key string)
+
+		// Purge removes the entries with any of the provided tags.
+		Purge(tags ...string)
+	}
+
+	// CacheMemoryStoreConfig defines the config for `CacheMemoryStore`.
+	CacheMemoryStoreConfig struct {
+		// MaxSize is the maximum size of the cached responses in bytes, the least
+		// recently used ones are evicted first.
+		// Optional. Default value 64 MB.
+		MaxSize int64 `json:"max_size"`
+
+		// MaxEntries is the maximum number of cached responses.
+		// Optional. Default value 0 (unlimited).
+		MaxEntries int `json:"max_entries"`
+	}
+
+	// CacheMemoryStore is an in-memory LRU `CacheStore`.
+	CacheMemoryStore struct {
+		CacheMemoryStoreConfig
+		mutex   sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List
+		tags    map[string]map[string]struct{}
+		size    int64
+		timeNow func() time.Time
+	}
+
+	cacheItem struct {
+		key   string
+		entry *CacheEntry
+		size  int64
+	}
+
+	// cacheControl holds the directives of a `Cache-Control` header.
+	cacheControl map[string]string
+
+	// cacheWriter copies the response body into a buffer, up to limit bytes.
+	cacheWriter struct {
+		io.Writer
+		buffer   bytes.Buffer
+		limit    int64
+		overflow bool
+	}
+)
+
+const (
+	// HeaderXCache reports whether the response was served from the cache.
+	HeaderXCache = "X-Cache"
+
+	cacheTagsKey = "_cache_tags"
+)
+
+var (
+	// DefaultCacheConfig is the default Cache middleware config.
+	DefaultCacheConfig = CacheConfig{
+		Skipper: defaultSkipper,
+		TTL:     time.Minute,
+	}
+
+	// DefaultCacheMemoryStoreConfig is the default `CacheMemoryStore` config.
+	DefaultCacheMemoryStoreConfig = CacheMemoryStoreConfig{
+		MaxSize: 64 << 20, // 64 MB
+	}
+
+	// cacheableStatus lists the response status codes which are cached.
+	cacheableStatus = map[int]bool{
+		http.StatusOK:                   true,
+		http.StatusNonAuthoritativeInfo: true,
+		http.StatusNoContent:            true,
+		http.StatusMultipleChoices:      true,
+		http.StatusMovedPermanently:     true,
+		http.StatusNotFound:             true,
+		http.StatusGone:                 true,
+	}
+
+	// cacheHeaders lists the response headers which are cached, the ones
+	// describing the representation rather than the request it was sent to.
+	cacheHeaders = []string{
+		vodka.HeaderCacheControl,
+		vodka.HeaderContentDisposition,
+		vodka.HeaderContentEncoding,
+		"Content-Language",
+		vodka.HeaderContentType,
+		vodka.HeaderETag,
+		"Expires",
+		vodka.HeaderLastModified,
+		"Link",
+		vodka.HeaderLocation,
+		vodka.HeaderVary,
+	}
+)
+
+// Cache returns a Cache middleware caching responses in store.
+//
+// Cache middleware caches the responses to GET and HEAD requests, keyed by
+// method, host, path, query and the request headers named in the `Vary`
+// response header. It honors `Cache-Control` of the handler (`no-store`,
+// `no-cache`, `private`, `max-age`, `s-maxage`, `stale-while-revalidate`) and of
+// the client (`no-store`, `no-cache`, `max-age`). Responses setting cookies
+// aren't cached, and only the headers describing the representation, e.g.
+// `Content-Type` or `ETag`, are cached with them. Cached responses answer
+// conditional requests with "304 - Not Modified". The `X-Cache` response
+// header is set to `HIT`, `STALE` or `MISS`. Tag responses with `CacheTags()`
+// to purge them with `CacheStore#Purge()`.
+func Cache(store CacheStore) vodka.MiddlewareFunc {
+	c := DefaultCacheConfig
+	c.Store = store
+	return CacheWithConfig(c)
+}
+
+// CacheWithConfig returns a Cache middleware with config.
+// See: `Cache()`.
+func CacheWithConfig(config CacheConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultCacheConfig.Skipper
+	}
+	if config.Store == nil {
+		config.Store = NewCacheMemoryStore()
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultCacheConfig.TTL
+	}
+	maxSize := int64(-1)
+	if s, ok := config.Store.(*CacheMemoryStore); ok {
+		maxSize = s.MaxSize
+	}
+
+	var (
+		mutex        sync.Mutex
+		revalidating = make(map[string]bool)
+	)
+
+	// save caches the response of c with body.
+	save := func(c vodka.Context, key string, body []byte) {
+		res := c.Response()
+		if !cacheableStatus[res.Status()] || len(res.Header().Values(vodka.HeaderSetCookie)) > 0 {
+			return
+		}
+		header := make(http.Header)
+		for _, k := range cacheHeaders {
+			if v := res.Header().Values(k); len(v) > 0 {
+				header[k] = append([]string(nil), v...)
+			}
+		}
+		cc := parseCacheControl(header.Get(vodka.HeaderCacheControl))
+		if cc.has("no-store") || cc.has("no-cache") || cc.has("private") {
+			return
+		}
+		ttl := config.TTL
+		if v, ok := cc.seconds("s-maxage"); ok {
+			ttl = v
+		} else if v, ok := cc.seconds("max-age"); ok {
+			ttl = v
+		}
+		stale := config.StaleWhileRevalidate
+		if v, ok := cc.seconds("stale-while-revalidate"); ok {
+			stale = v
+		}
+		if ttl <= 0 && stale <= 0 {
+			return
+		}
+		vary := cacheVary(header)
+		if len(vary) == 1 && vary[0] == "*" {
+			return
+		}
+		now := time.Now()
+		e := &CacheEntry{
+			Status:     res.Status(),
+			Header:     header,
+			Body:       body,
+			Vary:       vary,
+			Created:    now,
+			Expires:    now.Add(ttl),
+			StaleUntil: now.Add(ttl + stale),
+		}
+		if tags, ok := c.Get(cacheTagsKey).([]string); ok {
+			e.Tags = tags
+		}
+		if len(vary) > 0 {
+			// List the `Vary` headers of the resource
+			config.Store.Set(key, &CacheEntry{
+				Vary:       vary,
+				Created:    now,
+				Expires:    e.StaleUntil,
+				StaleUntil: e.StaleUntil,
+			})
+			key += cacheVaryKey(c, vary)
+		}
+		config.Store.Set(key, e)
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			req := c.Request()
+			method := req.Method()
+			if method != vodka.GET && method != vodka.HEAD || req.Header().Get(vodka.HeaderAuthorization) != "" {
+				return next(c)
+			}
+			cc := parseCacheControl(req.Header().Get(vodka.HeaderCacheControl))
+			if cc.has("no-store") {
+				return next(c)
+			}
+
+			// Lookup
+			key := cacheKey(c)
+			variant := key
+			e := config.Store.Get(key)
+			if e != nil && e.Status == 0 {
+				variant += cacheVaryKey(c, e.Vary)
+				e = config.Store.Get(variant)
+			}
+			now := time.Now()
+			if e != nil && !cc.has("no-cache") {
+				age := now.Sub(e.Created)
+				maxAge, limited := cc.seconds("max-age")
+				switch {
+				case limited && age > maxAge:
+				case now.Before(e.Expires):
+					return serveCacheEntry(c, e, age, "HIT")
+				case now.Before(e.StaleUntil):
+					mutex.Lock()
+					if !revalidating[variant] {
+						revalidating[variant] = true
+						go func(rc vodka.Context) {
+							defer func() {
+								rc.Vodka().ReleaseContext(rc)
+								mutex.Lock()
+								delete(revalidating, variant)
+								mutex.Unlock()
+							}()
+							w := &cacheWriter{Writer: ioutil.Discard, limit: maxSize}
+							rc.Response().SetWriter(w)
+							if next(rc) == nil && !w.overflow {
+								save(rc, key, w.buffer.Bytes())
+							}
+						}(revalidationContext(c))
+					}
+					mutex.Unlock()
+					return serveCacheEntry(c, e, age, "STALE")
+				}
+			}
+
+			// Miss
+			res := c.Response()
+			res.Header().Set(HeaderXCache, "MISS")
+			w := &cacheWriter{Writer: res.Writer(), limit: maxSize}
+			res.SetWriter(w)
+			err = next(c)
+			res.SetWriter(w.Writer)
+			if err == nil && method == vodka.GET && !w.overflow {
+				save(c, key, w.buffer.Bytes())
+			}
+			return
+		}
+	}
+}
+
+// CacheTags tags the response cached by the Cache middleware, see
+// `CacheStore#Purge()`.
+func CacheTags(c vodka.Context, tags ...string) {
+	t, _ := c.Get(cacheTagsKey).([]string)
+	c.Set(cacheTagsKey, append(t, tags...))
+}
+
+// NewCacheMemoryStore returns an in-memory `CacheStore`.
+func NewCacheMemoryStore() *CacheMemoryStore {
+	return NewCacheMemoryStoreWithConfig(DefaultCacheMemoryStoreConfig)
+}
+
+// NewCacheMemoryStoreWithConfig returns an in-memory `CacheStore` with config.
+func NewCacheMemoryStoreWithConfig(config CacheMemoryStoreConfig) *CacheMemoryStore {
+	// Defaults
+	if config.MaxSize == 0 {
+		config.MaxSize = DefaultCacheMemoryStoreConfig.MaxSize
+	}
+	return &CacheMemoryStore{
+		CacheMemoryStoreConfig: config,
+		entries:                make(map[string]*list.Element),
+		lru:                    list.New(),
+		tags:                   make(map[string]map[string]struct{}),
+		timeNow:                time.Now,
+	}
+}
+
+// Get implements `CacheStore#Get()`.
+func (s *CacheMemoryStore) Get(key string) *CacheEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	item := el.Value.(*cacheItem)
+	if !s.timeNow().Before(item.entry.StaleUntil) {
+		s.remove(el)
+		return nil
+	}
+	s.lru.MoveToFront(el)
+	return item.entry
+}
+
+// Set implements `CacheStore#Set()`.
+func (s *CacheMemoryStore) Set(key string, entry *CacheEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	item := &cacheItem{key: key, entry: entry, size: cacheEntrySize(key, entry)}
+	if item.size > s.MaxSize {
+		return
+	}
+	s.entries[key] = s.lru.PushFront(item)
+	s.size += item.size
+	for _, t := range entry.Tags {
+		if s.tags[t] == nil {
+			s.tags[t] = make(map[string]struct{})
+		}
+		s.tags[t][key] = struct{}{}
+	}
+
+	// Evict
+	for s.size > s.MaxSize || s.MaxEntries > 0 && s.lru.Len() > s.MaxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+// Delete implements `CacheStore#Delete()`.
+func (s *CacheMemoryStore) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+}
+
+// Purge implements `CacheStore#Purge()`.
+func (s *CacheMemoryStore) Purge(tags ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, t := range tags {
+		for key := range s.tags[t] {
+			s.remove(s.entries[key])
+		}
+	}
+}
+
+// Len returns the number of cached entries.
+func (s *CacheMemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lru.Len()
+}
+
+func (s *CacheMemoryStore) remove(el *list.Element) {
+	item := el.Value.(*cacheItem)
+	s.lru.Remove(el)
+	delete(s.entries, item.key)
+	s.size -= item.size
+	for _, t := range item.entry.Tags {
+		delete(s.tags[t], item.key)
+		if len(s.tags[t]) == 0 {
+			delete(s.tags, t)
+		}
+	}
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.limit >= 0 && int64(w.buffer.Len()+len(b)) > w.limit {
+			w.overflow = true
+			w.buffer = bytes.Buffer{}
+		} else {
+			w.buffer.Write(b)
+		}
+	}
+	return w.Writer.Write(b)
+}
+
+// serveCacheEntry sends the cached response e, or "304 - Not Modified" without
+// body if it satisfies the conditional request headers.
+func serveCacheEntry(c vodka.Context, e *CacheEntry, age time.Duration, status string) (err error) {
+	res := c.Response()
+	h := res.Header()
+	for k, v := range e.Header {
+		h.Del(k)
+		for _, v := range v {
+			h.Add(k, v)
+		}
+	}
+	h.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	h.Set(HeaderXCache, status)
+	if e.Status == http.StatusOK {
+		lastModified, _ := http.ParseTime(h.Get(vodka.HeaderLastModified))
+		if c.CheckPreconditions(h.Get(vodka.HeaderETag), lastModified) == vodka.ErrNotModified {
+			h.Del(vodka.HeaderContentType)
+			h.Del(vodka.HeaderContentLength)
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	res.WriteHeader(e.Status)
+	if c.Request().Method() != vodka.HEAD {
+		_, err = res.Write(e.Body)
+	}
+	return
+}
+
+// revalidationContext returns a copy of c for the handler to run in the
+// background, after the request is done, with a GET request without body and
+// a buffered response.
+func revalidationContext(c vodka.Context) vodka.Context {
+	req := newDetachedRequest(c.Request())
+	req.detach()
+	req.SetMethod(vodka.GET)
+	req.SetBody(http.NoBody)
+	req.contentLength = 0
+	h := req.Header()
+	h.Del(vodka.HeaderContentLength)
+	h.Del(vodka.HeaderContentType)
+	h.Del(vodka.HeaderCacheControl)
+	h.Del(vodka.HeaderIfNoneMatch)
+	h.Del(vodka.HeaderIfModifiedSince)
+
+	rc := newChildContext(c, req, newBufferedResponse(c.Response()))
+	rc.SetStdContext(kontext.Background())
+	return rc
+}
+
+// cacheKey returns the key of the request without the `Vary` headers. HEAD
+// requests are served from the responses to GET.
+func cacheKey(c vodka.Context) string {
+	req := c.Request()
+	return vodka.GET + " " + req.Host() + req.URL().Path() + "?" + url.Values(c.QueryParams()).Encode()
+}
+
+// cacheVaryKey returns the part of the key for the request headers named by
+// vary.
+func cacheVaryKey(c vodka.Context, vary []string) string {
+	buf := new(bytes.Buffer)
+	for _, name := range vary {
+		buf.WriteString("\n" + name + ":" + strings.Join(c.Request().Header().Values(name), ","))
+	}
+	return buf.String()
+}
+
+// cacheVary returns the sorted header names of the `Vary` header.
+func cacheVary(header http.Header) (vary []string) {
+	for _, v := range header[vodka.HeaderVary] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+	for _, name := range vary {
+		if name == "*" {
+			return []string{"*"}
+		}
+	}
+	return
+}
+
+func cacheEntrySize(key string, e *CacheEntry) int64 {
+	size := len(key) + len(e.Body)
+	for k, v := range e.Header {
+		size += len(k)
+		for _, v := range v {
+			size += len(v)
+		}
+	}
+	return int64(size)
+}
+
+// parseCacheControl parses the directives of a `Cache-Control` header.
+func parseCacheControl(header string) cacheControl {
+	cc := make(cacheControl)
+	for _, d := range strings.Split(header, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		name, value := d, ""
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			name, value = d[:i], strings.Trim(d[i+1:], `"`)
+		}
+		cc[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a directive in seconds, e.g. max-age.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
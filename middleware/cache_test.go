@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/insionng/vodka/vodkatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	e := vodka.New()
+	store := NewCacheMemoryStore()
+	calls := int32(0)
+	h := Cache(store)(func(c vodka.Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		c.Response().Header().Set(vodka.HeaderXRequestID, fmt.Sprint(n))
+		switch c.QueryParam("case") {
+		case "no-store":
+			c.Response().Header().Set(vodka.HeaderCacheControl, "no-store")
+		case "vary":
+			c.Response().Header().Set(vodka.HeaderVary, vodka.HeaderAcceptEncoding)
+		case "cookie":
+			c.Response().Header().Set(vodka.HeaderSetCookie, "session=jon")
+		case "set-cookie":
+			cookie := new(vodka.Cookie)
+			cookie.SetName("session")
+			cookie.SetValue("jon")
+			c.SetCookie(cookie)
+		case "tags":
+			CacheTags(c, "user:42")
+		case "etag":
+			c.Response().Header().Set(vodka.HeaderETag, `"v1"`)
+			c.Response().Header().Set(vodka.HeaderLastModified, "Mon, 02 Jan 2006 15:04:05 GMT")
+		case "error":
+			return c.String(http.StatusInternalServerError, "error")
+		}
+		return c.String(http.StatusOK, fmt.Sprint(n))
+	})
+	request := func(method, uri string, header ...string) *test.ResponseRecorder {
+		req := test.NewRequest(method, uri, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header().Set(header[i], header[i+1])
+		}
+		rec := test.NewResponseRecorder()
+		c := e.NewContext(req, rec)
+		assert.NoError(t, h(c))
+		return rec
+	}
+
+	// Miss and hit
+	rec := request(vodka.GET, "/?a=1&b=2")
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "1", rec.Body.String())
+	rec = request(vodka.GET, "/?b=2&a=1")
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "0", rec.Header().Get("Age"))
+	assert.Equal(t, "1", rec.Body.String())
+	assert.Equal(t, vodka.MIMETextPlainCharsetUTF8, rec.Header().Get(vodka.HeaderContentType))
+	assert.Empty(t, rec.Header().Get(vodka.HeaderXRequestID))
+	rec = request(vodka.HEAD, "/?a=1&b=2")
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.Empty(t, rec.Body.String())
+
+	// Client `Cache-Control`
+	rec = request(vodka.GET, "/?a=1&b=2", vodka.HeaderCacheControl, "no-cache")
+	assert.Equal(t, "2", rec.Body.String())
+	rec = request(vodka.GET, "/?a=1&b=2", vodka.HeaderCacheControl, "no-store")
+	assert.Equal(t, "3", rec.Body.String())
+	rec = request(vodka.GET, "/?a=1&b=2")
+	assert.Equal(t, "2", rec.Body.String())
+
+	// Not cached
+	for _, c := range []string{"no-store", "cookie", "set-cookie", "error"} {
+		request(vodka.GET, "/?case="+c)
+		rec = request(vodka.GET, "/?case="+c)
+		assert.Equal(t, "MISS", rec.Header().Get(HeaderXCache), c)
+	}
+	request(vodka.POST, "/")
+	rec = request(vodka.GET, "/", vodka.HeaderAuthorization, "Basic")
+	assert.Empty(t, rec.Header().Get(HeaderXCache))
+
+	// Vary
+	request(vodka.GET, "/?case=vary", vodka.HeaderAcceptEncoding, "gzip")
+	rec = request(vodka.GET, "/?case=vary", vodka.HeaderAcceptEncoding, "gzip")
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	rec = request(vodka.GET, "/?case=vary")
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderXCache))
+
+	// Conditional
+	request(vodka.GET, "/?case=etag")
+	rec = request(vodka.GET, "/?case=etag", vodka.HeaderIfNoneMatch, `"v1"`)
+	assert.Equal(t, http.StatusNotModified, rec.Status())
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, `"v1"`, rec.Header().Get(vodka.HeaderETag))
+	assert.Empty(t, rec.Header().Get(vodka.HeaderContentType))
+	assert.Empty(t, rec.Body.String())
+	rec = request(vodka.HEAD, "/?case=etag", vodka.HeaderIfModifiedSince, "Mon, 02 Jan 2006 15:04:05 GMT")
+	assert.Equal(t, http.StatusNotModified, rec.Status())
+	rec = request(vodka.GET, "/?case=etag", vodka.HeaderIfNoneMatch, `"v2"`)
+	assert.Equal(t, http.StatusOK, rec.Status())
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.NotEmpty(t, rec.Body.String())
+
+	// Purge
+	request(vodka.GET, "/?case=tags")
+	rec = request(vodka.GET, "/?case=tags")
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	store.Purge("user:42")
+	rec = request(vodka.GET, "/?case=tags")
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderXCache))
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	e := vodka.New()
+	calls := int32(0)
+	h := CacheWithConfig(CacheConfig{
+		TTL:                  time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+	})(func(c vodka.Context) error {
+		return c.String(http.StatusOK, fmt.Sprint(atomic.AddInt32(&calls, 1)))
+	})
+	request := func() *test.ResponseRecorder {
+		rec := test.NewResponseRecorder()
+		h(e.NewContext(test.NewRequest(vodka.GET, "/", nil), rec))
+		return rec
+	}
+
+	request()
+	time.Sleep(5 * time.Millisecond)
+	rec := request()
+	assert.Equal(t, "STALE", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "1", rec.Body.String())
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	for i := 0; i < 100; i++ {
+		if rec = request(); rec.Body.String() == "2" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "2", rec.Body.String())
+}
+
+func TestCacheRevalidateVariants(t *testing.T) {
+	e := vodka.New()
+	calls := int32(0)
+	block := make(chan struct{})
+	h := CacheWithConfig(CacheConfig{
+		TTL:                  time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+	})(func(c vodka.Context) error {
+		if atomic.AddInt32(&calls, 1) > 2 {
+			<-block
+		}
+		c.Response().Header().Set(vodka.HeaderVary, vodka.HeaderAcceptEncoding)
+		return c.String(http.StatusOK, c.Request().Header().Get(vodka.HeaderAcceptEncoding))
+	})
+	request := func(encoding string) *test.ResponseRecorder {
+		req := test.NewRequest(vodka.GET, "/", nil)
+		req.Header().Set(vodka.HeaderAcceptEncoding, encoding)
+		rec := test.NewResponseRecorder()
+		h(e.NewContext(req, rec))
+		return rec
+	}
+
+	request("gzip")
+	request("deflate")
+	time.Sleep(5 * time.Millisecond)
+	defer close(block)
+	rec := request("gzip")
+	assert.Equal(t, "STALE", rec.Header().Get(HeaderXCache))
+	rec = request("deflate")
+	assert.Equal(t, "STALE", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "deflate", rec.Body.String())
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 4; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestCacheEngines(t *testing.T) {
+	e := vodka.New()
+	e.Use(Cache(NewCacheMemoryStore()))
+	calls := int32(0)
+	e.GET("/", func(c vodka.Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		c.Response().Header().Set(vodka.HeaderXRequestID, fmt.Sprint(n))
+		if c.QueryParam("cookie") != "" {
+			cookie := new(vodka.Cookie)
+			cookie.SetName("session")
+			cookie.SetValue("jon")
+			c.SetCookie(cookie)
+		}
+		return c.String(http.StatusOK, "test")
+	})
+	vodkatest.Run(t, e, func(t *testing.T, vt *vodkatest.Client) {
+		uri := "/?engine=" + t.Name()
+		vt.GET(uri).Expect().Status(http.StatusOK).Header(HeaderXCache, "MISS")
+		res := vt.GET(uri).Expect().Status(http.StatusOK).Header(HeaderXCache, "HIT").Body("test")
+		assert.Empty(t, res.Raw().Header.Get(vodka.HeaderXRequestID))
+
+		uri += "&cookie=1"
+		vt.GET(uri).Expect().Header(HeaderXCache, "MISS")
+		vt.GET(uri).Expect().Header(HeaderXCache, "MISS").Cookie("session", "jon")
+	})
+}
+
+func TestCacheMemoryStore(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewCacheMemoryStoreWithConfig(CacheMemoryStoreConfig{MaxSize: 10, MaxEntries: 2})
+	store.timeNow = func() time.Time { return now }
+	entry := func(body string, tags ...string) *CacheEntry {
+		return &CacheEntry{Status: http.StatusOK, Body: []byte(body), Tags: tags, StaleUntil: now.Add(time.Minute)}
+	}
+
+	// LRU
+	store.Set("a", entry("1"))
+	store.Set("b", entry("2"))
+	store.Get("a")
+	store.Set("c", entry("3"))
+	assert.NotNil(t, store.Get("a"))
+	assert.Nil(t, store.Get("b"))
+	assert.Equal(t, 2, store.Len())
+
+	// Size
+	store.Set("d", entry("12345678"))
+	assert.Equal(t, 1, store.Len())
+	store.Set("e", entry("12345678901"))
+	assert.Nil(t, store.Get("e"))
+
+	// Tags
+	store.Set("f", entry("1", "user:42"))
+	store.Purge("user:42")
+	assert.Nil(t, store.Get("f"))
+	assert.Empty(t, store.tags)
+
+	// Expiry
+	store.Set("g", entry("1"))
+	now = now.Add(time.Minute)
+	assert.Nil(t, store.Get("g"))
+}
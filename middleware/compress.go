@@ -1,10 +1,17 @@
 package middleware
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"io"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -97,6 +104,10 @@ func (g gzipResponseWriter) Write(b []byte) (int, error) {
 	return g.Writer.Write(b)
 }
 
+func (g gzipResponseWriter) Flush() error {
+	return g.Writer.(*gzip.Writer).Flush()
+}
+
 func gzipPool(config GzipConfig) sync.Pool {
 	return sync.Pool{
 		New: func() interface{} {
@@ -105,3 +116,419 @@ func gzipPool(config GzipConfig) sync.Pool {
 		},
 	}
 }
+
+type (
+	// CompressConfig defines the config for Compress middleware.
+	CompressConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Level is the compression level passed to the encoders.
+		// Optional. Default value -1 (default level of each encoder).
+		Level int `json:"level"`
+
+		// MinLength is the minimum length of a response body to be compressed.
+		// Streamed responses, flushed before reaching it, are compressed anyway.
+		// Optional. Default value 1024.
+		MinLength int `json:"min_length"`
+
+		// Encodings lists the supported content codings in order of preference,
+		// used when the client accepts several with the same q-value. Codings
+		// without an encoder are ignored.
+		// Optional. Default value ["gzip", "deflate"].
+		Encodings []string `json:"encodings"`
+
+		// Encoders adds encoders for content codings, e.g. "br" or "zstd", or
+		// replaces the built-in "gzip" and "deflate" ones. Added codings must be
+		// listed in `Encodings` too.
+		// Optional. Default value nil.
+		Encoders map[string]CompressEncoder
+
+		// AllowTypes lists the media types which are compressed. Entries ending
+		// with "/" match a top-level type, entries starting with "+" a suffix.
+		// Optional. Default value `DefaultCompressConfig.AllowTypes`.
+		AllowTypes []string `json:"allow_types"`
+
+		// DenyTypes lists the media types which aren't compressed, even if
+		// allowed. Same syntax as `AllowTypes`.
+		// Optional. Default value nil.
+		DenyTypes []string `json:"deny_types"`
+	}
+
+	// CompressEncoder returns an encoder writing to w with the compression
+	// level.
+	CompressEncoder func(w io.Writer, level int) (CompressWriter, error)
+
+	// CompressWriter is an encoder of a content coding. Encoders are pooled and
+	// reused with `Reset()`.
+	CompressWriter interface {
+		io.WriteCloser
+		Flush() error
+		Reset(io.Writer)
+	}
+
+	// compressResponse wraps `engine.Response`. It holds the response header
+	// back until the body is long enough, or flushed, to decide whether to
+	// compress it.
+	compressResponse struct {
+		engine.Response
+		config    *CompressConfig
+		encoding  string
+		pool      *sync.Pool
+		encoder   CompressWriter
+		writer    io.Writer
+		buffer    bytes.Buffer
+		status    int
+		size      int64
+		committed bool
+		decided   bool
+		hijacked  bool
+	}
+
+	// compressWriter is the writer of `compressResponse`.
+	compressWriter struct {
+		response *compressResponse
+	}
+)
+
+var (
+	// DefaultCompressConfig is the default Compress middleware config.
+	DefaultCompressConfig = CompressConfig{
+		Skipper:   defaultSkipper,
+		Level:     -1,
+		MinLength: 1024,
+		Encodings: []string{"gzip", "deflate"},
+		AllowTypes: []string{
+			"text/",
+			"application/json",
+			"application/javascript",
+			"application/x-javascript",
+			"application/xml",
+			"application/wasm",
+			"application/x-www-form-urlencoded",
+			"image/svg+xml",
+			"font/",
+			"+json",
+			"+xml",
+		},
+	}
+
+	builtinCompressEncoders = map[string]CompressEncoder{
+		"gzip": func(w io.Writer, level int) (CompressWriter, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer, level int) (CompressWriter, error) {
+			return zlib.NewWriterLevel(w, level)
+		},
+	}
+)
+
+// Compress returns a middleware which compresses HTTP responses.
+//
+// Compress middleware negotiates the content coding with the `Accept-Encoding`
+// request header by q-value. It compresses the responses of the allowed media
+// types whose body is at least `MinLength` long, unless they already have a
+// `Content-Encoding`, and sets `Vary: Accept-Encoding`. gzip and deflate are
+// built in, encoders for other codings, e.g. br or zstd, are registered with
+// `CompressConfig#Encoders` and listed in `CompressConfig#Encodings`:
+//
+//	e.Use(middleware.CompressWithConfig(middleware.CompressConfig{
+//		Encodings: []string{"br", "gzip", "deflate"},
+//		Encoders: map[string]middleware.CompressEncoder{
+//			"br": func(w io.Writer, level int) (middleware.CompressWriter, error) {
+//				return brotli.NewWriterLevel(w, level), nil
+//			},
+//		},
+//	}))
+//
+// Flushing, e.g. with `vodka.Context#Stream()`, flushes the encoder.
+func Compress() vodka.MiddlewareFunc {
+	return CompressWithConfig(DefaultCompressConfig)
+}
+
+// CompressWithConfig returns a Compress middleware with config.
+// See: `Compress()`.
+func CompressWithConfig(config CompressConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultCompressConfig.Skipper
+	}
+	if config.Level == 0 {
+		config.Level = DefaultCompressConfig.Level
+	}
+	if config.MinLength == 0 {
+		config.MinLength = DefaultCompressConfig.MinLength
+	}
+	if len(config.Encodings) == 0 {
+		config.Encodings = DefaultCompressConfig.Encodings
+	}
+	if config.AllowTypes == nil {
+		config.AllowTypes = DefaultCompressConfig.AllowTypes
+	}
+
+	// Encoder pools for the level
+	pools := make(map[string]*sync.Pool)
+	var encodings []string
+	for _, name := range config.Encodings {
+		name = strings.ToLower(name)
+		encoder, ok := config.Encoders[name]
+		if !ok {
+			if encoder, ok = builtinCompressEncoders[name]; !ok {
+				continue
+			}
+		}
+		if _, err := encoder(ioutil.Discard, config.Level); err != nil {
+			panic("vodka: invalid compression level for " + name + ": " + err.Error())
+		}
+		encodings = append(encodings, name)
+		pools[name] = compressPool(encoder, config.Level)
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			res := c.Response()
+			if c.Request().Method() == vodka.HEAD {
+				// Nothing to compress, the response varies like the one to GET
+				res.Before(func() {
+					if res.Header().Get(vodka.HeaderContentEncoding) == "" {
+						res.Header().Add(vodka.HeaderVary, vodka.HeaderAcceptEncoding)
+					}
+				})
+				return next(c)
+			}
+			encoding := negotiateEncoding(c.Request().Header().Get(vodka.HeaderAcceptEncoding), encodings)
+			if encoding == "" {
+				res.Header().Add(vodka.HeaderVary, vodka.HeaderAcceptEncoding)
+				return next(c)
+			}
+
+			cr := &compressResponse{
+				Response: res,
+				config:   &config,
+				encoding: encoding,
+				pool:     pools[encoding],
+				status:   http.StatusOK,
+			}
+			cr.writer = &compressWriter{response: cr}
+			cc := newChildContext(c, c.Request(), cr)
+			defer c.Vodka().ReleaseContext(cc)
+			err = next(cc)
+			c.SetStdContext(cc.StdContext())
+			c.SetStore(cc.GetStore())
+			cr.close()
+			return
+		}
+	}
+}
+
+// negotiateEncoding returns the content coding accepted by the header with the
+// highest q-value, the first of encodings in case of a tie.
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	accepted := make(map[string]float64)
+	for _, e := range strings.Split(header, ",") {
+		parts := strings.Split(e, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if name != "" {
+			accepted[name] = q
+		}
+	}
+	type candidate struct {
+		name string
+		q    float64
+	}
+	var candidates []candidate
+	for _, name := range encodings {
+		q, ok := accepted[name]
+		if !ok {
+			if name == "gzip" {
+				q, ok = accepted["x-gzip"]
+			}
+			if !ok {
+				q, ok = accepted["*"]
+			}
+		}
+		if ok && q > 0 {
+			candidates = append(candidates, candidate{name, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].name
+}
+
+func (r *compressResponse) WriteHeader(code int) {
+	if r.committed {
+		return
+	}
+	r.status = code
+	r.committed = true
+}
+
+func (r *compressResponse) Write(b []byte) (int, error) {
+	if !r.committed {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.writer.Write(b)
+}
+
+func (r *compressResponse) Status() int {
+	return r.status
+}
+
+func (r *compressResponse) Size() int64 {
+	return r.size
+}
+
+func (r *compressResponse) Committed() bool {
+	return r.committed
+}
+
+func (r *compressResponse) Writer() io.Writer {
+	return r.writer
+}
+
+func (r *compressResponse) SetWriter(w io.Writer) {
+	r.writer = w
+}
+
+// Flush decides whether to compress the response, if not done yet, and flushes
+// the encoder and the response.
+func (r *compressResponse) Flush() {
+	if !r.committed {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.decide(true)
+	if r.encoder != nil {
+		r.encoder.Flush()
+	}
+	r.Response.Flush()
+}
+
+func (r *compressResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := r.Response.Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// decide commits the response header, compressed if the body is long enough
+// or streamed, and writes the buffered body.
+func (r *compressResponse) decide(streamed bool) {
+	if r.decided || r.hijacked {
+		return
+	}
+	r.decided = true
+	h := r.Response.Header()
+	if r.compressible(streamed) {
+		h.Set(vodka.HeaderContentEncoding, r.encoding)
+		h.Del(vodka.HeaderContentLength)
+		r.encoder = r.pool.Get().(CompressWriter)
+		r.encoder.Reset(r.Response.Writer())
+	}
+	if h.Get(vodka.HeaderContentEncoding) == "" || r.encoder != nil {
+		h.Add(vodka.HeaderVary, vodka.HeaderAcceptEncoding)
+	}
+	r.Response.WriteHeader(r.status)
+	if r.buffer.Len() > 0 {
+		r.write(r.buffer.Bytes())
+		r.buffer.Reset()
+	}
+}
+
+// compressible reports whether the response is to be compressed.
+func (r *compressResponse) compressible(streamed bool) bool {
+	h := r.Response.Header()
+	switch {
+	case r.status < http.StatusOK, r.status == http.StatusNoContent, r.status == http.StatusNotModified:
+		return false
+	case h.Get(vodka.HeaderContentEncoding) != "", h.Get("Content-Range") != "":
+		return false
+	case !streamed && r.buffer.Len() < r.config.MinLength:
+		return false
+	}
+	ctype := h.Get(vodka.HeaderContentType)
+	if ctype == "" {
+		ctype = http.DetectContentType(r.buffer.Bytes())
+		h.Set(vodka.HeaderContentType, ctype)
+	}
+	t, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	return matchMediaType(t, r.config.AllowTypes) && !matchMediaType(t, r.config.DenyTypes)
+}
+
+func (r *compressResponse) write(b []byte) (int, error) {
+	if r.encoder != nil {
+		return r.encoder.Write(b)
+	}
+	return r.Response.Writer().Write(b)
+}
+
+// close sends the rest of the response and returns the encoder to the pool.
+func (r *compressResponse) close() {
+	if r.committed {
+		r.decide(false)
+	}
+	if r.encoder != nil {
+		r.encoder.Close()
+		r.encoder.Reset(ioutil.Discard)
+		r.pool.Put(r.encoder)
+		r.encoder = nil
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	r := w.response
+	r.size += int64(len(b))
+	if r.decided {
+		return r.write(b)
+	}
+	r.buffer.Write(b)
+	if r.buffer.Len() >= r.config.MinLength {
+		r.decide(false)
+	}
+	return len(b), nil
+}
+
+// matchMediaType reports whether the media type t matches one of types.
+func matchMediaType(t string, types []string) bool {
+	for _, m := range types {
+		switch {
+		case strings.HasSuffix(m, "/") && strings.HasPrefix(t, m),
+			strings.HasPrefix(m, "+") && strings.HasSuffix(t, m),
+			t == m:
+			return true
+		}
+	}
+	return false
+}
+
+func compressPool(encoder CompressEncoder, level int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			w, _ := encoder(ioutil.Discard, level)
+			return w
+		},
+	}
+}
@@ -3,11 +3,17 @@ package middleware
 import (
 	"bytes"
 	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/insionng/vodka"
 	"github.com/insionng/vodka/test"
+	"github.com/insionng/vodka/vodkatest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -70,3 +76,215 @@ func TestGzipErrorReturned(t *testing.T) {
 	assert.Empty(t, rec.Header().Get(vodka.HeaderContentEncoding))
 	assert.Equal(t, "error", rec.Body.String())
 }
+
+func TestCompress(t *testing.T) {
+	e := vodka.New()
+	long := strings.Repeat("vodka ", 200)
+	h := Compress()(func(c vodka.Context) error {
+		switch c.QueryParam("case") {
+		case "short":
+			return c.String(http.StatusOK, "test")
+		case "image":
+			return c.Blob(http.StatusOK, "image/png", []byte(long))
+		case "encoded":
+			c.Response().Header().Set(vodka.HeaderContentEncoding, "gzip")
+		case "sniff":
+			c.Response().Write([]byte("<html>" + long))
+			return nil
+		}
+		return c.String(http.StatusOK, long)
+	})
+	request := func(uri, encoding string) *test.ResponseRecorder {
+		req := test.NewRequest(vodka.GET, uri, nil)
+		req.Header().Set(vodka.HeaderAcceptEncoding, encoding)
+		rec := test.NewResponseRecorder()
+		assert.NoError(t, h(e.NewContext(req, rec)))
+		return rec
+	}
+	decode := func(rec *test.ResponseRecorder) string {
+		var r io.Reader
+		var err error
+		switch rec.Header().Get(vodka.HeaderContentEncoding) {
+		case "gzip":
+			r, err = gzip.NewReader(rec.Body)
+		case "deflate":
+			r, err = zlib.NewReader(rec.Body)
+		default:
+			r = rec.Body
+		}
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		b, _ := ioutil.ReadAll(r)
+		return string(b)
+	}
+
+	// Negotiation
+	for encoding, expected := range map[string]string{
+		"gzip":                    "gzip",
+		"deflate, gzip":           "gzip",
+		"gzip;q=0.5, deflate":     "deflate",
+		"br, deflate;q=0.1":       "deflate",
+		"br, zstd":                "",
+		"*":                       "gzip",
+		"*, gzip;q=0":             "deflate",
+		"identity":                "",
+		"gzip;q=0, deflate;q=0.0": "",
+	} {
+		rec := request("/", encoding)
+		assert.Equal(t, expected, rec.Header().Get(vodka.HeaderContentEncoding), encoding)
+		assert.Equal(t, vodka.HeaderAcceptEncoding, rec.Header().Get(vodka.HeaderVary), encoding)
+		assert.Equal(t, long, decode(rec), encoding)
+	}
+
+	// Not compressed
+	for _, c := range []string{"short", "image"} {
+		rec := request("/?case="+c, "gzip")
+		assert.Empty(t, rec.Header().Get(vodka.HeaderContentEncoding), c)
+		assert.Equal(t, vodka.HeaderAcceptEncoding, rec.Header().Get(vodka.HeaderVary), c)
+	}
+	rec := request("/?case=encoded", "deflate")
+	assert.Equal(t, "gzip", rec.Header().Get(vodka.HeaderContentEncoding))
+	assert.Equal(t, long, rec.Body.String())
+
+	// Content type sniffing
+	rec = request("/?case=sniff", "gzip")
+	assert.Equal(t, "gzip", rec.Header().Get(vodka.HeaderContentEncoding))
+	assert.Contains(t, rec.Header().Get(vodka.HeaderContentType), vodka.MIMETextHTML)
+	assert.Equal(t, "<html>"+long, decode(rec))
+
+	// HEAD varies like GET
+	req := test.NewRequest(vodka.HEAD, "/", nil)
+	req.Header().Set(vodka.HeaderAcceptEncoding, "gzip")
+	rec = test.NewResponseRecorder()
+	assert.NoError(t, h(e.NewContext(req, rec)))
+	assert.Empty(t, rec.Header().Get(vodka.HeaderContentEncoding))
+	assert.Equal(t, vodka.HeaderAcceptEncoding, rec.Header().Get(vodka.HeaderVary))
+}
+
+func TestCompressWithConfig(t *testing.T) {
+	e := vodka.New()
+	var level int
+	h := CompressWithConfig(CompressConfig{
+		Level:     9,
+		MinLength: 1,
+		DenyTypes: []string{"text/csv"},
+		Encodings: []string{"br", "gzip", "deflate"},
+		Encoders: map[string]CompressEncoder{
+			"br": func(w io.Writer, l int) (CompressWriter, error) {
+				level = l
+				return zlib.NewWriterLevel(w, l)
+			},
+		},
+	})(func(c vodka.Context) error {
+		if c.QueryParam("case") == "csv" {
+			return c.Blob(http.StatusOK, "text/csv", []byte("a,b"))
+		}
+		return c.String(http.StatusOK, "test")
+	})
+	request := func(uri string) *test.ResponseRecorder {
+		req := test.NewRequest(vodka.GET, uri, nil)
+		req.Header().Set(vodka.HeaderAcceptEncoding, "gzip, deflate, br")
+		rec := test.NewResponseRecorder()
+		assert.NoError(t, h(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := request("/")
+	assert.Equal(t, "br", rec.Header().Get(vodka.HeaderContentEncoding))
+	assert.Equal(t, 9, level)
+	r, err := zlib.NewReader(rec.Body)
+	if assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "test", string(b))
+	}
+	rec = request("/?case=csv")
+	assert.Empty(t, rec.Header().Get(vodka.HeaderContentEncoding))
+	assert.Equal(t, "a,b", rec.Body.String())
+
+	assert.Panics(t, func() {
+		CompressWithConfig(CompressConfig{Level: 42})
+	})
+}
+
+func TestCompressStream(t *testing.T) {
+	e := vodka.New()
+	req := test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(vodka.HeaderAcceptEncoding, "gzip")
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(req, rec)
+	h := Compress()(func(c vodka.Context) error {
+		c.Response().Header().Set(vodka.HeaderContentType, vodka.MIMETextPlain)
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Write([]byte("first"))
+		c.Response().Flush()
+
+		// The flushed chunk can be decoded before the response is done
+		r, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+		if assert.NoError(t, err) {
+			b := make([]byte, 5)
+			_, err = io.ReadFull(r, b)
+			assert.NoError(t, err)
+			assert.Equal(t, "first", string(b))
+		}
+		c.Response().Write([]byte("second"))
+		return nil
+	})
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, "gzip", rec.Header().Get(vodka.HeaderContentEncoding))
+		r, err := gzip.NewReader(rec.Body)
+		if assert.NoError(t, err) {
+			b, _ := ioutil.ReadAll(r)
+			assert.Equal(t, "firstsecond", string(b))
+		}
+	}
+}
+
+func TestCompressErrorReturned(t *testing.T) {
+	e := vodka.New()
+	e.Use(Compress())
+	e.GET("/", func(c vodka.Context) error {
+		return vodka.NewHTTPError(http.StatusInternalServerError, "error")
+	})
+	req := test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(vodka.HeaderAcceptEncoding, "gzip")
+	rec := test.NewResponseRecorder()
+	e.ServeHTTP(req, rec)
+	assert.Equal(t, http.StatusInternalServerError, rec.Status())
+	assert.Empty(t, rec.Header().Get(vodka.HeaderContentEncoding))
+	assert.Equal(t, "error", rec.Body.String())
+}
+
+func TestCompressEngines(t *testing.T) {
+	e := vodka.New()
+	e.Use(Compress())
+	long := strings.Repeat("vodka ", 200)
+	e.GET("/", func(c vodka.Context) error {
+		return c.String(http.StatusOK, long)
+	})
+	e.GET("/stream", func(c vodka.Context) error {
+		c.Response().Header().Set(vodka.HeaderContentType, vodka.MIMETextPlain)
+		c.Response().WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			c.Response().Write([]byte("vodka"))
+			c.Response().Flush()
+		}
+		return nil
+	})
+	vodkatest.Run(t, e, func(t *testing.T, vt *vodkatest.Client) {
+		for path, expected := range map[string]string{"/": long, "/stream": "vodkavodkavodka"} {
+			res := vt.GET(path).WithHeader(vodka.HeaderAcceptEncoding, "gzip").Expect().
+				Status(http.StatusOK).
+				Header(vodka.HeaderContentEncoding, "gzip").
+				Header(vodka.HeaderVary, vodka.HeaderAcceptEncoding)
+			if l := res.Raw().Header.Get(vodka.HeaderContentLength); l != "" {
+				assert.Equal(t, strconv.Itoa(len(res.Bytes())), l)
+			}
+			r, err := gzip.NewReader(bytes.NewReader(res.Bytes()))
+			if assert.NoError(t, err) {
+				b, _ := ioutil.ReadAll(r)
+				assert.Equal(t, expected, string(b))
+			}
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// ConcurrencyLimitConfig defines the config for ConcurrencyLimit middleware.
+	ConcurrencyLimitConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Limit is the maximum number of requests served at once.
+		// Required, unless limits are set per route.
+		Limit int `json:"limit"`
+
+		// Routes limits the requests served at once per route, on top of
+		// `Limit`. Keys are registered route paths, optionally prefixed with the
+		// method, e.g. "/reports" or "GET /reports".
+		// Optional. Default value nil.
+		Routes map[string]int
+
+		// QueueSize is the maximum number of requests waiting for the limit,
+		// globally and per route. Others are rejected right away.
+		// Optional. Default value 0.
+		QueueSize int `json:"queue_size"`
+
+		// QueueTimeout is the maximum time a request waits in the queue.
+		// Optional. Default value 1s.
+		QueueTimeout time.Duration `json:"queue_timeout"`
+
+		// RetryAfter is sent in the `Retry-After` header of rejected requests.
+		// Optional. Default value 1s.
+		RetryAfter time.Duration `json:"retry_after"`
+
+		// Adaptive adjusts the limits from the latency of the requests, between
+		// `MinLimit` and the configured limits: they're increased by one for
+		// each window of requests faster than `LatencyTarget`, and decreased by
+		// 10% for a slower request (AIMD). The requests in flight at a decrease
+		// don't decrease the limits again, so that it happens at most once per
+		// window.
+		// Optional. Default value false.
+		Adaptive bool `json:"adaptive"`
+
+		// LatencyTarget is the latency of the requests the adaptive limits aim
+		// for.
+		// Required with `Adaptive`.
+		LatencyTarget time.Duration `json:"latency_target"`
+
+		// MinLimit is the minimum of the adaptive limits.
+		// Optional. Default value 1.
+		MinLimit int `json:"min_limit"`
+
+		// Priority returns the priority class of the request.
+		// Optional. Default value returns `ConcurrencyPriorityNormal`.
+		Priority func(vodka.Context) ConcurrencyPriority
+
+		// DenyHandler is called when a request is rejected.
+		// Optional. Default value returns `vodka.ErrServiceUnavailable`.
+		DenyHandler vodka.HandlerFunc
+	}
+
+	// ConcurrencyPriority is the priority class of a request, see
+	// `ConcurrencyLimitConfig#Priority`.
+	ConcurrencyPriority int
+
+	concurrencyLimiter struct {
+		mutex    sync.Mutex
+		limit    float64
+		max      float64
+		min      float64
+		target   time.Duration
+		inFlight int
+		// skip is the number of requests in flight at the last decrease, which
+		// don't decrease the limit again.
+		skip  int
+		queue []chan struct{}
+		size  int
+	}
+)
+
+// Priority classes
+const (
+	// ConcurrencyPriorityNormal requests wait in the queue when the limit is
+	// reached.
+	ConcurrencyPriorityNormal ConcurrencyPriority = iota
+
+	// ConcurrencyPriorityLow requests are rejected rather than queued.
+	ConcurrencyPriorityLow
+
+	// ConcurrencyPriorityCritical requests bypass the limits, e.g. health
+	// checks or admin routes.
+	ConcurrencyPriorityCritical
+)
+
+var (
+	// DefaultConcurrencyLimitConfig is the default ConcurrencyLimit middleware
+	// config.
+	DefaultConcurrencyLimitConfig = ConcurrencyLimitConfig{
+		Skipper:      defaultSkipper,
+		QueueTimeout: time.Second,
+		RetryAfter:   time.Second,
+		MinLimit:     1,
+		Priority: func(vodka.Context) ConcurrencyPriority {
+			return ConcurrencyPriorityNormal
+		},
+		DenyHandler: func(c vodka.Context) error {
+			return vodka.ErrServiceUnavailable
+		},
+	}
+
+	errConcurrencyLimit = errors.New("concurrency limit reached")
+)
+
+// ConcurrencyLimit returns a ConcurrencyLimit middleware serving at most limit
+// requests at once.
+//
+// ConcurrencyLimit middleware sheds load: requests over the limit wait in a
+// bounded queue, up to a timeout, and are rejected with "503 - Service
+// Unavailable" and a `Retry-After` header once it's full or the timeout
+// expires. See `ConcurrencyLimitConfig` for per route and adaptive limits and
+// priority classes.
+func ConcurrencyLimit(limit int) vodka.MiddlewareFunc {
+	c := DefaultConcurrencyLimitConfig
+	c.Limit = limit
+	return ConcurrencyLimitWithConfig(c)
+}
+
+// ConcurrencyLimitWithConfig returns a ConcurrencyLimit middleware with config.
+// See: `ConcurrencyLimit()`.
+func ConcurrencyLimitWithConfig(config ConcurrencyLimitConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultConcurrencyLimitConfig.Skipper
+	}
+	if config.QueueTimeout == 0 {
+		config.QueueTimeout = DefaultConcurrencyLimitConfig.QueueTimeout
+	}
+	if config.RetryAfter == 0 {
+		config.RetryAfter = DefaultConcurrencyLimitConfig.RetryAfter
+	}
+	if config.MinLimit == 0 {
+		config.MinLimit = DefaultConcurrencyLimitConfig.MinLimit
+	}
+	if config.Priority == nil {
+		config.Priority = DefaultConcurrencyLimitConfig.Priority
+	}
+	if config.DenyHandler == nil {
+		config.DenyHandler = DefaultConcurrencyLimitConfig.DenyHandler
+	}
+	if config.Limit <= 0 && len(config.Routes) == 0 {
+		panic("vodka: concurrency limit middleware requires a limit")
+	}
+	if config.Adaptive && config.LatencyTarget <= 0 {
+		panic("vodka: adaptive concurrency limit requires a latency target")
+	}
+
+	var global *concurrencyLimiter
+	if config.Limit > 0 {
+		global = newConcurrencyLimiter(config, config.Limit)
+	}
+	routes := make(map[string]*concurrencyLimiter)
+	for route, limit := range config.Routes {
+		if limit > 0 {
+			routes[route] = newConcurrencyLimiter(config, limit)
+		}
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			priority := config.Priority(c)
+			if priority == ConcurrencyPriorityCritical {
+				return next(c)
+			}
+
+			// The route slot is taken first, not to hold a global one while
+			// waiting for it
+			limiters := make([]*concurrencyLimiter, 0, 2)
+			if l, ok := routes[c.Request().Method()+" "+c.Path()]; ok {
+				limiters = append(limiters, l)
+			} else if l, ok := routes[c.Path()]; ok {
+				limiters = append(limiters, l)
+			}
+			if global != nil {
+				limiters = append(limiters, global)
+			}
+
+			deadline := time.Now().Add(config.QueueTimeout)
+			for i, l := range limiters {
+				if err := l.acquire(c, deadline, priority == ConcurrencyPriorityNormal); err != nil {
+					for _, l := range limiters[:i] {
+						l.release(0)
+					}
+					if err != errConcurrencyLimit {
+						// The request was cancelled by the client or the server
+						return err
+					}
+					c.Response().Header().Set(vodka.HeaderRetryAfter, formatSeconds(config.RetryAfter))
+					return config.DenyHandler(c)
+				}
+			}
+
+			start := time.Now()
+			defer func() {
+				latency := time.Since(start)
+				for _, l := range limiters {
+					l.release(latency)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+func newConcurrencyLimiter(config ConcurrencyLimitConfig, limit int) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		limit: float64(limit),
+		max:   float64(limit),
+		min:   float64(limit),
+		size:  config.QueueSize,
+	}
+	if config.Adaptive {
+		l.target = config.LatencyTarget
+		if m := float64(config.MinLimit); m < l.max {
+			l.min = m
+		}
+	}
+	return l
+}
+
+// acquire takes a slot, waiting in the queue until the deadline if wait and the
+// queue isn't full. It returns `errConcurrencyLimit` if it couldn't.
+func (l *concurrencyLimiter) acquire(c vodka.Context, deadline time.Time, wait bool) error {
+	l.mutex.Lock()
+	if l.inFlight < int(l.limit) && len(l.queue) == 0 {
+		l.inFlight++
+		l.mutex.Unlock()
+		return nil
+	}
+	if !wait || len(l.queue) >= l.size {
+		l.mutex.Unlock()
+		return errConcurrencyLimit
+	}
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = errConcurrencyLimit
+	case <-c.StdContext().Done():
+		err = c.StdContext().Err()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, q := range l.queue {
+		if q == ready {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return err
+		}
+	}
+	// The slot was handed over meanwhile
+	l.inFlight--
+	l.next()
+	return err
+}
+
+// release frees a slot, adjusting the adaptive limit from the latency of the
+// request if not zero, and hands it over to the next request in the queue.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.target > 0 && latency > 0 {
+		slow := latency > l.target
+		if l.skip > 0 {
+			l.skip--
+		} else if slow {
+			l.limit *= 0.9
+			if l.limit < l.min {
+				l.limit = l.min
+			}
+			l.skip = l.inFlight - 1
+		}
+		if !slow {
+			l.limit += 1 / l.limit
+			if l.limit > l.max {
+				l.limit = l.max
+			}
+		}
+	}
+	l.inFlight--
+	l.next()
+}
+
+// next hands the free slots over to the requests in the queue.
+func (l *concurrencyLimiter) next() {
+	for len(l.queue) > 0 && l.inFlight < int(l.limit) {
+		close(l.queue[0])
+		l.queue = l.queue[1:]
+		l.inFlight++
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	e := vodka.New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := ConcurrencyLimitWithConfig(ConcurrencyLimitConfig{
+		Limit:     1,
+		QueueSize: 1,
+		Priority: func(c vodka.Context) ConcurrencyPriority {
+			switch c.QueryParam("priority") {
+			case "low":
+				return ConcurrencyPriorityLow
+			case "critical":
+				return ConcurrencyPriorityCritical
+			}
+			return ConcurrencyPriorityNormal
+		},
+	})(func(c vodka.Context) error {
+		if c.QueryParam("block") != "" {
+			started <- struct{}{}
+			<-release
+		}
+		return c.String(http.StatusOK, "test")
+	})
+	request := func(path, uri string) (*test.ResponseRecorder, error) {
+		req := test.NewRequest(vodka.GET, uri, nil)
+		rec := test.NewResponseRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(path)
+		return rec, h(c)
+	}
+	done := make(chan error, 2)
+	go func() {
+		_, err := request("/", "/?block=1")
+		done <- err
+	}()
+	<-started
+
+	// Queued
+	go func() {
+		_, err := request("/", "/")
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Rejected, the queue is full
+	rec, err := request("/", "/")
+	assert.Equal(t, vodka.ErrServiceUnavailable, err)
+	assert.Equal(t, "1", rec.Header().Get(vodka.HeaderRetryAfter))
+	_, err = request("/", "/?priority=low")
+	assert.Equal(t, vodka.ErrServiceUnavailable, err)
+
+	// Bypassed
+	rec, err = request("/", "/?priority=critical")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test", rec.Body.String())
+	}
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	_, err = request("/", "/")
+	assert.NoError(t, err)
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	e := vodka.New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := ConcurrencyLimitWithConfig(ConcurrencyLimitConfig{
+		Routes:       map[string]int{"/reports": 1},
+		QueueSize:    1,
+		QueueTimeout: 10 * time.Millisecond,
+		RetryAfter:   5 * time.Second,
+	})(func(c vodka.Context) error {
+		if c.QueryParam("block") != "" {
+			started <- struct{}{}
+			<-release
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	request := func(path, uri string) (*test.ResponseRecorder, error) {
+		rec := test.NewResponseRecorder()
+		c := e.NewContext(test.NewRequest(vodka.GET, uri, nil), rec)
+		c.SetPath(path)
+		return rec, h(c)
+	}
+	go request("/reports", "/reports?block=1")
+	<-started
+	defer close(release)
+
+	rec, err := request("/reports", "/reports")
+	assert.Equal(t, vodka.ErrServiceUnavailable, err)
+	assert.Equal(t, "5", rec.Header().Get(vodka.HeaderRetryAfter))
+
+	// Other routes aren't limited
+	_, err = request("/", "/")
+	assert.NoError(t, err)
+
+	assert.Panics(t, func() {
+		ConcurrencyLimit(0)
+	})
+	assert.Panics(t, func() {
+		ConcurrencyLimitWithConfig(ConcurrencyLimitConfig{Limit: 1, Adaptive: true})
+	})
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	l := newConcurrencyLimiter(ConcurrencyLimitConfig{
+		Adaptive:      true,
+		LatencyTarget: 100 * time.Millisecond,
+		MinLimit:      2,
+	}, 10)
+	c := vodka.New().NewContext(test.NewRequest(vodka.GET, "/", nil), test.NewResponseRecorder())
+	deadline := time.Now()
+
+	// Slow requests decrease the limit
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, l.acquire(c, deadline, false))
+		l.release(time.Second)
+	}
+	assert.Equal(t, 2.0, l.limit)
+	assert.NoError(t, l.acquire(c, deadline, false))
+	assert.NoError(t, l.acquire(c, deadline, false))
+	assert.Equal(t, errConcurrencyLimit, l.acquire(c, deadline, false))
+	l.release(0)
+	l.release(0)
+
+	// Fast ones increase it up to the maximum
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, l.acquire(c, deadline, false))
+		l.release(time.Millisecond)
+	}
+	assert.Equal(t, 10.0, l.limit)
+
+	// Concurrent slow requests decrease it once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, l.acquire(c, deadline, false))
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.release(time.Second)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 9.0, l.limit)
+	assert.NoError(t, l.acquire(c, deadline, false))
+	l.release(time.Second)
+	assert.InDelta(t, 8.1, l.limit, 1e-9)
+}
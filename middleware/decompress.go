@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/libraries/gommon/bytes"
+)
+
+type (
+	// DecompressConfig defines the config for Decompress middleware.
+	DecompressConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Maximum allowed size for a decompressed request body, it can be
+		// specified as `4x` or `4xB`, where x is one of the multiple from K, M,
+		// G, T or P.
+		// Optional. Default value "32M".
+		Limit string `json:"limit"`
+		limit int64
+
+		// Decoders adds decoders for content codings, e.g. "br" or "zstd", or
+		// replaces the built-in "gzip" and "deflate" ones.
+		// Optional. Default value nil.
+		Decoders map[string]DecompressDecoder
+	}
+
+	// DecompressDecoder returns a reader decoding r.
+	DecompressDecoder func(r io.Reader) (io.ReadCloser, error)
+
+	decompressedReader struct {
+		reader io.Reader
+		read   int64
+		limit  int64
+	}
+)
+
+var (
+	// DefaultDecompressConfig is the default Decompress middleware config.
+	DefaultDecompressConfig = DecompressConfig{
+		Skipper: defaultSkipper,
+		Limit:   "32M",
+	}
+
+	builtinDecompressDecoders = map[string]DecompressDecoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			// Some clients send raw deflate data instead of the zlib format
+			br := bufio.NewReader(r)
+			if b, err := br.Peek(2); err == nil && b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0 {
+				return zlib.NewReader(br)
+			}
+			return flate.NewReader(br), nil
+		},
+	}
+)
+
+// Decompress returns a Decompress middleware.
+//
+// Decompress middleware decodes request bodies sent with a `Content-Encoding`,
+// e.g. gzip, and removes the header, so that handlers and `vodka.Context#Bind()`
+// read the plain body, whose length is unknown: `Content-Length` is removed too.
+// It sends "415 - Unsupported Media Type" for unsupported content codings and
+// "413 - Request Entity Too Large" if the decompressed body exceeds the limit.
+// Use BodyLimit before Decompress to limit the size of the compressed body, or
+// after it to limit the size of the decompressed one.
+func Decompress() vodka.MiddlewareFunc {
+	return DecompressWithConfig(DefaultDecompressConfig)
+}
+
+// DecompressWithConfig returns a Decompress middleware with config.
+// See: `Decompress()`.
+func DecompressWithConfig(config DecompressConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultDecompressConfig.Skipper
+	}
+	if config.Limit == "" {
+		config.Limit = DefaultDecompressConfig.Limit
+	}
+
+	limit, err := bytes.Parse(config.Limit)
+	if err != nil {
+		panic(fmt.Errorf("invalid decompress limit=%s", config.Limit))
+	}
+	config.limit = limit
+	decoders := make(map[string]DecompressDecoder)
+	for name, d := range builtinDecompressDecoders {
+		decoders[name] = d
+	}
+	for name, d := range config.Decoders {
+		decoders[strings.ToLower(name)] = d
+	}
+	decoders["x-gzip"] = decoders["gzip"]
+	var names []string
+	for name := range decoders {
+		if name != "x-gzip" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	accept := strings.Join(names, ", ")
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			req := c.Request()
+			header := req.Header().Get(vodka.HeaderContentEncoding)
+			if header == "" {
+				return next(c)
+			}
+
+			// Codings are listed in the order they were applied
+			var codings []DecompressDecoder
+			for _, name := range strings.Split(header, ",") {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == "" || name == "identity" {
+					continue
+				}
+				d, ok := decoders[name]
+				if !ok {
+					c.Response().Header().Set(vodka.HeaderAcceptEncoding, accept)
+					return vodka.ErrUnsupportedMediaType
+				}
+				codings = append(codings, d)
+			}
+			req.Header().Del(vodka.HeaderContentEncoding)
+			if len(codings) == 0 || req.Body() == nil || req.ContentLength() == 0 {
+				return next(c)
+			}
+
+			body := req.Body()
+			for i := len(codings) - 1; i >= 0; i-- {
+				r, err := codings[i](body)
+				if err != nil {
+					return vodka.NewHTTPError(http.StatusBadRequest, "invalid "+vodka.HeaderContentEncoding+" body: "+err.Error())
+				}
+				defer r.Close()
+				body = r
+			}
+			req.SetBody(&decompressedReader{reader: body, limit: config.limit})
+			req.SetContentLength(-1)
+			return next(c)
+		}
+	}
+}
+
+func (r *decompressedReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	if r.read+int64(n) > r.limit {
+		// Drop what's beyond the limit, so that the body is never complete
+		n = int(r.limit - r.read)
+		r.read = r.limit
+		return n, vodka.ErrStatusRequestEntityTooLarge
+	}
+	r.read += int64(n)
+	return
+}
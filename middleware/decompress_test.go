@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/insionng/vodka/vodkatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompress(t *testing.T) {
+	e := vodka.New()
+	h := Decompress()(func(c vodka.Context) error {
+		assert.Empty(t, c.Request().Header().Get(vodka.HeaderContentEncoding))
+		body, err := ioutil.ReadAll(c.Request().Body())
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	})
+	request := func(encoding string, body []byte) (*test.ResponseRecorder, error) {
+		req := test.NewRequest(vodka.POST, "/", bytes.NewReader(body))
+		req.Header().Set(vodka.HeaderContentEncoding, encoding)
+		rec := test.NewResponseRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	encode := func(w io.WriteCloser, b *bytes.Buffer) []byte {
+		w.Write([]byte("test"))
+		w.Close()
+		return b.Bytes()
+	}
+
+	b := new(bytes.Buffer)
+	gzipped := encode(gzip.NewWriter(b), b)
+	b = new(bytes.Buffer)
+	zlibbed := encode(zlib.NewWriter(b), b)
+	b = new(bytes.Buffer)
+	fw, _ := flate.NewWriter(b, flate.DefaultCompression)
+	deflated := encode(fw, b)
+	b = new(bytes.Buffer)
+	gw := gzip.NewWriter(b)
+	gw.Write(zlibbed)
+	gw.Close()
+	stacked := b.Bytes()
+
+	for encoding, body := range map[string][]byte{
+		"":               []byte("test"),
+		"identity":       []byte("test"),
+		"gzip":           gzipped,
+		"x-gzip":         gzipped,
+		"deflate":        zlibbed,
+		"Deflate":        deflated,
+		"deflate, gzip":  stacked,
+		"identity, gzip": gzipped,
+	} {
+		rec, err := request(encoding, body)
+		if assert.NoError(t, err, encoding) {
+			assert.Equal(t, "test", rec.Body.String(), encoding)
+		}
+	}
+
+	// Unsupported
+	rec, err := request("br", []byte("test"))
+	assert.Equal(t, vodka.ErrUnsupportedMediaType, err)
+	assert.Equal(t, "deflate, gzip", rec.Header().Get(vodka.HeaderAcceptEncoding))
+
+	// Invalid
+	_, err = request("gzip", []byte("test"))
+	if assert.IsType(t, new(vodka.HTTPError), err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*vodka.HTTPError).Code)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	e := vodka.New()
+	b := new(bytes.Buffer)
+	gw := gzip.NewWriter(b)
+	gw.Write(bytes.Repeat([]byte("a"), 1<<20))
+	gw.Close()
+	bomb := b.Bytes()
+	h := func(c vodka.Context) error {
+		_, err := ioutil.ReadAll(c.Request().Body())
+		return err
+	}
+	request := func(m ...vodka.MiddlewareFunc) error {
+		req := test.NewRequest(vodka.POST, "/", bytes.NewReader(bomb))
+		req.Header().Set(vodka.HeaderContentEncoding, "gzip")
+		handler := h
+		for i := len(m) - 1; i >= 0; i-- {
+			handler = m[i](handler)
+		}
+		return handler(e.NewContext(req, test.NewResponseRecorder()))
+	}
+
+	assert.NoError(t, request(Decompress()))
+	assert.Equal(t, vodka.ErrStatusRequestEntityTooLarge, request(DecompressWithConfig(DecompressConfig{Limit: "512K"})))
+
+	// BodyLimit before limits the compressed body, after the decompressed one
+	assert.NoError(t, request(BodyLimit("64K"), Decompress()))
+	assert.Equal(t, vodka.ErrStatusRequestEntityTooLarge, request(Decompress(), BodyLimit("2M"), BodyLimit("64K")))
+}
+
+func TestDecompressBind(t *testing.T) {
+	e := vodka.New()
+	e.Use(DecompressWithConfig(DecompressConfig{Limit: "1K"}))
+	e.POST("/", func(c vodka.Context) error {
+		var v map[string]interface{}
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, v)
+	})
+	encode := func(s string) io.Reader {
+		b := new(bytes.Buffer)
+		gw := gzip.NewWriter(b)
+		gw.Write([]byte(s))
+		gw.Close()
+		return b
+	}
+	vodkatest.Run(t, e, func(t *testing.T, vt *vodkatest.Client) {
+		vt.POST("/").
+			WithHeader(vodka.HeaderContentType, vodka.MIMEApplicationJSON).
+			WithHeader(vodka.HeaderContentEncoding, "gzip").
+			WithBody(encode(`{"id":1,"name":"Jon Snow"}`)).
+			Expect().Status(http.StatusOK).JSONPath("$.name", "Jon Snow")
+		vt.POST("/").
+			WithHeader(vodka.HeaderContentType, vodka.MIMEApplicationJSON).
+			WithHeader(vodka.HeaderContentEncoding, "gzip").
+			WithBody(encode(`{"name":"` + strings.Repeat("a", 2048) + `"}`)).
+			Expect().Status(http.StatusRequestEntityTooLarge)
+	})
+}
+
+func TestDecompressContentLength(t *testing.T) {
+	e := vodka.New()
+	e.Use(Decompress())
+	e.POST("/", func(c vodka.Context) error {
+		req := c.Request()
+		body, err := ioutil.ReadAll(req.Body())
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"length": req.ContentLength(),
+			"header": req.Header().Get(vodka.HeaderContentLength),
+			"body":   string(body),
+		})
+	})
+	b := new(bytes.Buffer)
+	gw := gzip.NewWriter(b)
+	gw.Write([]byte("test"))
+	gw.Close()
+	vodkatest.Run(t, e, func(t *testing.T, vt *vodkatest.Client) {
+		vt.POST("/").
+			WithHeader(vodka.HeaderContentEncoding, "gzip").
+			WithBody(bytes.NewReader(b.Bytes())).
+			Expect().Status(http.StatusOK).
+			JSONPath("$.length", -1).
+			JSONPath("$.header", "").
+			JSONPath("$.body", "test")
+	})
+}
@@ -0,0 +1,363 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/engine"
+)
+
+type (
+	// detachedRequest is a copy of a request for handlers which run apart from
+	// it, e.g. in another goroutine, as engines reuse requests once they're
+	// done. The body and the form are read from the request until `detach()` is
+	// called, reading them fails afterwards.
+	detachedRequest struct {
+		mutex          sync.Mutex
+		request        engine.Request
+		body           io.Reader
+		isTLS          bool
+		tlsState       *tls.ConnectionState
+		scheme         string
+		host           string
+		uri            string
+		url            *detachedURL
+		header         detachedHeader
+		referer        string
+		proto          string
+		protoMajor     int
+		protoMinor     int
+		contentLength  int64
+		userAgent      string
+		remoteAddress  string
+		localAddress   string
+		connID         uint64
+		connRequestNum uint64
+		realIP         string
+		method         string
+		cookies        []engine.Cookie
+	}
+
+	// detachedBody reads the body of a `detachedRequest` from the request.
+	detachedBody struct {
+		request *detachedRequest
+	}
+
+	// detachedURL implements `engine.URL` for `detachedRequest`.
+	detachedURL struct {
+		path   string
+		query  string
+		params url.Values
+	}
+
+	// detachedHeader implements `engine.Header` for `detachedRequest`.
+	detachedHeader http.Header
+
+	// detachedCookie implements `engine.Cookie` for `detachedRequest`.
+	detachedCookie struct {
+		*http.Cookie
+	}
+)
+
+// newDetachedRequest returns a copy of req.
+func newDetachedRequest(req engine.Request) *detachedRequest {
+	r := &detachedRequest{
+		request:        req,
+		isTLS:          req.IsTLS(),
+		tlsState:       req.TLSState(),
+		scheme:         req.Scheme(),
+		host:           req.Host(),
+		uri:            req.URI(),
+		url:            &detachedURL{path: req.URL().Path(), query: req.URL().QueryString()},
+		header:         make(detachedHeader),
+		referer:        req.Referer(),
+		proto:          req.Proto(),
+		protoMajor:     req.ProtoMajor(),
+		protoMinor:     req.ProtoMinor(),
+		contentLength:  req.ContentLength(),
+		userAgent:      req.UserAgent(),
+		remoteAddress:  req.RemoteAddress(),
+		localAddress:   req.LocalAddress(),
+		connID:         req.ConnID(),
+		connRequestNum: req.ConnRequestNum(),
+		realIP:         req.RealIP(),
+		method:         req.Method(),
+	}
+	r.body = &detachedBody{request: r}
+	h := req.Header()
+	for _, k := range h.Keys() {
+		r.header[http.CanonicalHeaderKey(k)] = append([]string(nil), h.Values(k)...)
+	}
+	for _, c := range (&http.Request{Header: http.Header(r.header)}).Cookies() {
+		r.cookies = append(r.cookies, &detachedCookie{c})
+	}
+	return r
+}
+
+// detach stops reading from the request.
+func (r *detachedRequest) detach() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.request = nil
+}
+
+func (r *detachedRequest) IsTLS() bool {
+	return r.isTLS
+}
+
+func (r *detachedRequest) TLSState() *tls.ConnectionState {
+	return r.tlsState
+}
+
+func (r *detachedRequest) Scheme() string {
+	return r.scheme
+}
+
+func (r *detachedRequest) Host() string {
+	return r.host
+}
+
+func (r *detachedRequest) SetHost(host string) {
+	r.host = host
+}
+
+func (r *detachedRequest) URI() string {
+	return r.uri
+}
+
+func (r *detachedRequest) SetURI(uri string) {
+	r.uri = uri
+}
+
+func (r *detachedRequest) URL() engine.URL {
+	return r.url
+}
+
+func (r *detachedRequest) Header() engine.Header {
+	return r.header
+}
+
+func (r *detachedRequest) Referer() string {
+	return r.referer
+}
+
+func (r *detachedRequest) Proto() string {
+	return r.proto
+}
+
+func (r *detachedRequest) ProtoMajor() int {
+	return r.protoMajor
+}
+
+func (r *detachedRequest) ProtoMinor() int {
+	return r.protoMinor
+}
+
+func (r *detachedRequest) ContentLength() int64 {
+	return r.contentLength
+}
+
+func (r *detachedRequest) SetContentLength(length int64) {
+	r.contentLength = length
+	if length < 0 {
+		r.header.Del(vodka.HeaderContentLength)
+	} else {
+		r.header.Set(vodka.HeaderContentLength, strconv.FormatInt(length, 10))
+	}
+}
+
+func (r *detachedRequest) UserAgent() string {
+	return r.userAgent
+}
+
+func (r *detachedRequest) RemoteAddress() string {
+	return r.remoteAddress
+}
+
+func (r *detachedRequest) LocalAddress() string {
+	return r.localAddress
+}
+
+func (r *detachedRequest) ConnID() uint64 {
+	return r.connID
+}
+
+func (r *detachedRequest) ConnRequestNum() uint64 {
+	return r.connRequestNum
+}
+
+func (r *detachedRequest) RealIP() string {
+	return r.realIP
+}
+
+func (r *detachedRequest) Method() string {
+	return r.method
+}
+
+func (r *detachedRequest) SetMethod(method string) {
+	r.method = method
+}
+
+func (r *detachedRequest) Body() io.Reader {
+	return r.body
+}
+
+func (r *detachedRequest) SetBody(reader io.Reader) {
+	r.body = reader
+}
+
+func (r *detachedRequest) FormValue(name string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.request == nil {
+		return ""
+	}
+	return r.request.FormValue(name)
+}
+
+func (r *detachedRequest) FormParams() map[string][]string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.request == nil {
+		return nil
+	}
+	return r.request.FormParams()
+}
+
+func (r *detachedRequest) FormFile(name string) (*multipart.FileHeader, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.request == nil {
+		return nil, http.ErrBodyReadAfterClose
+	}
+	return r.request.FormFile(name)
+}
+
+func (r *detachedRequest) MultipartForm() (*multipart.Form, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.request == nil {
+		return nil, http.ErrBodyReadAfterClose
+	}
+	return r.request.MultipartForm()
+}
+
+func (r *detachedRequest) Cookie(name string) (engine.Cookie, error) {
+	for _, c := range r.cookies {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, vodka.ErrCookieNotFound
+}
+
+func (r *detachedRequest) Cookies() []engine.Cookie {
+	return r.cookies
+}
+
+// Read reads from the body of the request. A read in progress isn't waited for
+// by `detach()`, it may block on a slow client.
+func (b *detachedBody) Read(p []byte) (int, error) {
+	r := b.request
+	r.mutex.Lock()
+	req := r.request
+	r.mutex.Unlock()
+	if req == nil {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	body := req.Body()
+	if body == nil {
+		return 0, io.EOF
+	}
+	return body.Read(p)
+}
+
+func (u *detachedURL) Path() string {
+	return u.path
+}
+
+func (u *detachedURL) SetPath(path string) {
+	u.path = path
+}
+
+func (u *detachedURL) QueryParam(name string) string {
+	return url.Values(u.QueryParams()).Get(name)
+}
+
+func (u *detachedURL) QueryParams() map[string][]string {
+	if u.params == nil {
+		u.params, _ = url.ParseQuery(u.query)
+	}
+	return u.params
+}
+
+func (u *detachedURL) QueryString() string {
+	return u.query
+}
+
+func (h detachedHeader) Add(key, value string) {
+	http.Header(h).Add(key, value)
+}
+
+func (h detachedHeader) Del(key string) {
+	http.Header(h).Del(key)
+}
+
+func (h detachedHeader) Set(key, value string) {
+	http.Header(h).Set(key, value)
+}
+
+func (h detachedHeader) Get(key string) string {
+	return http.Header(h).Get(key)
+}
+
+func (h detachedHeader) Values(key string) []string {
+	return h[http.CanonicalHeaderKey(key)]
+}
+
+func (h detachedHeader) Keys() (keys []string) {
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func (h detachedHeader) Contains(key string) bool {
+	_, ok := h[http.CanonicalHeaderKey(key)]
+	return ok
+}
+
+func (c *detachedCookie) Name() string {
+	return c.Cookie.Name
+}
+
+func (c *detachedCookie) Value() string {
+	return c.Cookie.Value
+}
+
+func (c *detachedCookie) Path() string {
+	return c.Cookie.Path
+}
+
+func (c *detachedCookie) Domain() string {
+	return c.Cookie.Domain
+}
+
+func (c *detachedCookie) Expires() time.Time {
+	return c.Cookie.Expires
+}
+
+func (c *detachedCookie) Secure() bool {
+	return c.Cookie.Secure
+}
+
+func (c *detachedCookie) HTTPOnly() bool {
+	return c.Cookie.HttpOnly
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// ETagConfig defines the config for ETag middleware.
+	ETagConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Weak generates weak entity tags, from a CRC-32 checksum of the body,
+		// instead of strong ones from its SHA-1 hash.
+		// Optional. Default value false.
+		Weak bool `json:"weak"`
+	}
+)
+
+var (
+	// DefaultETagConfig is the default ETag middleware config.
+	DefaultETagConfig = ETagConfig{
+		Skipper: defaultSkipper,
+	}
+)
+
+// ETag returns an ETag middleware.
+//
+// ETag middleware buffers the responses to GET and HEAD requests and sets the
+// `ETag` response header from the body, unless the handler set one. It sends
+// "304 - Not Modified" or "412 - Precondition Failed" according to the
+// conditional request headers, see `vodka.Context#CheckPreconditions()`.
+func ETag() vodka.MiddlewareFunc {
+	return ETagWithConfig(DefaultETagConfig)
+}
+
+// ETagWithConfig returns an ETag middleware with config.
+// See: `ETag()`.
+func ETagWithConfig(config ETagConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultETagConfig.Skipper
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			method := c.Request().Method()
+			if method != vodka.GET && method != vodka.HEAD {
+				return next(c)
+			}
+
+			res := newBufferedResponse(c.Response())
+			bc := newChildContext(c, c.Request(), res)
+			defer c.Vodka().ReleaseContext(bc)
+			err = next(bc)
+			c.SetStdContext(bc.StdContext())
+			c.SetStore(bc.GetStore())
+			if err != nil || !res.committed || res.status != http.StatusOK {
+				res.copyTo(c.Response())
+				return
+			}
+
+			h := res.Header()
+			etag := h.Get(vodka.HeaderETag)
+			if etag == "" {
+				etag = entityTag(res.buffer.Bytes(), config.Weak)
+				h.Set(vodka.HeaderETag, etag)
+			}
+			lastModified, _ := http.ParseTime(h.Get(vodka.HeaderLastModified))
+			switch err = c.CheckPreconditions(etag, lastModified); err {
+			case vodka.ErrNotModified:
+				h.Del(vodka.HeaderContentType)
+				h.Del(vodka.HeaderContentLength)
+				res.status = http.StatusNotModified
+				res.buffer.Reset()
+				err = nil
+			case nil:
+			default:
+				return
+			}
+			res.copyTo(c.Response())
+			return
+		}
+	}
+}
+
+// entityTag returns the quoted entity tag of body.
+func entityTag(body []byte, weak bool) string {
+	if weak {
+		return fmt.Sprintf(`W/"%08x"`, crc32.ChecksumIEEE(body))
+	}
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	e := vodka.New()
+	h := ETag()(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	request := func(method string, header ...string) *test.ResponseRecorder {
+		req := test.NewRequest(method, "/", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header().Set(header[i], header[i+1])
+		}
+		rec := test.NewResponseRecorder()
+		c := e.NewContext(req, rec)
+		if err := h(c); err != nil {
+			c.Error(err)
+		}
+		return rec
+	}
+
+	// Strong
+	rec := request(vodka.GET)
+	etag := rec.Header().Get(vodka.HeaderETag)
+	assert.Equal(t, `"a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"`, etag)
+	assert.Equal(t, "test", rec.Body.String())
+
+	// Not modified
+	rec = request(vodka.GET, vodka.HeaderIfNoneMatch, `"x", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Status())
+	assert.Equal(t, etag, rec.Header().Get(vodka.HeaderETag))
+	assert.Empty(t, rec.Body.String())
+	rec = request(vodka.GET, vodka.HeaderIfNoneMatch, `"x"`)
+	assert.Equal(t, http.StatusOK, rec.Status())
+
+	// Precondition failed
+	rec = request(vodka.GET, vodka.HeaderIfMatch, `"x"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Status())
+
+	// Weak
+	h = ETagWithConfig(ETagConfig{Weak: true})(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	rec = request(vodka.GET)
+	assert.Equal(t, `W/"d87f7e0c"`, rec.Header().Get(vodka.HeaderETag))
+
+	// Handler entity tag
+	h = ETag()(func(c vodka.Context) error {
+		c.Response().Header().Set(vodka.HeaderETag, `"v1"`)
+		return c.String(http.StatusOK, "test")
+	})
+	rec = request(vodka.HEAD, vodka.HeaderIfNoneMatch, `"v1"`)
+	assert.Equal(t, http.StatusNotModified, rec.Status())
+
+	// Empty body, the same for HEAD
+	h = ETag()(func(c vodka.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	etag = request(vodka.GET).Header().Get(vodka.HeaderETag)
+	assert.Equal(t, `"da39a3ee5e6b4b0d3255bfef95601890afd80709"`, etag)
+	assert.Equal(t, etag, request(vodka.HEAD).Header().Get(vodka.HeaderETag))
+
+	// Nothing written
+	h = ETag()(func(c vodka.Context) error {
+		return nil
+	})
+	rec = request(vodka.GET)
+	assert.Empty(t, rec.Header().Get(vodka.HeaderETag))
+	assert.False(t, rec.Committed())
+
+	// Not buffered
+	h = ETag()(func(c vodka.Context) error {
+		c.Response().Header().Set(vodka.HeaderETag, `"v1"`)
+		return c.String(http.StatusOK, "test")
+	})
+	rec = request(vodka.POST)
+	assert.Equal(t, `"v1"`, rec.Header().Get(vodka.HeaderETag))
+	assert.Equal(t, "test", rec.Body.String())
+}
@@ -23,12 +23,17 @@ type (
 		// Log format which can be constructed using the following tags:
 		//
 		// - time_rfc3339
-		// - id (Request ID - Not implemented)
-		// - remote_ip
+		// - id (Request ID, see `RequestID()`. Not in the default format, add it
+		//   with e.g. `"id":"${id}"`)
+		// - trace_id (See `Tracing()`)
+		// - remote_ip (See `vodka.Context#RealIP()`)
 		// - uri
 		// - host
 		// - method
 		// - path
+		// - protocol (E.g. HTTP/1.1 or HTTP/2.0)
+		// - conn_id (See `engine.Request#ConnID()`)
+		// - conn_request_num (See `engine.Request#ConnRequestNum()`)
 		// - referer
 		// - user_agent
 		// - status
@@ -116,9 +121,14 @@ func LoggerWithConfig(config LoggerConfig) vodka.MiddlewareFunc {
 				switch tag {
 				case "time_rfc3339":
 					return w.Write([]byte(time.Now().Format(time.RFC3339)))
+				case "id":
+					return w.Write([]byte(vodka.RequestID(c)))
+				case "trace_id":
+					if span := SpanFromContext(c.StdContext()); span != nil {
+						return w.Write([]byte(span.TraceID.String()))
+					}
 				case "remote_ip":
-					ra := req.RealIP()
-					return w.Write([]byte(ra))
+					return w.Write([]byte(c.RealIP()))
 				case "host":
 					return w.Write([]byte(req.Host()))
 				case "uri":
@@ -131,6 +141,12 @@ func LoggerWithConfig(config LoggerConfig) vodka.MiddlewareFunc {
 						p = "/"
 					}
 					return w.Write([]byte(p))
+				case "protocol":
+					return w.Write([]byte(req.Proto()))
+				case "conn_id":
+					return w.Write([]byte(strconv.FormatUint(req.ConnID(), 10)))
+				case "conn_request_num":
+					return w.Write([]byte(strconv.FormatUint(req.ConnRequestNum(), 10)))
 				case "referer":
 					return w.Write([]byte(req.Referer()))
 				case "user_agent":
@@ -78,3 +78,36 @@ func TestLoggerIPAddress(t *testing.T) {
 	h(c)
 	assert.Contains(t, ip, buf.String())
 }
+
+func TestLoggerConnection(t *testing.T) {
+	e := vodka.New()
+	req := test.NewRequest(vodka.GET, "/", nil)
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(req, rec)
+	buf := new(bytes.Buffer)
+	h := LoggerWithConfig(LoggerConfig{
+		Format: "${protocol} ${conn_id} ${conn_request_num}",
+		Output: buf,
+	})(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	h(c)
+	assert.Equal(t, "HTTP/1.1 0 0", buf.String())
+}
+
+func TestLoggerTraceID(t *testing.T) {
+	e := vodka.New()
+	req := test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(req, rec)
+	buf := new(bytes.Buffer)
+	h := LoggerWithConfig(LoggerConfig{
+		Format: "${trace_id}",
+		Output: buf,
+	})(Tracing(NewMemorySpanExporter())(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	}))
+	h(c)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", buf.String())
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// MetricsConfig defines the config for Metrics middleware.
+	MetricsConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Registry the metrics are registered with.
+		// Optional. Default value `vodka.DefaultMetricsRegistry`.
+		Registry *vodka.MetricsRegistry
+
+		// Namespace prefixes the metric names, e.g. "app" registers
+		// "app_http_requests_total".
+		// Optional. Default value "".
+		Namespace string `json:"namespace"`
+
+		// Buckets of the request duration histogram, in seconds.
+		// Optional. Default value `vodka.DefaultMetricsBuckets`.
+		Buckets []float64 `json:"buckets"`
+
+		// SizeBuckets of the request and response size histograms, in bytes.
+		// Optional. Default value `DefaultMetricsConfig.SizeBuckets`.
+		SizeBuckets []float64 `json:"size_buckets"`
+
+		// Labels adds labels to the request metrics, with the values returned
+		// by the functions. Values should have a small set of possible values.
+		// Optional. Default value nil.
+		Labels map[string]func(vodka.Context) string
+	}
+)
+
+var (
+	// DefaultMetricsConfig is the default Metrics middleware config.
+	DefaultMetricsConfig = MetricsConfig{
+		Skipper:     defaultSkipper,
+		SizeBuckets: []float64{100, 1000, 10000, 100000, 1000000, 10000000, 100000000},
+	}
+)
+
+// Metrics returns a Metrics middleware.
+//
+// Metrics middleware records the number of requests, their duration, the
+// requests in flight and the request and response sizes in
+// `vodka.DefaultMetricsRegistry`. Request metrics are labeled with the method,
+// the route, i.e. `vodka.Context#Path()`, and the status class, e.g. "2xx".
+// Serve them with `vodka.MetricsHandler()`.
+func Metrics() vodka.MiddlewareFunc {
+	return MetricsWithConfig(DefaultMetricsConfig)
+}
+
+// MetricsWithConfig returns a Metrics middleware with config.
+// See: `Metrics()`.
+func MetricsWithConfig(config MetricsConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultMetricsConfig.Skipper
+	}
+	if config.Registry == nil {
+		config.Registry = vodka.DefaultMetricsRegistry
+	}
+	if config.SizeBuckets == nil {
+		config.SizeBuckets = DefaultMetricsConfig.SizeBuckets
+	}
+
+	prefix := ""
+	if config.Namespace != "" {
+		prefix = config.Namespace + "_"
+	}
+	var extra []string
+	for name := range config.Labels {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	labels := append([]string{"method", "route", "status"}, extra...)
+
+	r := config.Registry
+	requests := r.Counter(prefix+"http_requests_total", "Total number of HTTP requests.", labels...)
+	duration := r.Histogram(prefix+"http_request_duration_seconds", "Duration of HTTP requests in seconds.", config.Buckets, labels...)
+	requestSize := r.Histogram(prefix+"http_request_size_bytes", "Size of HTTP request bodies in bytes.", config.SizeBuckets, labels...)
+	responseSize := r.Histogram(prefix+"http_response_size_bytes", "Size of HTTP response bodies in bytes.", config.SizeBuckets, labels...)
+	inFlight := r.Gauge(prefix+"http_requests_in_flight", "Number of HTTP requests being served.")
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			inFlight.Inc()
+			defer inFlight.Dec()
+			start := time.Now()
+			err = next(c)
+			elapsed := time.Since(start)
+
+			// The error, if any, is sent by the error handler later on
+			res := c.Response()
+			status := res.Status()
+			if err != nil && !res.Committed() {
+				status = http.StatusInternalServerError
+				if he, ok := err.(*vodka.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			values := make([]string, len(labels))
+			values[0] = c.Request().Method()
+			values[1] = c.Path()
+			values[2] = strconv.Itoa(status/100) + "xx"
+			for i, name := range extra {
+				values[3+i] = config.Labels[name](c)
+			}
+
+			requests.Inc(values...)
+			duration.Observe(elapsed.Seconds(), values...)
+			if l := c.Request().ContentLength(); l >= 0 {
+				requestSize.Observe(float64(l), values...)
+			}
+			responseSize.Observe(float64(res.Size()), values...)
+			return
+		}
+	}
+}
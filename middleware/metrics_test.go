@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	e := vodka.New()
+	registry := vodka.NewMetricsRegistry()
+	e.Use(MetricsWithConfig(MetricsConfig{
+		Registry:  registry,
+		Namespace: "app",
+		Buckets:   []float64{1},
+		Labels: map[string]func(vodka.Context) string{
+			"tenant": func(c vodka.Context) string {
+				return c.Request().Header().Get("X-Tenant")
+			},
+		},
+	}))
+	e.GET("/users/:id", func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	e.POST("/users", func(c vodka.Context) error {
+		return vodka.ErrUnauthorized
+	})
+	e.GET("/metrics", registry.Handler())
+	request := func(method, uri, body string) *test.ResponseRecorder {
+		req := test.NewRequest(method, uri, strings.NewReader(body))
+		req.Header().Set("X-Tenant", "acme")
+		rec := test.NewResponseRecorder()
+		e.ServeHTTP(req, rec)
+		return rec
+	}
+
+	request(vodka.GET, "/users/1", "")
+	request(vodka.GET, "/users/2", "")
+	request(vodka.POST, "/users", "jon")
+	body := request(vodka.GET, "/metrics", "").Body.String()
+	for _, s := range []string{
+		`app_http_requests_total{method="GET",route="/users/:id",status="2xx",tenant="acme"} 2`,
+		`app_http_requests_total{method="POST",route="/users",status="4xx",tenant="acme"} 1`,
+		`app_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",tenant="acme",le="1"} 2`,
+		`app_http_request_size_bytes_sum{method="POST",route="/users",status="4xx",tenant="acme"} 3`,
+		`app_http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx",tenant="acme"} 8`,
+		"# TYPE app_http_requests_in_flight gauge\napp_http_requests_in_flight 1\n",
+	} {
+		assert.Contains(t, body, s)
+	}
+	assert.NotContains(t, body, "/users/1")
+
+	// Registered once
+	assert.NotPanics(t, func() {
+		MetricsWithConfig(MetricsConfig{
+			Registry:  registry,
+			Namespace: "app",
+			Buckets:   []float64{1},
+			Labels:    map[string]func(vodka.Context) string{"tenant": nil},
+		})
+	})
+	buf := new(bytes.Buffer)
+	registry.WriteTo(buf)
+	assert.Contains(t, buf.String(), "app_http_requests_in_flight 0\n")
+}
@@ -0,0 +1,436 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// RateLimiterConfig defines the config for RateLimiter middleware.
+	RateLimiterConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// RateLimit is the limit applied to the routes without an override.
+		// Required.
+		RateLimit
+
+		// Routes overrides the limit per route. Keys are registered route paths,
+		// optionally prefixed with the method, e.g. "/login" or "POST /login".
+		// Routes with an override are limited separately from the others.
+		// Optional. Default value nil.
+		Routes map[string]RateLimit
+
+		// IdentifierExtractor returns the identifier the requests are limited by.
+		// Optional. Default value `RateLimitByIP()`.
+		IdentifierExtractor RateLimiterIdentifierExtractor
+
+		// Store keeps the state of the limits.
+		// Optional. Default value `NewRateLimiterMemoryStore()`.
+		Store RateLimiterStore
+
+		// DenyHandler is called when a request exceeds the limit.
+		// Optional. Default value returns `vodka.ErrTooManyRequests`.
+		DenyHandler func(c vodka.Context, identifier string) error
+	}
+
+	// RateLimit defines the number of requests allowed per window.
+	RateLimit struct {
+		// Algorithm is the rate limiting algorithm.
+		// Optional. Default value `RateLimitTokenBucket`.
+		// Possible values:
+		// - `RateLimitTokenBucket`
+		// - `RateLimitSlidingWindow`
+		Algorithm string `json:"algorithm"`
+
+		// Limit is the number of requests allowed per window.
+		Limit int `json:"limit"`
+
+		// Window is the period of the limit.
+		// Optional. Default value 1 minute.
+		Window time.Duration `json:"window"`
+
+		// Burst is the size of the bucket of `RateLimitTokenBucket`, the number of
+		// requests allowed at once.
+		// Optional. Default value `Limit`.
+		Burst int `json:"burst"`
+	}
+
+	// RateLimitResult is the state of a limit after a request.
+	RateLimitResult struct {
+		// Allowed reports whether the request is allowed.
+		Allowed bool
+
+		// Remaining is the number of requests left.
+		Remaining int
+
+		// Reset is the time until the limit is fully reset.
+		Reset time.Duration
+
+		// RetryAfter is the time until the next request is allowed.
+		RetryAfter time.Duration
+	}
+
+	// RateLimiterStore keeps the state of the limits for `RateLimiter`.
+	// Implementations must be safe for concurrent use.
+	RateLimiterStore interface {
+		// Allow counts a request against the limit of key and reports whether it
+		// is allowed. The key is the identifier, prefixed with the route and a NUL
+		// byte for routes with an override.
+		Allow(key string, limit RateLimit) (RateLimitResult, error)
+	}
+
+	// RateLimiterIdentifierExtractor returns the identifier a request is limited
+	// by.
+	RateLimiterIdentifierExtractor func(vodka.Context) (string, error)
+
+	// RateLimiterMemoryStoreConfig defines the config for
+	// `RateLimiterMemoryStore`.
+	RateLimiterMemoryStoreConfig struct {
+		// ExpiresIn is the duration after which the state of an inactive key is
+		// removed, or once its limit is fully reset if that takes longer.
+		// Optional. Default value 3 minutes.
+		ExpiresIn time.Duration `json:"expires_in"`
+	}
+
+	// RateLimiterMemoryStore is an in-memory `RateLimiterStore`.
+	RateLimiterMemoryStore struct {
+		RateLimiterMemoryStoreConfig
+		mutex       sync.Mutex
+		visitors    map[string]*visitor
+		lastCleanup time.Time
+		timeNow     func() time.Time
+	}
+
+	visitor struct {
+		// Token bucket
+		tokens float64
+
+		// Sliding window
+		start    time.Time
+		current  int
+		previous int
+
+		lastSeen time.Time
+		expires  time.Time
+	}
+)
+
+// Rate limiting algorithms
+const (
+	// RateLimitTokenBucket refills a bucket of `Burst` tokens at `Limit` tokens
+	// per `Window`, each request takes a token.
+	RateLimitTokenBucket = "token-bucket"
+
+	// RateLimitSlidingWindow allows `Limit` requests in any `Window`, estimated
+	// from the counts of the current and previous fixed windows.
+	RateLimitSlidingWindow = "sliding-window"
+)
+
+var (
+	// DefaultRateLimiterConfig is the default RateLimiter middleware config.
+	DefaultRateLimiterConfig = RateLimiterConfig{
+		Skipper: defaultSkipper,
+		RateLimit: RateLimit{
+			Algorithm: RateLimitTokenBucket,
+			Window:    time.Minute,
+		},
+		IdentifierExtractor: RateLimitByIP(),
+		DenyHandler: func(c vodka.Context, identifier string) error {
+			return vodka.ErrTooManyRequests
+		},
+	}
+
+	// DefaultRateLimiterMemoryStoreConfig is the default
+	// `RateLimiterMemoryStore` config.
+	DefaultRateLimiterMemoryStoreConfig = RateLimiterMemoryStoreConfig{
+		ExpiresIn: 3 * time.Minute,
+	}
+)
+
+// RateLimiter returns a RateLimiter middleware allowing limit requests per
+// window for each client IP.
+//
+// RateLimiter middleware throttles the requests per identifier. It sets the
+// `RateLimit-Limit`, `RateLimit-Remaining` and `RateLimit-Reset` response
+// headers, and sends "429 - Too Many Requests" with a `Retry-After` header
+// when the limit is exceeded.
+func RateLimiter(limit int, window time.Duration) vodka.MiddlewareFunc {
+	c := DefaultRateLimiterConfig
+	c.Limit = limit
+	c.Window = window
+	return RateLimiterWithConfig(c)
+}
+
+// RateLimiterWithConfig returns a RateLimiter middleware with config.
+// See: `RateLimiter()`.
+func RateLimiterWithConfig(config RateLimiterConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultRateLimiterConfig.Skipper
+	}
+	if config.IdentifierExtractor == nil {
+		config.IdentifierExtractor = DefaultRateLimiterConfig.IdentifierExtractor
+	}
+	if config.Store == nil {
+		config.Store = NewRateLimiterMemoryStore()
+	}
+	if config.DenyHandler == nil {
+		config.DenyHandler = DefaultRateLimiterConfig.DenyHandler
+	}
+	config.RateLimit = config.RateLimit.withDefaults()
+	if config.Limit <= 0 {
+		panic("vodka: rate limiter requires a limit")
+	}
+	if !validRateLimitAlgorithm(config.Algorithm) {
+		panic("vodka: unknown rate limiter algorithm " + config.Algorithm)
+	}
+	routes := make(map[string]RateLimit, len(config.Routes))
+	for route, limit := range config.Routes {
+		if limit = limit.withDefaults(); limit.Limit <= 0 {
+			panic("vodka: rate limiter requires a limit for route " + route)
+		}
+		if !validRateLimitAlgorithm(limit.Algorithm) {
+			panic("vodka: unknown rate limiter algorithm " + limit.Algorithm + " for route " + route)
+		}
+		routes[route] = limit
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			identifier, err := config.IdentifierExtractor(c)
+			if err != nil {
+				return vodka.NewHTTPError(http.StatusForbidden, err.Error())
+			}
+			if strings.IndexByte(identifier, 0) >= 0 {
+				// It would be mistaken for the key of a route
+				return vodka.NewHTTPError(http.StatusForbidden, "invalid identifier")
+			}
+
+			// Route override
+			key := identifier
+			limit := config.RateLimit
+			method := c.Request().Method()
+			path := c.Path()
+			if l, ok := routes[method+" "+path]; ok {
+				key = method + " " + path + "\x00" + identifier
+				limit = l
+			} else if l, ok := routes[path]; ok {
+				key = path + "\x00" + identifier
+				limit = l
+			}
+
+			r, err := config.Store.Allow(key, limit)
+			if err != nil {
+				return err
+			}
+			header := c.Response().Header()
+			header.Set(vodka.HeaderRateLimitLimit, strconv.Itoa(limit.Limit))
+			header.Set(vodka.HeaderRateLimitRemaining, strconv.Itoa(r.Remaining))
+			header.Set(vodka.HeaderRateLimitReset, formatSeconds(r.Reset))
+			if !r.Allowed {
+				header.Set(vodka.HeaderRetryAfter, formatSeconds(r.RetryAfter))
+				return config.DenyHandler(c, identifier)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RateLimitByIP returns a `RateLimiterIdentifierExtractor` that identifies
+// requests by `vodka.Context#RealIP()`.
+func RateLimitByIP() RateLimiterIdentifierExtractor {
+	return func(c vodka.Context) (string, error) {
+		return c.RealIP(), nil
+	}
+}
+
+// RateLimitByHeader returns a `RateLimiterIdentifierExtractor` that identifies
+// requests by the provided request header, e.g. an API key.
+func RateLimitByHeader(header string) RateLimiterIdentifierExtractor {
+	return func(c vodka.Context) (string, error) {
+		id := c.Request().Header().Get(header)
+		if id == "" {
+			return "", errors.New("missing " + header + " header")
+		}
+		return id, nil
+	}
+}
+
+// RateLimitByContextKey returns a `RateLimiterIdentifierExtractor` that
+// identifies requests by the value stored in the context with the provided key,
+// e.g. the user set by an authentication middleware.
+func RateLimitByContextKey(key string) RateLimiterIdentifierExtractor {
+	return func(c vodka.Context) (string, error) {
+		switch id := c.Get(key).(type) {
+		case nil:
+		case string:
+			if id != "" {
+				return id, nil
+			}
+		case interface {
+			String() string
+		}:
+			return id.String(), nil
+		}
+		return "", errors.New("missing " + key + " in context")
+	}
+}
+
+// RateLimitByRoute returns a `RateLimiterIdentifierExtractor` that identifies
+// requests by route, limiting all clients together.
+func RateLimitByRoute() RateLimiterIdentifierExtractor {
+	return func(c vodka.Context) (string, error) {
+		return c.Request().Method() + " " + c.Path(), nil
+	}
+}
+
+// NewRateLimiterMemoryStore returns an in-memory `RateLimiterStore`.
+func NewRateLimiterMemoryStore() *RateLimiterMemoryStore {
+	return NewRateLimiterMemoryStoreWithConfig(DefaultRateLimiterMemoryStoreConfig)
+}
+
+// NewRateLimiterMemoryStoreWithConfig returns an in-memory `RateLimiterStore`
+// with config.
+func NewRateLimiterMemoryStoreWithConfig(config RateLimiterMemoryStoreConfig) *RateLimiterMemoryStore {
+	// Defaults
+	if config.ExpiresIn == 0 {
+		config.ExpiresIn = DefaultRateLimiterMemoryStoreConfig.ExpiresIn
+	}
+	return &RateLimiterMemoryStore{
+		RateLimiterMemoryStoreConfig: config,
+		visitors:                     make(map[string]*visitor),
+		timeNow:                      time.Now,
+	}
+}
+
+// Allow implements `RateLimiterStore#Allow()`.
+func (s *RateLimiterMemoryStore) Allow(key string, limit RateLimit) (RateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.timeNow()
+	if now.Sub(s.lastCleanup) > s.ExpiresIn {
+		s.cleanup(now)
+	}
+	v, ok := s.visitors[key]
+	if !ok {
+		v = &visitor{tokens: float64(limit.Burst), start: now.Truncate(limit.Window)}
+		s.visitors[key] = v
+	}
+	elapsed := now.Sub(v.lastSeen)
+	if !ok {
+		elapsed = 0
+	}
+	v.lastSeen = now
+
+	var r RateLimitResult
+	if limit.Algorithm == RateLimitSlidingWindow {
+		r = v.slidingWindow(now, limit)
+	} else {
+		r = v.tokenBucket(elapsed, limit)
+	}
+	// Not to forget the requests of a key while they still count
+	v.expires = now.Add(s.ExpiresIn)
+	if r.Reset > s.ExpiresIn {
+		v.expires = now.Add(r.Reset)
+	}
+	return r, nil
+}
+
+// cleanup removes the visitors inactive for `ExpiresIn` whose limit is reset.
+func (s *RateLimiterMemoryStore) cleanup(now time.Time) {
+	for key, v := range s.visitors {
+		if now.After(v.expires) {
+			delete(s.visitors, key)
+		}
+	}
+	s.lastCleanup = now
+}
+
+func (v *visitor) tokenBucket(elapsed time.Duration, limit RateLimit) (r RateLimitResult) {
+	// Tokens per second
+	rate := float64(limit.Limit) / limit.Window.Seconds()
+	burst := float64(limit.Burst)
+	v.tokens = math.Min(burst, v.tokens+elapsed.Seconds()*rate)
+	if v.tokens >= 1 {
+		v.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = secondsToDuration((1 - v.tokens) / rate)
+	}
+	r.Remaining = int(v.tokens)
+	r.Reset = secondsToDuration((burst - v.tokens) / rate)
+	return
+}
+
+func (v *visitor) slidingWindow(now time.Time, limit RateLimit) (r RateLimitResult) {
+	if end := v.start.Add(limit.Window); !now.Before(end) {
+		v.previous = v.current
+		if !now.Before(end.Add(limit.Window)) {
+			v.previous = 0
+		}
+		v.current = 0
+		v.start = now.Truncate(limit.Window)
+	}
+	elapsed := now.Sub(v.start)
+	weight := 1 - float64(elapsed)/float64(limit.Window)
+	count := float64(v.previous)*weight + float64(v.current)
+	if count+1 <= float64(limit.Limit) {
+		v.current++
+		count++
+		r.Allowed = true
+	} else if v.current >= limit.Limit || v.previous == 0 {
+		r.RetryAfter = limit.Window - elapsed
+	} else {
+		// Wait until the previous window weighs little enough
+		w := float64(limit.Limit-1-v.current) / float64(v.previous)
+		r.RetryAfter = time.Duration((1-w)*float64(limit.Window)) - elapsed
+	}
+	r.Remaining = int(math.Max(0, float64(limit.Limit)-math.Ceil(count)))
+	r.Reset = limit.Window - elapsed
+	if v.current > 0 {
+		// The requests of the current window count until the end of the next
+		r.Reset += limit.Window
+	}
+	return
+}
+
+// validRateLimitAlgorithm checks if the algorithm is known.
+func validRateLimitAlgorithm(algorithm string) bool {
+	return algorithm == RateLimitTokenBucket || algorithm == RateLimitSlidingWindow
+}
+
+func (l RateLimit) withDefaults() RateLimit {
+	if l.Algorithm == "" {
+		l.Algorithm = DefaultRateLimiterConfig.Algorithm
+	}
+	if l.Window <= 0 {
+		l.Window = DefaultRateLimiterConfig.Window
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Limit
+	}
+	return l
+}
+
+// secondsToDuration returns the provided number of seconds as `time.Duration`.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// formatSeconds formats d as a number of seconds, rounded up.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	e := vodka.New()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewRateLimiterMemoryStore()
+	store.timeNow = func() time.Time { return now }
+	h := RateLimiterWithConfig(RateLimiterConfig{
+		RateLimit: RateLimit{Limit: 2, Window: time.Minute},
+		Store:     store,
+		Routes: map[string]RateLimit{
+			"POST /login": {Limit: 1, Window: time.Minute},
+		},
+	})(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	request := func(method, path, ip string) (*test.ResponseRecorder, error) {
+		req := test.NewRequest(method, path, nil)
+		req.(*test.Request).StdRequest().RemoteAddr = ip + ":4711"
+		rec := test.NewResponseRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(path)
+		return rec, h(c)
+	}
+
+	rec, err := request(vodka.GET, "/", "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2", rec.Header().Get(vodka.HeaderRateLimitLimit))
+		assert.Equal(t, "1", rec.Header().Get(vodka.HeaderRateLimitRemaining))
+		assert.Equal(t, "30", rec.Header().Get(vodka.HeaderRateLimitReset))
+	}
+	_, err = request(vodka.GET, "/", "192.0.2.1")
+	assert.NoError(t, err)
+	rec, err = request(vodka.GET, "/", "192.0.2.1")
+	assert.Equal(t, vodka.ErrTooManyRequests, err)
+	assert.Equal(t, "0", rec.Header().Get(vodka.HeaderRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(vodka.HeaderRetryAfter))
+
+	// Other identifier
+	_, err = request(vodka.GET, "/", "192.0.2.2")
+	assert.NoError(t, err)
+
+	// Route override
+	rec, err = request(vodka.POST, "/login", "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", rec.Header().Get(vodka.HeaderRateLimitLimit))
+	}
+	_, err = request(vodka.POST, "/login", "192.0.2.1")
+	assert.Equal(t, vodka.ErrTooManyRequests, err)
+
+	// Refill
+	now = now.Add(30 * time.Second)
+	_, err = request(vodka.GET, "/", "192.0.2.1")
+	assert.NoError(t, err)
+	_, err = request(vodka.GET, "/", "192.0.2.1")
+	assert.Error(t, err)
+
+	// Skipper
+	h = RateLimiterWithConfig(RateLimiterConfig{
+		Skipper:   func(vodka.Context) bool { return true },
+		RateLimit: RateLimit{Limit: 1},
+		Store:     store,
+	})(func(c vodka.Context) error {
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		_, err = request(vodka.GET, "/", "192.0.2.1")
+		assert.NoError(t, err)
+	}
+
+	assert.Panics(t, func() {
+		RateLimiterWithConfig(RateLimiterConfig{})
+	})
+	assert.Panics(t, func() {
+		RateLimiterWithConfig(RateLimiterConfig{RateLimit: RateLimit{Algorithm: "leaky-bucket", Limit: 1}})
+	})
+	assert.Panics(t, func() {
+		RateLimiterWithConfig(RateLimiterConfig{
+			RateLimit: RateLimit{Limit: 1},
+			Routes: map[string]RateLimit{
+				"/login": {Algorithm: "fixed-window", Limit: 1},
+			},
+		})
+	})
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	e := vodka.New()
+	h := RateLimiterWithConfig(RateLimiterConfig{
+		RateLimit:           RateLimit{Limit: 1, Window: time.Minute},
+		IdentifierExtractor: RateLimitByHeader("X-API-Key"),
+		Routes: map[string]RateLimit{
+			"/login": {Limit: 1, Window: time.Minute},
+		},
+	})(func(c vodka.Context) error {
+		return nil
+	})
+	request := func(path, key string) error {
+		req := test.NewRequest(vodka.GET, path, nil)
+		req.Header().Set("X-API-Key", key)
+		c := e.NewContext(req, test.NewResponseRecorder())
+		c.SetPath(path)
+		return h(c)
+	}
+
+	// Identifiers can't use up the limit of a route for others
+	assert.NoError(t, request("/", "/login|jon"))
+	assert.NoError(t, request("/login", "jon"))
+	assert.Equal(t, vodka.ErrTooManyRequests, request("/login", "jon"))
+	err := request("/", "/login\x00jon")
+	if assert.IsType(t, new(vodka.HTTPError), err) {
+		assert.Equal(t, http.StatusForbidden, err.(*vodka.HTTPError).Code)
+	}
+}
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewRateLimiterMemoryStore()
+	store.timeNow = func() time.Time { return now }
+	limit := RateLimit{Algorithm: RateLimitSlidingWindow, Limit: 4, Window: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		r, _ := store.Allow("key", limit)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 3-i, r.Remaining)
+	}
+	r, _ := store.Allow("key", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Minute, r.RetryAfter)
+
+	// The previous window weighs 3/4
+	now = now.Add(75 * time.Second)
+	r, _ = store.Allow("key", limit)
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+	r, _ = store.Allow("key", limit)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 15*time.Second, r.RetryAfter)
+
+	// The previous window is gone
+	now = now.Add(2 * time.Minute)
+	r, _ = store.Allow("key", limit)
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 3, r.Remaining)
+}
+
+func TestRateLimiterMemoryStoreCleanup(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewRateLimiterMemoryStoreWithConfig(RateLimiterMemoryStoreConfig{ExpiresIn: time.Minute})
+	store.timeNow = func() time.Time { return now }
+	limit := RateLimit{Limit: 1, Window: 30 * time.Second}.withDefaults()
+
+	store.Allow("a", limit)
+	now = now.Add(30 * time.Second)
+	store.Allow("b", limit)
+	now = now.Add(45 * time.Second)
+	store.Allow("b", limit)
+	assert.Len(t, store.visitors, 1)
+
+	// The limit is reset
+	r, _ := store.Allow("a", limit)
+	assert.True(t, r.Allowed)
+
+	// Kept while the requests count, longer than `ExpiresIn`
+	limit = RateLimit{Limit: 1, Window: time.Hour}.withDefaults()
+	store.Allow("c", limit)
+	now = now.Add(2 * time.Minute)
+	store.Allow("b", limit)
+	r, _ = store.Allow("c", limit)
+	assert.False(t, r.Allowed)
+	now = now.Add(time.Hour)
+	store.Allow("b", limit)
+	assert.Len(t, store.visitors, 1)
+}
+
+func TestRateLimitIdentifierExtractors(t *testing.T) {
+	e := vodka.New()
+	req := test.NewRequest(vodka.GET, "/", nil)
+	c := e.NewContext(req, nil)
+	c.SetPath("/users/:id")
+
+	_, err := RateLimitByHeader("X-API-Key")(c)
+	assert.Error(t, err)
+	req.Header().Set("X-API-Key", "key")
+	id, _ := RateLimitByHeader("X-API-Key")(c)
+	assert.Equal(t, "key", id)
+
+	_, err = RateLimitByContextKey("user")(c)
+	assert.Error(t, err)
+	c.Set("user", "jon")
+	id, _ = RateLimitByContextKey("user")(c)
+	assert.Equal(t, "jon", id)
+
+	id, _ = RateLimitByRoute()(c)
+	assert.Equal(t, "GET /users/:id", id)
+}
@@ -74,7 +74,11 @@ func RecoverWithConfig(config RecoverConfig) vodka.MiddlewareFunc {
 					stack := make([]byte, config.StackSize)
 					length := runtime.Stack(stack, !config.DisableStackAll)
 					if !config.DisablePrintStack {
-						c.Logger().Printf("[%s] %s %s", color.Red("PANIC RECOVER"), err, stack[:length])
+						if id := vodka.RequestID(c); id != "" {
+							c.Logger().Printf("[%s] [%s] %s %s", color.Red("PANIC RECOVER"), id, err, stack[:length])
+						} else {
+							c.Logger().Printf("[%s] %s %s", color.Red("PANIC RECOVER"), err, stack[:length])
+						}
 					}
 					c.Error(err)
 				}
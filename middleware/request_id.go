@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/libraries/gommon/random"
+)
+
+type (
+	// RequestIDConfig defines the config for RequestID middleware.
+	RequestIDConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Generator generates the ID of the requests without one.
+		// Optional. Default value random 32 characters.
+		Generator func() string
+
+		// Header is the request and response header carrying the ID.
+		// Optional. Default value "X-Request-ID".
+		Header string `json:"header"`
+
+		// DisableIncoming ignores the IDs sent by the clients, e.g. when they
+		// aren't trusted.
+		// Optional. Default value false.
+		DisableIncoming bool `json:"disable_incoming"`
+	}
+)
+
+var (
+	// DefaultRequestIDConfig is the default RequestID middleware config.
+	DefaultRequestIDConfig = RequestIDConfig{
+		Skipper:   defaultSkipper,
+		Generator: generateRequestID,
+		Header:    vodka.HeaderXRequestID,
+	}
+)
+
+// RequestID returns a middleware that identifies each request.
+//
+// RequestID middleware reuses the `X-Request-ID` request header, if it has at
+// most 128 letters, digits, '.', '_' or '-', or generates a new ID. The ID is
+// set on the response header and stored in `vodka.Context#StdContext()`, see
+// `vodka.RequestID()` and `vodka.RequestIDFromContext()`. The Recover
+// middleware and `vodka.DefaultHTTPErrorHandler` include it in their output,
+// the Logger middleware with the `${id}` tag.
+func RequestID() vodka.MiddlewareFunc {
+	return RequestIDWithConfig(DefaultRequestIDConfig)
+}
+
+// RequestIDWithConfig returns a RequestID middleware with config.
+// See: `RequestID()`.
+func RequestIDWithConfig(config RequestIDConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultRequestIDConfig.Skipper
+	}
+	if config.Generator == nil {
+		config.Generator = DefaultRequestIDConfig.Generator
+	}
+	if config.Header == "" {
+		config.Header = DefaultRequestIDConfig.Header
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			id := ""
+			if !config.DisableIncoming {
+				id = c.Request().Header().Get(config.Header)
+			}
+			if !validRequestID(id) {
+				id = config.Generator()
+			}
+			c.Response().Header().Set(config.Header, id)
+			c.SetStdContext(vodka.WithRequestID(c.StdContext(), id))
+
+			return next(c)
+		}
+	}
+}
+
+func generateRequestID() string {
+	return random.String(32)
+}
+
+// validRequestID reports whether an incoming request ID is safe to echo and log
+// as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
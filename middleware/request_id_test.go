@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/insionng/vodka"
+	glog "github.com/insionng/vodka/libraries/gommon/log"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	e := vodka.New()
+	req := test.NewRequest(vodka.GET, "/", nil)
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(req, rec)
+	id := ""
+	h := RequestID()(func(c vodka.Context) error {
+		id = vodka.RequestIDFromContext(c.StdContext())
+		return c.String(http.StatusOK, "test")
+	})
+
+	// Generated
+	h(c)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, rec.Header().Get(vodka.HeaderXRequestID))
+	assert.Equal(t, id, vodka.RequestID(c))
+
+	// Incoming
+	req = test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(vodka.HeaderXRequestID, "jon")
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(req, rec)
+	h(c)
+	assert.Equal(t, "jon", id)
+	assert.Equal(t, "jon", rec.Header().Get(vodka.HeaderXRequestID))
+
+	// Invalid incoming
+	for _, incoming := range []string{`jon","admin":true`, "jon\nsnow", strings.Repeat("a", 129)} {
+		req = test.NewRequest(vodka.GET, "/", nil)
+		req.Header().Set(vodka.HeaderXRequestID, incoming)
+		rec = test.NewResponseRecorder()
+		h(e.NewContext(req, rec))
+		assert.Len(t, id, 32, incoming)
+		assert.Equal(t, id, rec.Header().Get(vodka.HeaderXRequestID))
+	}
+	req = test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(vodka.HeaderXRequestID, "Jon_Snow-1.2")
+	h(e.NewContext(req, test.NewResponseRecorder()))
+	assert.Equal(t, "Jon_Snow-1.2", id)
+	req.Header().Set(vodka.HeaderXRequestID, "jon")
+
+	// Config
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(req, rec)
+	h = RequestIDWithConfig(RequestIDConfig{
+		Generator:       func() string { return "arya" },
+		Header:          "X-Correlation-ID",
+		DisableIncoming: true,
+	})(func(c vodka.Context) error {
+		id = vodka.RequestID(c)
+		return nil
+	})
+	h(c)
+	assert.Equal(t, "arya", id)
+	assert.Equal(t, "arya", rec.Header().Get("X-Correlation-ID"))
+}
+
+func TestRequestIDOutput(t *testing.T) {
+	e := vodka.New()
+	buf := new(bytes.Buffer)
+	e.SetLogOutput(buf)
+	e.SetLogLevel(glog.ERROR)
+	req := test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(vodka.HeaderXRequestID, "jon")
+
+	// Logger
+	c := e.NewContext(req, test.NewResponseRecorder())
+	h := LoggerWithConfig(LoggerConfig{
+		Format: "${id} ${status}",
+		Output: buf,
+	})(RequestID()(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	}))
+	h(c)
+	assert.Equal(t, "jon 200", buf.String())
+
+	// Recover
+	buf.Reset()
+	c = e.NewContext(req, test.NewResponseRecorder())
+	h = RequestID()(Recover()(func(c vodka.Context) error {
+		panic("test")
+	}))
+	h(c)
+	assert.Contains(t, buf.String(), "[jon] test")
+
+	// `vodka.DefaultHTTPErrorHandler`
+	buf.Reset()
+	c = e.NewContext(req, test.NewResponseRecorder())
+	h = RequestID()(func(c vodka.Context) error {
+		return errors.New("error")
+	})
+	c.Error(h(c))
+	assert.Contains(t, buf.String(), "[jon] error")
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	kontext "context"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// TimeoutConfig defines the config for Timeout middleware.
+	TimeoutConfig struct {
+		// Skipper defines a function to skip middleware.
+		// Optional. Default value skips WebSocket upgrades and event streams.
+		Skipper Skipper
+
+		// Timeout is the time allowed for the handler to respond.
+		// Required.
+		Timeout time.Duration `json:"timeout"`
+
+		// Routes overrides the timeout per route. Keys are registered route paths,
+		// optionally prefixed with the method, e.g. "/reports" or "GET /reports".
+		// A value of zero disables the timeout for the route, e.g. for streaming
+		// responses.
+		// Optional. Default value nil.
+		Routes map[string]time.Duration
+
+		// TimeoutHandler is called with the context of the request when the
+		// handler times out, its response is sent instead.
+		// Optional. Default value returns `vodka.ErrServiceUnavailable`.
+		TimeoutHandler vodka.HandlerFunc
+	}
+
+	timeoutResult struct {
+		err   error
+		store map[string]interface{}
+		panic interface{}
+		stack []byte
+	}
+)
+
+var (
+	// DefaultTimeoutConfig is the default Timeout middleware config.
+	DefaultTimeoutConfig = TimeoutConfig{
+		Skipper: timeoutSkipper,
+		TimeoutHandler: func(c vodka.Context) error {
+			return vodka.ErrServiceUnavailable
+		},
+	}
+)
+
+// Timeout returns a Timeout middleware which gives handlers timeout to respond.
+//
+// Timeout middleware runs the handler with a copy of the context whose
+// `vodka.Context#StdContext()` is cancelled after the timeout, and buffers its
+// response. If the handler doesn't return in time, it sends "503 - Service
+// Unavailable" and discards whatever the handler writes afterwards. The handler
+// gets a copy of the request, whose body and form can't be read anymore after
+// the timeout, handlers should stop once the `StdContext()` is done. Responses
+// can't be streamed, `Flush()` is ignored and `Hijack()` returns
+// `engine.ErrNotSupported`, streaming routes should be skipped.
+func Timeout(timeout time.Duration) vodka.MiddlewareFunc {
+	c := DefaultTimeoutConfig
+	c.Timeout = timeout
+	return TimeoutWithConfig(c)
+}
+
+// TimeoutWithConfig returns a Timeout middleware with config.
+// See: `Timeout()`.
+func TimeoutWithConfig(config TimeoutConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultTimeoutConfig.Skipper
+	}
+	if config.TimeoutHandler == nil {
+		config.TimeoutHandler = DefaultTimeoutConfig.TimeoutHandler
+	}
+	if config.Timeout <= 0 {
+		panic("vodka: timeout middleware requires a timeout")
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			timeout := config.Timeout
+			method := c.Request().Method()
+			path := c.Path()
+			if t, ok := config.Routes[method+" "+path]; ok {
+				timeout = t
+			} else if t, ok := config.Routes[path]; ok {
+				timeout = t
+			}
+			if timeout <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := kontext.WithTimeout(c.StdContext(), timeout)
+			defer cancel()
+
+			// The handler gets its own context, request and response, the ones
+			// of the request are reused once it's done.
+			req := newDetachedRequest(c.Request())
+			res := newBufferedResponse(c.Response())
+			tc := newChildContext(c, req, res)
+			tc.SetStdContext(ctx)
+
+			e := c.Vodka()
+			done := make(chan timeoutResult, 1)
+			go func() {
+				var r timeoutResult
+				defer func() {
+					if p := recover(); p != nil {
+						stack := make([]byte, 4<<10)
+						r.panic = p
+						r.stack = stack[:runtime.Stack(stack, false)]
+					}
+					r.store = tc.GetStore()
+					e.ReleaseContext(tc)
+					done <- r
+				}()
+				r.err = next(tc)
+			}()
+
+			select {
+			case r := <-done:
+				if r.panic != nil {
+					// The stack of the handler is lost with the panic passed on
+					if r.panic != http.ErrAbortHandler {
+						c.Logger().Errorf("vodka: panic in timed handler: %v\n%s", r.panic, r.stack)
+					}
+					panic(r.panic)
+				}
+				c.SetStore(r.store)
+				res.copyTo(c.Response())
+				return r.err
+			case <-ctx.Done():
+				req.detach()
+				res.discard(http.ErrHandlerTimeout)
+				if ctx.Err() == kontext.Canceled {
+					// The request was cancelled by the client or the server
+					return ctx.Err()
+				}
+				return config.TimeoutHandler(c)
+			}
+		}
+	}
+}
+
+// timeoutSkipper skips the requests expecting a streaming response, WebSocket
+// upgrades and event streams.
+func timeoutSkipper(c vodka.Context) bool {
+	h := c.Request().Header()
+	return h.Get(vodka.HeaderUpgrade) != "" || strings.Contains(h.Get("Accept"), "text/event-stream")
+}
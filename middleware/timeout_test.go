@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/insionng/vodka/vodkatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	e := vodka.New()
+	req := test.NewRequest(vodka.GET, "/", nil)
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(req, rec)
+	c.Response().Header().Set("X-Outer", "vodka")
+
+	// In time
+	h := Timeout(time.Second)(func(c vodka.Context) error {
+		c.Response().Header().Set("X-Inner", "vodka")
+		c.Set("name", "jon")
+		return c.String(http.StatusCreated, "test")
+	})
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Status())
+		assert.Equal(t, "test", rec.Body.String())
+		assert.Equal(t, "vodka", rec.Header().Get("X-Outer"))
+		assert.Equal(t, "vodka", rec.Header().Get("X-Inner"))
+		assert.Equal(t, "jon", c.Get("name"))
+	}
+
+	// Timed out, late writes are discarded
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(req, rec)
+	late := make(chan error)
+	h = Timeout(10 * time.Millisecond)(func(c vodka.Context) error {
+		<-c.StdContext().Done()
+		time.Sleep(10 * time.Millisecond)
+
+		// The request is detached
+		_, err := c.Request().Body().Read(make([]byte, 1))
+		assert.Equal(t, http.ErrBodyReadAfterClose, err)
+		assert.Equal(t, "/", c.Request().URL().Path())
+		c.Response().Header().Set("X-Inner", "vodka")
+		err = c.String(http.StatusOK, "late")
+		late <- err
+		return err
+	})
+	assert.Equal(t, vodka.ErrServiceUnavailable, h(c))
+	assert.Equal(t, http.ErrHandlerTimeout, <-late)
+	assert.False(t, rec.Committed())
+	assert.Empty(t, rec.Header().Get("X-Inner"))
+
+	// Route override and custom handler
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/stream")
+	h = TimeoutWithConfig(TimeoutConfig{
+		Timeout: 10 * time.Millisecond,
+		Routes:  map[string]time.Duration{"GET /stream": 0},
+		TimeoutHandler: func(c vodka.Context) error {
+			return c.String(http.StatusGatewayTimeout, "timeout")
+		},
+	})(func(c vodka.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return c.String(http.StatusOK, "test")
+	})
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, "test", rec.Body.String())
+	}
+	c.SetPath("/")
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(req, rec)
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Status())
+		assert.Equal(t, "timeout", rec.Body.String())
+	}
+
+	// Skipped
+	req = test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(vodka.HeaderUpgrade, "websocket")
+	rec = test.NewResponseRecorder()
+	c = e.NewContext(req, rec)
+	h = Timeout(10 * time.Millisecond)(func(c vodka.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return c.String(http.StatusOK, "test")
+	})
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, "test", rec.Body.String())
+	}
+
+	// Panics are passed on
+	h = Timeout(time.Second)(func(c vodka.Context) error {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		assert.Equal(t, http.ErrAbortHandler, recover())
+	}()
+	h(c)
+}
+
+func TestTimeoutSlowBody(t *testing.T) {
+	e := vodka.New()
+	pr, pw := io.Pipe()
+	req := test.NewRequest(vodka.POST, "/", pr)
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(req, rec)
+	read := make(chan error)
+	h := Timeout(10 * time.Millisecond)(func(c vodka.Context) error {
+		_, err := ioutil.ReadAll(c.Request().Body())
+		read <- err
+		return err
+	})
+
+	// The body trickles in past the timeout
+	go func() {
+		pw.Write([]byte("vo"))
+		time.Sleep(200 * time.Millisecond)
+		pw.Write([]byte("dka"))
+		pw.Close()
+	}()
+	start := time.Now()
+	assert.Equal(t, vodka.ErrServiceUnavailable, h(c))
+	assert.True(t, time.Since(start) < 150*time.Millisecond)
+	assert.Equal(t, http.ErrBodyReadAfterClose, <-read)
+}
+
+func TestTimeoutEngines(t *testing.T) {
+	e := vodka.New()
+	e.Use(Timeout(50 * time.Millisecond))
+	e.GET("/", func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	late := make(chan string)
+	e.POST("/slow", func(c vodka.Context) error {
+		<-c.StdContext().Done()
+		time.Sleep(10 * time.Millisecond)
+
+		// The request may be reused meanwhile
+		b, err := ioutil.ReadAll(c.Request().Body())
+		late <- c.Request().Header().Get("X-Name") + string(b)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, "late")
+	})
+	vodkatest.Run(t, e, func(t *testing.T, vt *vodkatest.Client) {
+		vt.GET("/").Expect().Status(http.StatusOK).Body("test")
+		vt.POST("/slow").
+			WithHeader("X-Name", "jon").
+			Expect().Status(http.StatusServiceUnavailable).Body(http.StatusText(http.StatusServiceUnavailable))
+		vt.GET("/").WithHeader("X-Name", "arya").Expect().Status(http.StatusOK).Body("test")
+		assert.Equal(t, "jon", <-late)
+	})
+}
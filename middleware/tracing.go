@@ -0,0 +1,409 @@
+package middleware
+
+import (
+	kontext "context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// TracingConfig defines the config for Tracing middleware.
+	TracingConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+
+		// Exporter receives the sampled spans once they end.
+		// Required.
+		Exporter SpanExporter
+
+		// Sampler decides whether to sample the traces started by requests
+		// without a `traceparent` header, others follow the decision of the
+		// caller.
+		// Optional. Default value samples all traces.
+		Sampler func(vodka.Context) bool
+	}
+
+	// TraceID identifies a trace.
+	TraceID [16]byte
+
+	// SpanID identifies a span within a trace.
+	SpanID [8]byte
+
+	// Span is a timed operation of a trace, e.g. serving a request. Spans are
+	// exported when they end, if sampled.
+	Span struct {
+		Name         string            `json:"name"`
+		Kind         string            `json:"kind"`
+		TraceID      TraceID           `json:"trace_id"`
+		SpanID       SpanID            `json:"span_id"`
+		ParentSpanID SpanID            `json:"parent_span_id"`
+		Sampled      bool              `json:"sampled"`
+		TraceState   string            `json:"trace_state,omitempty"`
+		StartTime    time.Time         `json:"start_time"`
+		EndTime      time.Time         `json:"end_time"`
+		Status       int               `json:"status,omitempty"`
+		Error        string            `json:"error,omitempty"`
+		Attributes   map[string]string `json:"attributes,omitempty"`
+		exporter     SpanExporter
+		mutex        sync.Mutex
+		ended        bool
+	}
+
+	// SpanExporter exports ended spans, e.g. to a tracing backend.
+	SpanExporter interface {
+		ExportSpan(*Span) error
+	}
+
+	// StdoutSpanExporter writes spans as JSON lines, see
+	// `NewStdoutSpanExporter()`.
+	StdoutSpanExporter struct {
+		mutex   sync.Mutex
+		encoder *json.Encoder
+	}
+
+	// MemorySpanExporter keeps spans in memory, e.g. for tests.
+	MemorySpanExporter struct {
+		mutex sync.Mutex
+		spans []*Span
+	}
+
+	spanKey struct{}
+)
+
+// Span kinds
+const (
+	SpanKindServer   = "server"
+	SpanKindClient   = "client"
+	SpanKindInternal = "internal"
+)
+
+// W3C Trace Context headers
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+var (
+	// DefaultTracingConfig is the default Tracing middleware config.
+	DefaultTracingConfig = TracingConfig{
+		Skipper: defaultSkipper,
+		Sampler: func(vodka.Context) bool { return true },
+	}
+)
+
+// Tracing returns a Tracing middleware exporting spans with exporter.
+//
+// Tracing middleware starts a server span for each request, named after the
+// method and route, e.g. "GET /users/:id", child of the span of the caller
+// given with the W3C Trace Context `traceparent` and `tracestate` headers. The
+// span, with the status and error of the response, is stored in
+// `vodka.Context#StdContext()`, see `SpanFromContext()`, `StartSpan()` and
+// `InjectTraceContext()` to trace and propagate downstream calls.
+func Tracing(exporter SpanExporter) vodka.MiddlewareFunc {
+	c := DefaultTracingConfig
+	c.Exporter = exporter
+	return TracingWithConfig(c)
+}
+
+// TracingWithConfig returns a Tracing middleware with config.
+// See: `Tracing()`.
+func TracingWithConfig(config TracingConfig) vodka.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultTracingConfig.Skipper
+	}
+	if config.Sampler == nil {
+		config.Sampler = DefaultTracingConfig.Sampler
+	}
+	if config.Exporter == nil {
+		panic("vodka: tracing middleware requires a span exporter")
+	}
+
+	return func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			span := &Span{
+				Kind:      SpanKindServer,
+				SpanID:    newSpanID(),
+				StartTime: time.Now(),
+				exporter:  config.Exporter,
+			}
+			if traceID, spanID, sampled, ok := parseTraceparent(req.Header().Get(HeaderTraceparent)); ok {
+				span.TraceID = traceID
+				span.ParentSpanID = spanID
+				span.Sampled = sampled
+				span.TraceState = req.Header().Get(HeaderTracestate)
+			} else {
+				span.TraceID = newTraceID()
+				span.Sampled = config.Sampler(c)
+			}
+			span.SetAttribute("http.method", req.Method())
+			span.SetAttribute("http.path", req.URL().Path())
+			c.SetStdContext(ContextWithSpan(c.StdContext(), span))
+
+			defer func() {
+				if r := recover(); r != nil {
+					span.Status = http.StatusInternalServerError
+					span.Error = fmt.Sprintf("panic: %v", r)
+					span.end(c)
+					panic(r)
+				}
+			}()
+			err = next(c)
+
+			// The error, if any, is sent by the error handler later on
+			res := c.Response()
+			span.Status = res.Status()
+			if err != nil {
+				span.Error = err.Error()
+				if !res.Committed() {
+					span.Status = http.StatusInternalServerError
+					if he, ok := err.(*vodka.HTTPError); ok {
+						span.Status = he.Code
+					}
+				}
+			} else if span.Status >= http.StatusInternalServerError && span.Error == "" {
+				span.Error = http.StatusText(span.Status)
+			}
+			span.end(c)
+			return
+		}
+	}
+}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx kontext.Context, span *Span) kontext.Context {
+	return kontext.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx kontext.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a span named name, child of the span carried by ctx if any,
+// and returns a copy of ctx carrying it. The span is exported with the
+// exporter of its parent once ended, see `Span#End()`.
+func StartSpan(ctx kontext.Context, name string) (kontext.Context, *Span) {
+	span := &Span{
+		Name:      name,
+		Kind:      SpanKindInternal,
+		SpanID:    newSpanID(),
+		StartTime: time.Now(),
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+		span.Sampled = parent.Sampled
+		span.TraceState = parent.TraceState
+		span.exporter = parent.exporter
+	} else {
+		span.TraceID = newTraceID()
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// InjectTraceContext sets the `traceparent` and `tracestate` headers of an
+// outbound request from the span carried by ctx, if any.
+func InjectTraceContext(ctx kontext.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(HeaderTraceparent, span.Traceparent())
+	if span.TraceState != "" {
+		header.Set(HeaderTracestate, span.TraceState)
+	}
+}
+
+// Traceparent returns the value of the `traceparent` header identifying the
+// span as parent.
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-" + flags
+}
+
+// SetAttribute sets the attribute key of the span to value.
+func (s *Span) SetAttribute(key, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// RecordError records err as the error of the span.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Error = err.Error()
+}
+
+// End ends the span and exports it if sampled. It returns the error of the
+// exporter. Ending a span again does nothing.
+func (s *Span) End() error {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mutex.Unlock()
+	if !s.Sampled || s.exporter == nil {
+		return nil
+	}
+	return s.exporter.ExportSpan(s)
+}
+
+// end names the server span after the route and ends it.
+func (s *Span) end(c vodka.Context) {
+	s.Name = c.Request().Method() + " " + c.Path()
+	s.SetAttribute("http.route", c.Path())
+	s.SetAttribute("http.status_code", strconv.Itoa(s.Status))
+	if err := s.End(); err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// String returns the trace ID as lowercase hex.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the trace ID isn't all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// MarshalText implements `encoding.TextMarshaler`.
+func (id TraceID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// String returns the span ID as lowercase hex, or an empty string if zero.
+func (id SpanID) String() string {
+	if !id.IsValid() {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the span ID isn't all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// MarshalText implements `encoding.TextMarshaler`.
+func (id SpanID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// NewStdoutSpanExporter returns a span exporter writing spans as JSON lines to
+// w, or `os.Stdout` if nil.
+func NewStdoutSpanExporter(w io.Writer) *StdoutSpanExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutSpanExporter{encoder: json.NewEncoder(w)}
+}
+
+// ExportSpan implements `SpanExporter#ExportSpan` function.
+func (e *StdoutSpanExporter) ExportSpan(s *Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return e.encoder.Encode(s)
+}
+
+// NewMemorySpanExporter returns an empty in-memory span exporter.
+func NewMemorySpanExporter() *MemorySpanExporter {
+	return new(MemorySpanExporter)
+}
+
+// ExportSpan implements `SpanExporter#ExportSpan` function.
+func (e *MemorySpanExporter) ExportSpan(s *Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+// Spans returns the exported spans, in the order they ended.
+func (e *MemorySpanExporter) Spans() []*Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset removes the exported spans.
+func (e *MemorySpanExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+// parseTraceparent parses a `traceparent` header, "00-<trace-id>-<span-id>-
+// <flags>", as specified by W3C Trace Context. Later versions are parsed as
+// version 00 if their prefix is valid.
+func parseTraceparent(h string) (traceID TraceID, spanID SpanID, sampled, ok bool) {
+	h = strings.TrimSpace(h)
+	if len(h) < 55 || (h[:2] == "00" && len(h) != 55) || (len(h) > 55 && h[55] != '-') {
+		return
+	}
+	if h[:2] == "ff" || h[2] != '-' || h[35] != '-' || h[52] != '-' {
+		return
+	}
+	var version, flags [1]byte
+	if !decodeLowerHex(version[:], h[:2]) || !decodeLowerHex(traceID[:], h[3:35]) ||
+		!decodeLowerHex(spanID[:], h[36:52]) || !decodeLowerHex(flags[:], h[53:55]) {
+		return
+	}
+	return traceID, spanID, flags[0]&1 == 1, traceID.IsValid() && spanID.IsValid()
+}
+
+// decodeLowerHex decodes s, which must only have lowercase hex digits, to dst.
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+func newTraceID() (id TraceID) {
+	rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id SpanID) {
+	rand.Read(id[:])
+	return
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracing(t *testing.T) {
+	e := vodka.New()
+	exporter := NewMemorySpanExporter()
+	e.Use(Tracing(exporter))
+	outbound := make(http.Header)
+	e.GET("/users/:id", func(c vodka.Context) error {
+		ctx, span := StartSpan(c.StdContext(), "db")
+		span.SetAttribute("db.statement", "SELECT")
+		span.End()
+		InjectTraceContext(ctx, outbound)
+		return c.String(http.StatusOK, "test")
+	})
+	e.GET("/error", func(c vodka.Context) error {
+		return errors.New("error")
+	})
+	request := func(path, traceparent string) {
+		req := test.NewRequest(vodka.GET, path, nil)
+		if traceparent != "" {
+			req.Header().Set(HeaderTraceparent, traceparent)
+			req.Header().Set(HeaderTracestate, "vendor=value")
+		}
+		e.ServeHTTP(req, test.NewResponseRecorder())
+	}
+
+	// Propagated
+	request("/users/1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 2) {
+		db, server := spans[0], spans[1]
+		assert.Equal(t, "GET /users/:id", server.Name)
+		assert.Equal(t, SpanKindServer, server.Kind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID.String())
+		assert.Equal(t, "vendor=value", server.TraceState)
+		assert.Equal(t, http.StatusOK, server.Status)
+		assert.Equal(t, "/users/:id", server.Attributes["http.route"])
+		assert.Equal(t, "/users/1", server.Attributes["http.path"])
+		assert.Empty(t, server.Error)
+		assert.False(t, server.EndTime.Before(server.StartTime))
+
+		assert.Equal(t, "db", db.Name)
+		assert.Equal(t, server.TraceID, db.TraceID)
+		assert.Equal(t, server.SpanID, db.ParentSpanID)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+db.SpanID.String()+"-01", outbound.Get(HeaderTraceparent))
+		assert.Equal(t, "vendor=value", outbound.Get(HeaderTracestate))
+	}
+
+	// Not sampled by the caller
+	exporter.Reset()
+	request("/users/1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.Empty(t, exporter.Spans())
+
+	// New trace, with an error
+	for _, traceparent := range []string{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"} {
+		exporter.Reset()
+		request("/error", traceparent)
+		spans = exporter.Spans()
+		if assert.Len(t, spans, 1) {
+			assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID.String())
+			assert.True(t, spans[0].TraceID.IsValid())
+			assert.False(t, spans[0].ParentSpanID.IsValid())
+			assert.Empty(t, spans[0].TraceState)
+			assert.Equal(t, http.StatusInternalServerError, spans[0].Status)
+			assert.Equal(t, "error", spans[0].Error)
+		}
+	}
+
+	// Panic
+	exporter.Reset()
+	h := Tracing(exporter)(func(c vodka.Context) error {
+		panic("test")
+	})
+	c := e.NewContext(test.NewRequest(vodka.GET, "/", nil), test.NewResponseRecorder())
+	assert.Panics(t, func() { h(c) })
+	if spans = exporter.Spans(); assert.Len(t, spans, 1) {
+		assert.Equal(t, "panic: test", spans[0].Error)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for h, ok := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b-701":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01":       false,
+		"": false,
+	} {
+		_, _, _, valid := parseTraceparent(h)
+		assert.Equal(t, ok, valid, h)
+	}
+}
+
+func TestStdoutSpanExporter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	exporter := NewStdoutSpanExporter(buf)
+	h := Tracing(exporter)(func(c vodka.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	req := test.NewRequest(vodka.GET, "/", nil)
+	req.Header().Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h(vodka.New().NewContext(req, test.NewResponseRecorder()))
+
+	var span map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &span)) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["trace_id"])
+		assert.Equal(t, "00f067aa0ba902b7", span["parent_span_id"])
+		assert.Equal(t, SpanKindServer, span["kind"])
+		assert.Equal(t, float64(http.StatusOK), span["status"])
+	}
+}
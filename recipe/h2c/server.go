@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/engine/standard"
+)
+
+func index(c vodka.Context) error {
+	// Push is only possible over HTTP/2, to clients which accept it.
+	if err := c.Push("/app.js", nil); err != nil && err != engine.ErrNotSupported {
+		return err
+	}
+	return c.HTML(http.StatusOK, `<script src="/app.js"></script>`+c.Request().Proto())
+}
+
+func app(c vodka.Context) error {
+	return c.Blob(http.StatusOK, vodka.MIMEApplicationJavaScript, []byte(`console.log("vodka")`))
+}
+
+func main() {
+	e := vodka.New()
+	e.GET("/", index)
+	e.GET("/app.js", app)
+	// Try it with `curl --http2-prior-knowledge http://localhost:1323`, or
+	// `curl --http2 http://localhost:1323` to upgrade from HTTP/1.1
+	e.Run(standard.WithConfig(engine.Config{
+		Address: ":1323",
+		H2C:     true,
+	}))
+}
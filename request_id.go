@@ -0,0 +1,36 @@
+package vodka
+
+import (
+	kontext "context"
+)
+
+type (
+	requestIDKey struct{}
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID, e.g. to propagate
+// it to outbound calls. See `RequestIDFromContext()`.
+func WithRequestID(ctx kontext.Context, id string) kontext.Context {
+	return kontext.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty string.
+func RequestIDFromContext(ctx kontext.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID returns the ID of the request, as set by the RequestID middleware
+// in `Context#StdContext()`. It falls back to the `X-Request-ID` response header.
+func RequestID(c Context) string {
+	if id := RequestIDFromContext(c.StdContext()); id != "" {
+		return id
+	}
+	if res := c.Response(); res != nil {
+		return res.Header().Get(HeaderXRequestID)
+	}
+	return ""
+}
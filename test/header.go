@@ -24,6 +24,10 @@ func (h *Header) Set(key, val string) {
 	h.header.Set(key, val)
 }
 
+func (h *Header) Values(key string) []string {
+	return h.header[http.CanonicalHeaderKey(key)]
+}
+
 func (h *Header) Keys() (keys []string) {
 	keys = make([]string, len(h.header))
 	i := 0
@@ -35,7 +39,7 @@ func (h *Header) Keys() (keys []string) {
 }
 
 func (h *Header) Contains(key string) bool {
-	_, ok := h.header[key]
+	_, ok := h.header[http.CanonicalHeaderKey(key)]
 	return ok
 }
 
@@ -1,12 +1,14 @@
 package test
 
 import (
+	"crypto/tls"
 	"errors"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/insionng/vodka/engine"
@@ -14,9 +16,11 @@ import (
 
 type (
 	Request struct {
-		request *http.Request
-		url     engine.URL
-		header  engine.Header
+		request        *http.Request
+		url            engine.URL
+		header         engine.Header
+		connID         uint64
+		connRequestNum uint64
 	}
 )
 
@@ -37,6 +41,14 @@ func (r *Request) IsTLS() bool {
 	return r.request.TLS != nil
 }
 
+func (r *Request) StdRequest() *http.Request {
+	return r.request
+}
+
+func (r *Request) TLSState() *tls.ConnectionState {
+	return r.request.TLS
+}
+
 func (r *Request) Scheme() string {
 	if r.IsTLS() {
 		return "https"
@@ -64,22 +76,31 @@ func (r *Request) Referer() string {
 	return r.request.Referer()
 }
 
-// func Proto() string {
-// 	return r.request.Proto()
-// }
-//
-// func ProtoMajor() int {
-// 	return r.request.ProtoMajor()
-// }
-//
-// func ProtoMinor() int {
-// 	return r.request.ProtoMinor()
-// }
+func (r *Request) Proto() string {
+	return r.request.Proto
+}
+
+func (r *Request) ProtoMajor() int {
+	return r.request.ProtoMajor
+}
+
+func (r *Request) ProtoMinor() int {
+	return r.request.ProtoMinor
+}
 
 func (r *Request) ContentLength() int64 {
 	return r.request.ContentLength
 }
 
+func (r *Request) SetContentLength(length int64) {
+	r.request.ContentLength = length
+	if length < 0 {
+		r.request.Header.Del("Content-Length")
+	} else {
+		r.request.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+}
+
 func (r *Request) UserAgent() string {
 	return r.request.UserAgent()
 }
@@ -88,6 +109,21 @@ func (r *Request) RemoteAddress() string {
 	return r.request.RemoteAddr
 }
 
+func (r *Request) LocalAddress() string {
+	if addr, ok := r.request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+func (r *Request) ConnID() uint64 {
+	return r.connID
+}
+
+func (r *Request) ConnRequestNum() uint64 {
+	return r.connRequestNum
+}
+
 func (r *Request) RealIP() string {
 	ra := r.RemoteAddress()
 	if ip := r.Header().Get("X-Forwarded-For"); ip != "" {
@@ -173,4 +209,6 @@ func (r *Request) reset(req *http.Request, h engine.Header, u engine.URL) {
 	r.request = req
 	r.header = h
 	r.url = u
+	r.connID = 0
+	r.connRequestNum = 0
 }
@@ -1,24 +1,29 @@
 package test
 
 import (
+	"bufio"
 	"bytes"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 
 	"github.com/insionng/vodka/engine"
-	"github.com/insionng/vodka/libraries/gommon/log"
+	glog "github.com/insionng/vodka/libraries/gommon/log"
+	"github.com/insionng/vodka/log"
 )
 
 type (
 	Response struct {
-		response  http.ResponseWriter
-		header    engine.Header
-		status    int
-		size      int64
-		committed bool
-		writer    io.Writer
-		logger    *log.Logger
+		response    http.ResponseWriter
+		header      engine.Header
+		status      int
+		size        int64
+		committed   bool
+		writer      io.Writer
+		logger      log.Logger
+		beforeFuncs []func()
+		afterFuncs  []func()
 	}
 
 	ResponseRecorder struct {
@@ -32,9 +37,10 @@ func NewResponseRecorder() *ResponseRecorder {
 	return &ResponseRecorder{
 		Response: &Response{
 			response: rec,
+			status:   http.StatusOK,
 			header:   &Header{rec.Header()},
 			writer:   rec,
-			logger:   log.New("test"),
+			logger:   glog.New("test"),
 		},
 		Body: rec.Body,
 	}
@@ -49,6 +55,9 @@ func (r *Response) WriteHeader(code int) {
 		r.logger.Warn("response already committed")
 		return
 	}
+	for _, fn := range r.beforeFuncs {
+		fn()
+	}
 	r.status = code
 	r.response.WriteHeader(code)
 	r.committed = true
@@ -92,6 +101,60 @@ func (r *Response) SetWriter(w io.Writer) {
 	r.writer = w
 }
 
+func (r *Response) StdResponseWriter() http.ResponseWriter {
+	return r.response
+}
+
+func (r *Response) Before(fn func()) {
+	r.beforeFuncs = append(r.beforeFuncs, fn)
+}
+
+func (r *Response) After(fn func()) {
+	r.afterFuncs = append(r.afterFuncs, fn)
+}
+
+func (r *Response) Flush() {
+	if !r.committed {
+		r.WriteHeader(r.status)
+	}
+	if f, ok := r.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := r.response.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *Response) SetTrailer(name, value string) error {
+	name = http.CanonicalHeaderKey(name)
+	h := r.response.Header()
+	if !r.committed {
+		h.Add("Trailer", name)
+	}
+	h[http.TrailerPrefix+name] = []string{value}
+	return nil
+}
+
+func (r *Response) Hijack() (c net.Conn, rw *bufio.ReadWriter, err error) {
+	h, ok := r.response.(http.Hijacker)
+	if !ok {
+		return nil, nil, engine.ErrNotSupported
+	}
+	if c, rw, err = h.Hijack(); err == nil {
+		r.committed = true
+	}
+	return
+}
+
+func (r *Response) Push(target string, header map[string][]string) error {
+	if p, ok := r.response.(http.Pusher); ok {
+		return p.Push(target, &http.PushOptions{Header: header})
+	}
+	return engine.ErrNotSupported
+}
+
 func (r *Response) Writer() io.Writer {
 	return r.writer
 }
@@ -103,4 +166,15 @@ func (r *Response) reset(w http.ResponseWriter, h engine.Header) {
 	r.size = 0
 	r.committed = false
 	r.writer = w
+	r.beforeFuncs = nil
+	r.afterFuncs = nil
+}
+
+func (r *Response) finish() {
+	if !r.committed {
+		r.WriteHeader(r.status)
+	}
+	for _, fn := range r.afterFuncs {
+		fn()
+	}
 }
@@ -1,22 +1,38 @@
 package test
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
 	"github.com/insionng/vodka/engine"
-	"github.com/insionng/vodka/libraries/gommon/log"
+	glog "github.com/insionng/vodka/libraries/gommon/log"
+	"github.com/insionng/vodka/log"
 )
 
 type (
 	Server struct {
 		*http.Server
-		config  *engine.Config
-		handler engine.Handler
-		pool    *Pool
-		logger  *log.Logger
+		config   *engine.Config
+		listener net.Listener
+		state    *engine.ServerState
+		handler  engine.Handler
+		pool     *Pool
+		logger   log.Logger
+		connID   uint64
 	}
 
+	// connState counts the requests of a connection.
+	connState struct {
+		id       uint64
+		requests uint64
+	}
+
+	connStateKey struct{}
+
 	Pool struct {
 		request  sync.Pool
 		response sync.Pool
@@ -43,6 +59,7 @@ func NewConfig(c *engine.Config) (s *Server) {
 	s = &Server{
 		Server: new(http.Server),
 		config: c,
+		state:  engine.NewServerState(),
 		pool: &Pool{
 			request: sync.Pool{
 				New: func() interface{} {
@@ -68,7 +85,12 @@ func NewConfig(c *engine.Config) (s *Server) {
 		handler: engine.HandlerFunc(func(req engine.Request, res engine.Response) {
 			panic("vodka: handler not set, use `Server#SetHandler()` to set it.")
 		}),
-		logger: log.New("vodka"),
+		logger: glog.New("vodka"),
+	}
+	s.Server.Addr = c.Address
+	s.Handler = s
+	s.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, connStateKey{}, &connState{id: atomic.AddUint64(&s.connID, 1)})
 	}
 	return
 }
@@ -77,31 +99,62 @@ func (s *Server) SetHandler(h engine.Handler) {
 	s.handler = h
 }
 
-func (s *Server) SetLogger(l *log.Logger) {
+func (s *Server) SetLogger(l log.Logger) {
 	s.logger = l
 }
 
-func (s *Server) Start() error {
-	if s.config.Listener == nil {
-		return s.startDefaultListener()
+func (s *Server) Listen() error {
+	if s.listener != nil {
+		return nil
+	}
+	config, certs, err := engine.NewTLSConfig(*s.config)
+	if err != nil {
+		return err
 	}
-	return s.startCustomListener()
+	ln, err := engine.NewListener(*s.config)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		certs.Watch(s.config.TLSReloadInterval, s.config.TLSReloadOnSIGHUP, s.logger)
+		ln = tls.NewListener(ln, config)
+	}
+	s.listener = ln
+	s.state.SetReady()
+	return nil
 }
 
-func (s *Server) Stop() error {
-	return nil
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
 }
 
-func (s *Server) startDefaultListener() error {
-	c := s.config
-	if c.TLSCertFile != "" && c.TLSKeyFile != "" {
-		return s.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+func (s *Server) Start() (err error) {
+	defer func() {
+		s.state.SetDone(err)
+	}()
+	if err = s.Listen(); err != nil {
+		return
 	}
-	return s.ListenAndServe()
+	return s.Serve(s.listener)
 }
 
-func (s *Server) startCustomListener() error {
-	return s.Serve(s.config.Listener)
+func (s *Server) Stop() error {
+	s.state.SetStopped()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) Ready() <-chan struct{} {
+	return s.state.Ready()
+}
+
+func (s *Server) Done() <-chan error {
+	return s.state.Done()
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -112,6 +165,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqHdr.reset(r.Header)
 	reqURL.reset(r.URL)
 	req.reset(r, reqHdr, reqURL)
+	if cs, ok := r.Context().Value(connStateKey{}).(*connState); ok {
+		req.connID = cs.id
+		req.connRequestNum = atomic.AddUint64(&cs.requests, 1)
+	}
 
 	// Response
 	res := s.pool.response.Get().(*Response)
@@ -120,6 +177,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	res.reset(w, resHdr)
 
 	s.handler.ServeHTTP(req, res)
+	res.finish()
 
 	s.pool.request.Put(req)
 	s.pool.header.Put(reqHdr)
@@ -0,0 +1,14 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/engine/test"
+)
+
+func TestServerConformance(t *testing.T) {
+	test.ServerTest(t, func(addr string) engine.Server {
+		return New(addr)
+	})
+}
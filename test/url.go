@@ -41,4 +41,5 @@ func (u *URL) QueryString() string {
 
 func (u *URL) reset(url *url.URL) {
 	u.url = url
+	u.query = nil
 }
@@ -42,6 +42,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"path"
 	"reflect"
@@ -57,7 +58,8 @@ import (
 type (
 	// Vodka is the top-level framework instance.
 	Vodka struct {
-		server           engine.Server
+		servers          []engine.Server
+		serversMu        sync.Mutex
 		premiddleware    []MiddlewareFunc
 		middleware       []MiddlewareFunc
 		maxParam         *int
@@ -65,6 +67,9 @@ type (
 		httpErrorHandler HTTPErrorHandler
 		binder           Binder
 		renderer         Renderer
+		ipExtractor      IPExtractor
+		bodyBufferSize   int64
+		maxBodySize      int64
 		pool             sync.Pool
 		debug            bool
 		router           *Router
@@ -145,22 +150,31 @@ const (
 	HeaderAcceptEncoding                = "Accept-Encoding"
 	HeaderAllow                         = "Allow"
 	HeaderAuthorization                 = "Authorization"
+	HeaderCacheControl                  = "Cache-Control"
 	HeaderContentDisposition            = "Content-Disposition"
 	HeaderContentEncoding               = "Content-Encoding"
 	HeaderContentLength                 = "Content-Length"
 	HeaderContentType                   = "Content-Type"
 	HeaderCookie                        = "Cookie"
 	HeaderSetCookie                     = "Set-Cookie"
+	HeaderETag                          = "ETag"
+	HeaderIfMatch                       = "If-Match"
+	HeaderIfNoneMatch                   = "If-None-Match"
 	HeaderIfModifiedSince               = "If-Modified-Since"
+	HeaderIfUnmodifiedSince             = "If-Unmodified-Since"
 	HeaderLastModified                  = "Last-Modified"
 	HeaderLocation                      = "Location"
 	HeaderUpgrade                       = "Upgrade"
+	HeaderRetryAfter                    = "Retry-After"
+	HeaderTrailer                       = "Trailer"
 	HeaderVary                          = "Vary"
 	HeaderWWWAuthenticate               = "WWW-Authenticate"
 	HeaderXForwardedProto               = "X-Forwarded-Proto"
 	HeaderXHTTPMethodOverride           = "X-HTTP-Method-Override"
 	HeaderXForwardedFor                 = "X-Forwarded-For"
+	HeaderForwarded                     = "Forwarded"
 	HeaderXRealIP                       = "X-Real-IP"
+	HeaderXRequestID                    = "X-Request-ID"
 	HeaderServer                        = "Server"
 	HeaderOrigin                        = "Origin"
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -172,6 +186,11 @@ const (
 	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
 	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
 
+	// Rate limiting
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+
 	// Security
 	HeaderStrictTransportSecurity = "Strict-Transport-Security"
 	HeaderXContentTypeOptions     = "X-Content-Type-Options"
@@ -198,10 +217,14 @@ var (
 // Errors
 var (
 	ErrUnsupportedMediaType        = NewHTTPError(http.StatusUnsupportedMediaType)
+	ErrNotModified                 = NewHTTPError(http.StatusNotModified)
+	ErrPreconditionFailed          = NewHTTPError(http.StatusPreconditionFailed)
 	ErrNotFound                    = NewHTTPError(http.StatusNotFound)
 	ErrUnauthorized                = NewHTTPError(http.StatusUnauthorized)
 	ErrMethodNotAllowed            = NewHTTPError(http.StatusMethodNotAllowed)
 	ErrStatusRequestEntityTooLarge = NewHTTPError(http.StatusRequestEntityTooLarge)
+	ErrTooManyRequests             = NewHTTPError(http.StatusTooManyRequests)
+	ErrServiceUnavailable          = NewHTTPError(http.StatusServiceUnavailable)
 	ErrRendererNotRegistered       = errors.New("renderer not registered")
 	ErrInvalidRedirectCode         = errors.New("invalid redirect status code")
 	ErrCookieNotFound              = errors.New("cookie not found")
@@ -229,6 +252,8 @@ func New() (e *Vodka) {
 	// Defaults
 	e.SetHTTPErrorHandler(e.DefaultHTTPErrorHandler)
 	e.SetBinder(&binder{})
+	e.SetBodyBufferSize(DefaultBodyBufferSize)
+	e.SetMaxBodySize(DefaultMaxBodySize)
 	l := glog.New("vodka")
 	l.SetLevel(glog.OFF)
 	e.SetLogger(l)
@@ -273,7 +298,9 @@ func (e *Vodka) SetLogLevel(l glog.Lvl) {
 	e.logger.SetLevel(l)
 }
 
-// DefaultHTTPErrorHandler invokes the default HTTP error handler.
+// DefaultHTTPErrorHandler invokes the default HTTP error handler. Errors are
+// logged, except `ErrNotModified` and `ErrPreconditionFailed`, the responses to
+// conditional requests.
 func (e *Vodka) DefaultHTTPErrorHandler(err error, c Context) {
 	code := http.StatusInternalServerError
 	msg := http.StatusText(code)
@@ -285,12 +312,20 @@ func (e *Vodka) DefaultHTTPErrorHandler(err error, c Context) {
 		msg = err.Error()
 	}
 	if !c.Response().Committed() {
-		if c.Request().Method() == HEAD { // Issue #608
+		if c.Request().Method() == HEAD || code == http.StatusNotModified { // Issue #608
 			c.NoContent(code)
 		} else {
 			c.String(code, msg)
 		}
 	}
+	if err == ErrNotModified || err == ErrPreconditionFailed {
+		// Responses to conditional requests, see `Context#CheckPreconditions()`
+		return
+	}
+	if id := RequestID(c); id != "" {
+		e.logger.Errorf("[%s] %v", id, err)
+		return
+	}
 	e.logger.Error(err)
 }
 
@@ -309,6 +344,44 @@ func (e *Vodka) Binder() Binder {
 	return e.binder
 }
 
+// SetIPExtractor registers the function used by `Context#RealIP()` to extract the
+// client IP address. By default, or if nil, `ExtractIPDirect()` is used and the
+// proxy headers are ignored, as any client can set them. Trusting them is opt-in,
+// e.g. with `ExtractIPFromXFFHeader()` when running behind proxies.
+func (e *Vodka) SetIPExtractor(extractor IPExtractor) {
+	e.ipExtractor = extractor
+}
+
+// IPExtractor returns the IP extractor.
+func (e *Vodka) IPExtractor() IPExtractor {
+	return e.ipExtractor
+}
+
+// SetBodyBufferSize sets the size up to which `Context#BodyBytes()` keeps request
+// bodies in memory, larger bodies are spilled to a temporary file. Default value
+// is `DefaultBodyBufferSize`.
+func (e *Vodka) SetBodyBufferSize(size int64) {
+	e.bodyBufferSize = size
+}
+
+// BodyBufferSize returns the size up to which request bodies are kept in memory.
+func (e *Vodka) BodyBufferSize() int64 {
+	return e.bodyBufferSize
+}
+
+// SetMaxBodySize sets the maximum size of request bodies read by
+// `Context#BodyBytes()`, it returns `ErrStatusRequestEntityTooLarge` for larger
+// ones. Zero means unlimited. Default value is `DefaultMaxBodySize`.
+func (e *Vodka) SetMaxBodySize(size int64) {
+	e.maxBodySize = size
+}
+
+// MaxBodySize returns the maximum size of request bodies read by
+// `Context#BodyBytes()`.
+func (e *Vodka) MaxBodySize() int64 {
+	return e.maxBodySize
+}
+
 // SetRenderer registers an HTML template renderer. It's invoked by `Context#Render()`.
 func (e *Vodka) SetRenderer(r Renderer) {
 	e.renderer = r
@@ -537,6 +610,9 @@ func (e *Vodka) AcquireContext() Context {
 // ReleaseContext returns the `Context` instance back to the pool.
 // You must call it after `AcquireContext()`.
 func (e *Vodka) ReleaseContext(c Context) {
+	if c, ok := c.(*context); ok {
+		c.release()
+	}
 	e.pool.Put(c)
 }
 
@@ -566,24 +642,115 @@ func (e *Vodka) ServeHTTP(req engine.Request, res engine.Response) {
 		e.httpErrorHandler(err, c)
 	}
 
+	c.release()
 	e.pool.Put(c)
 }
 
 // Run starts the HTTP server.
 func (e *Vodka) Run(s engine.Server) error {
-	e.server = s
-	s.SetHandler(e)
-	s.SetLogger(e.logger)
+	return e.RunAll(s)
+}
+
+// RunAll starts all the provided HTTP servers, e.g. HTTP and HTTPS or a Unix
+// socket alongside TCP, serving the same Vodka instance. Every listener is bound
+// before any of them starts serving, so if one of them fails to bind the others
+// are closed and the error is returned right away. RunAll blocks until one of
+// the servers stops, then stops the rest and returns the first error.
+func (e *Vodka) RunAll(servers ...engine.Server) error {
+	if len(servers) == 0 {
+		return errors.New("vodka: no server to run")
+	}
+	e.serversMu.Lock()
+	e.servers = servers
+	e.serversMu.Unlock()
+	e.setDebugLogLevel()
+
+	for i, s := range servers {
+		if err := e.listen(s); err != nil {
+			for _, s := range servers[:i] {
+				s.Stop()
+			}
+			return err
+		}
+	}
+
+	errs := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s engine.Server) {
+			errs <- s.Start()
+		}(s)
+	}
+	err := <-errs
+	e.Stop()
+	for i := 1; i < len(servers); i++ {
+		<-errs
+	}
+	return err
+}
+
+// Start starts the HTTP server in the background and returns once it is
+// listening, `engine.Server#Addr()` then returns the bound address, e.g. the
+// port picked for ":0". `engine.Server#Done()` receives the error the server
+// stops with. Stop it with `Vodka#Stop()`.
+func (e *Vodka) Start(s engine.Server) error {
+	e.setDebugLogLevel()
+	if err := e.listen(s); err != nil {
+		return err
+	}
+	e.serversMu.Lock()
+	e.servers = append(e.servers, s)
+	e.serversMu.Unlock()
+
+	go s.Start()
+	select {
+	case <-s.Ready():
+		return nil
+	case err := <-s.Done():
+		return err
+	}
+}
+
+func (e *Vodka) setDebugLogLevel() {
 	if e.Debug() {
 		e.SetLogLevel(glog.DEBUG)
 		e.logger.Debug("running in debug mode")
 	}
-	return s.Start()
 }
 
-// Stop stops the HTTP server.
-func (e *Vodka) Stop() error {
-	return e.server.Stop()
+// listen binds the listener of the server to serve this instance.
+func (e *Vodka) listen(s engine.Server) error {
+	s.SetHandler(e)
+	s.SetLogger(e.logger)
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	e.logger.Infof("http server started on %s", s.Addr())
+	return nil
+}
+
+// Addrs returns the network addresses the running HTTP servers are bound to.
+func (e *Vodka) Addrs() []net.Addr {
+	e.serversMu.Lock()
+	defer e.serversMu.Unlock()
+	addrs := []net.Addr{}
+	for _, s := range e.servers {
+		if a := s.Addr(); a != nil {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// Stop stops all the running HTTP servers and returns the first error.
+func (e *Vodka) Stop() (err error) {
+	e.serversMu.Lock()
+	defer e.serversMu.Unlock()
+	for _, s := range e.servers {
+		if er := s.Stop(); er != nil && err == nil {
+			err = er
+		}
+	}
+	return
 }
 
 // NewHTTPError creates a new HTTPError instance.
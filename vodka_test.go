@@ -7,13 +7,18 @@ import (
 	"net/http"
 	"testing"
 
+	"net"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"errors"
 
-	"github.com/insionng/vodka/test"
+	"github.com/insionng/vodka/engine"
 	"github.com/insionng/vodka/libraries/gommon/log"
+	vlog "github.com/insionng/vodka/log"
+	"github.com/insionng/vodka/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,8 +50,22 @@ func TestVodka(t *testing.T) {
 	assert.True(t, e.debug)
 
 	// DefaultHTTPErrorHandler
+	buf := new(bytes.Buffer)
+	e.SetLogOutput(buf)
+	e.SetLogLevel(log.ERROR)
 	e.DefaultHTTPErrorHandler(errors.New("error"), c)
 	assert.Equal(t, http.StatusInternalServerError, rec.Status())
+	assert.Contains(t, buf.String(), "error")
+
+	// Conditional requests aren't logged
+	buf.Reset()
+	for _, err := range []error{ErrNotModified, ErrPreconditionFailed} {
+		rec = test.NewResponseRecorder()
+		c = e.NewContext(req, rec)
+		e.DefaultHTTPErrorHandler(err, c)
+		assert.Equal(t, err.(*HTTPError).Code, rec.Status())
+	}
+	assert.Empty(t, buf.String())
 }
 
 func TestVodkaStatic(t *testing.T) {
@@ -348,6 +367,125 @@ func TestVodkaLogger(t *testing.T) {
 	assert.Equal(t, l.Level(), log.OFF)
 }
 
+type fakeServer struct {
+	*engine.ServerState
+	listenErr error
+	addr      net.Addr
+	mutex     sync.Mutex
+	listening bool
+	stopped   chan struct{}
+}
+
+func newFakeServer(addr string, listenErr error) *fakeServer {
+	a, _ := net.ResolveTCPAddr("tcp", addr)
+	return &fakeServer{
+		ServerState: engine.NewServerState(),
+		listenErr:   listenErr,
+		addr:        a,
+		stopped:     make(chan struct{}),
+	}
+}
+
+func (s *fakeServer) SetHandler(engine.Handler) {}
+
+func (s *fakeServer) SetLogger(vlog.Logger) {}
+
+func (s *fakeServer) Listen() error {
+	if s.listenErr != nil {
+		return s.listenErr
+	}
+	s.mutex.Lock()
+	s.listening = true
+	s.mutex.Unlock()
+	s.SetReady()
+	return nil
+}
+
+func (s *fakeServer) Addr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.listening {
+		return nil
+	}
+	return s.addr
+}
+
+func (s *fakeServer) Start() error {
+	<-s.stopped
+	err := errors.New("stopped")
+	s.SetDone(err)
+	return err
+}
+
+func (s *fakeServer) Stop() error {
+	select {
+	case <-s.stopped:
+	default:
+		close(s.stopped)
+	}
+	return nil
+}
+
+func TestVodkaRunAll(t *testing.T) {
+	e := New()
+	s1 := newFakeServer("127.0.0.1:80", nil)
+	s2 := newFakeServer("127.0.0.1:443", nil)
+	done := make(chan error)
+	go func() {
+		done <- e.RunAll(s1, s2)
+	}()
+	for len(e.Addrs()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []net.Addr{s1.addr, s2.addr}, e.Addrs())
+
+	// Stopping one server stops all of them
+	s1.Stop()
+	assert.EqualError(t, <-done, "stopped")
+	<-s2.stopped
+
+	// Bind failure
+	e = New()
+	s1 = newFakeServer("127.0.0.1:80", nil)
+	s2 = newFakeServer("127.0.0.1:443", errors.New("bind failed"))
+	assert.EqualError(t, e.RunAll(s1, s2), "bind failed")
+	<-s1.stopped
+
+	assert.Error(t, e.RunAll())
+}
+
+func TestVodkaStart(t *testing.T) {
+	e := New()
+	e.GET("/", func(c Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+	s := test.New("127.0.0.1:0")
+	if !assert.NoError(t, e.Start(s)) {
+		return
+	}
+	select {
+	case <-s.Ready():
+	default:
+		t.Error("server not ready")
+	}
+	if assert.NotNil(t, s.Addr()) {
+		assert.Equal(t, []net.Addr{s.Addr()}, e.Addrs())
+		r, err := http.Get("http://" + s.Addr().String())
+		if assert.NoError(t, err) {
+			b, _ := ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			assert.Equal(t, "OK", string(b))
+		}
+	}
+	assert.NoError(t, e.Stop())
+	assert.NoError(t, <-s.Done())
+
+	// Bind failure
+	e = New()
+	assert.EqualError(t, e.Start(newFakeServer("127.0.0.1:80", errors.New("bind failed"))), "bind failed")
+	assert.Empty(t, e.Addrs())
+}
+
 func testMethod(t *testing.T, method, path string, e *Vodka) {
 	m := fmt.Sprintf("%c%s", method[0], strings.ToLower(method[1:]))
 	p := reflect.ValueOf(path)
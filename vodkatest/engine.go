@@ -0,0 +1,140 @@
+package vodkatest
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/insionng/vodka"
+	"github.com/insionng/vodka/engine/fasthttp"
+	"github.com/insionng/vodka/engine/standard"
+	"github.com/insionng/vodka/test"
+	fast "github.com/valyala/fasthttp"
+)
+
+type (
+	// Engine serves a `vodka.Vodka` instance in memory with one of the engines.
+	Engine struct {
+		// Name of the engine, used as subtest name by `Run()`.
+		Name string
+
+		// Transport returns an `http.RoundTripper` passing requests to the engine
+		// server, without opening a connection.
+		Transport func(*vodka.Vodka) http.RoundTripper
+	}
+
+	roundTripperFunc func(*http.Request) (*http.Response, error)
+)
+
+const (
+	// RemoteAddr is the client address of all requests.
+	RemoteAddr = "192.0.2.1:1234"
+)
+
+var (
+	// Standard serves requests with `engine/standard`.
+	Standard = Engine{
+		Name: "standard",
+		Transport: func(e *vodka.Vodka) http.RoundTripper {
+			s := standard.New("")
+			s.SetHandler(e)
+			s.SetLogger(e.Logger())
+			return serveHTTP(s.ServeHTTP)
+		},
+	}
+
+	// FastHTTP serves requests with `engine/fasthttp`.
+	FastHTTP = Engine{
+		Name: "fasthttp",
+		Transport: func(e *vodka.Vodka) http.RoundTripper {
+			s := fasthttp.New("")
+			s.SetHandler(e)
+			s.SetLogger(e.Logger())
+			return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				return serveFastHTTP(s, r)
+			})
+		},
+	}
+
+	// Test serves requests with the `test` engine.
+	Test = Engine{
+		Name: "test",
+		Transport: func(e *vodka.Vodka) http.RoundTripper {
+			s := test.New("")
+			s.SetHandler(e)
+			return serveHTTP(s.ServeHTTP)
+		},
+	}
+
+	// Engines lists all engines, see `Run()`.
+	Engines = []Engine{Standard, FastHTTP, Test}
+)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// serveHTTP returns an `http.RoundTripper` for engines based on net/http.
+func serveHTTP(h http.HandlerFunc) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		req := httptest.NewRequest(r.Method, r.URL.RequestURI(), r.Body)
+		req = req.WithContext(r.Context())
+		req.Host = r.Host
+		if req.Host == "" {
+			req.Host = r.URL.Host
+		}
+		req.RemoteAddr = RemoteAddr
+		req.ContentLength = r.ContentLength
+		for k, vv := range r.Header {
+			req.Header[k] = vv
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		res := rec.Result()
+		res.Request = r
+		return res, nil
+	})
+}
+
+// serveFastHTTP passes r to s in the HTTP/1.1 wire format, which is what
+// fasthttp parses, and reads the response back the same way.
+func serveFastHTTP(s *fasthttp.Server, r *http.Request) (*http.Response, error) {
+	wr := *r
+	if r.Body != nil {
+		// Send a Content-Length instead of a chunked body
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		wr.Body = ioutil.NopCloser(bytes.NewReader(b))
+		wr.ContentLength = int64(len(b))
+	}
+	buf := new(bytes.Buffer)
+	if err := wr.Write(buf); err != nil {
+		return nil, err
+	}
+	// `fasthttp.Request#Read()` would parse a multipart body into a form which
+	// `fasthttp.RequestCtx#Init()` doesn't copy, so the body is set directly.
+	br := bufio.NewReader(buf)
+	req := new(fast.Request)
+	if err := req.Header.Read(br); err != nil {
+		return nil, err
+	}
+	b, _ := ioutil.ReadAll(br)
+	req.SetBody(b)
+	addr, _ := net.ResolveTCPAddr("tcp", RemoteAddr)
+	ctx := new(fast.RequestCtx)
+	ctx.Init(req, addr, nil)
+	s.ServeHTTP(ctx)
+
+	buf.Reset()
+	w := bufio.NewWriter(buf)
+	if err := ctx.Response.Write(w); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return http.ReadResponse(bufio.NewReader(buf), r)
+}
@@ -0,0 +1,75 @@
+package vodkatest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath returns the value at path in v, decoded by `encoding/json` into an
+// `interface{}`. See `Response#JSONPath()` for the supported syntax.
+func jsonPath(v interface{}, path string) (interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	p := path[1:]
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			i := strings.IndexAny(p, ".[")
+			if i < 0 {
+				i = len(p)
+			}
+			name := p[:i]
+			if name == "" {
+				return nil, fmt.Errorf("empty member name")
+			}
+			p = p[i:]
+			var err error
+			if v, err = member(v, name); err != nil {
+				return nil, err
+			}
+		case '[':
+			i := strings.IndexByte(p, ']')
+			if i < 0 {
+				return nil, fmt.Errorf("missing ]")
+			}
+			s := p[1:i]
+			p = p[i+1:]
+			if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+				var err error
+				if v, err = member(v, s[1:len(s)-1]); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %s", s)
+			}
+			a, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("[%d] is not an array", n)
+			}
+			if n < 0 || n >= len(a) {
+				return nil, fmt.Errorf("index %d out of range", n)
+			}
+			v = a[n]
+		default:
+			return nil, fmt.Errorf("unexpected %q", p[0])
+		}
+	}
+	return v, nil
+}
+
+func member(v interface{}, name string) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: not an object", name)
+	}
+	if v, ok = m[name]; !ok {
+		return nil, fmt.Errorf("%s: member not found", name)
+	}
+	return v, nil
+}
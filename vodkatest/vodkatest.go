@@ -0,0 +1,446 @@
+// Package vodkatest drives a `vodka.Vodka` instance end-to-end and in memory,
+// through `Pre` middleware, routing and the engine, with a fluent client:
+//
+//	vt := vodkatest.New(t, e)
+//	vt.GET("/users/1").WithHeader("Accept", "application/json").Expect().
+//		Status(http.StatusOK).
+//		JSONPath("$.name", "bob")
+//
+// `Run()` runs the same test against each engine.
+package vodkatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/insionng/vodka"
+)
+
+type (
+	// Config defines the config for the test client.
+	Config struct {
+		// Engine serves the requests.
+		// Optional. Default value `Standard`.
+		Engine Engine
+
+		// BaseURL is the URL requests are made to, it sets the scheme and host.
+		// Optional. Default value "http://example.com".
+		BaseURL string
+
+		// FollowRedirects makes the client follow redirects, otherwise the
+		// redirect response itself is returned.
+		// Optional. Default value false.
+		FollowRedirects bool
+
+		// DisableCookieJar disables storing cookies set by responses.
+		// Optional. Default value false.
+		DisableCookieJar bool
+	}
+
+	// Client makes requests to a `vodka.Vodka` instance.
+	Client struct {
+		t       testing.TB
+		client  *http.Client
+		baseURL *url.URL
+	}
+
+	// Request is a request under construction, see `Client#Request()`.
+	Request struct {
+		t      testing.TB
+		client *Client
+		method string
+		path   string
+		header http.Header
+		query  url.Values
+		form   url.Values
+		files  []file
+		body   io.Reader
+		err    error
+	}
+
+	// Response wraps the response to a request with chainable assertions.
+	Response struct {
+		t        testing.TB
+		response *http.Response
+		body     []byte
+	}
+
+	file struct {
+		field    string
+		filename string
+		content  []byte
+	}
+)
+
+var (
+	// DefaultConfig is the default test client config.
+	DefaultConfig = Config{
+		Engine:  Standard,
+		BaseURL: "http://example.com",
+	}
+)
+
+// New returns a test client for e using the `Standard` engine.
+func New(t testing.TB, e *vodka.Vodka) *Client {
+	return NewWithConfig(t, e, DefaultConfig)
+}
+
+// NewWithConfig returns a test client for e from config.
+// See: `New()`.
+func NewWithConfig(t testing.TB, e *vodka.Vodka, config Config) *Client {
+	// Defaults
+	if config.Engine.Transport == nil {
+		config.Engine = DefaultConfig.Engine
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultConfig.BaseURL
+	}
+
+	u, err := url.Parse(config.BaseURL)
+	if err != nil {
+		t.Fatalf("vodkatest: invalid base url: %v", err)
+	}
+	c := &Client{
+		t:       t,
+		baseURL: u,
+		client: &http.Client{
+			Transport: config.Engine.Transport(e),
+		},
+	}
+	if !config.DisableCookieJar {
+		c.client.Jar, _ = cookiejar.New(nil)
+	}
+	if !config.FollowRedirects {
+		c.client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return c
+}
+
+// Run runs f as a subtest for each engine in `Engines`, with a new test client
+// created by `NewWithConfig()` with the engine set.
+func Run(t *testing.T, e *vodka.Vodka, f func(t *testing.T, vt *Client)) {
+	RunWithConfig(t, e, DefaultConfig, f)
+}
+
+// RunWithConfig is like `Run()`, with the test clients created from config.
+func RunWithConfig(t *testing.T, e *vodka.Vodka, config Config, f func(t *testing.T, vt *Client)) {
+	for _, engine := range Engines {
+		config.Engine = engine
+		t.Run(engine.Name, func(t *testing.T) {
+			f(t, NewWithConfig(t, e, config))
+		})
+	}
+}
+
+// Cookies returns the cookies in the cookie jar for the base URL.
+func (c *Client) Cookies() []*http.Cookie {
+	if c.client.Jar == nil {
+		return nil
+	}
+	return c.client.Jar.Cookies(c.baseURL)
+}
+
+// Request returns a new request for method and path. path is relative to the
+// base URL and may contain a query string.
+func (c *Client) Request(method, path string) *Request {
+	return &Request{
+		t:      c.t,
+		client: c,
+		method: method,
+		path:   path,
+		header: http.Header{},
+		query:  url.Values{},
+		form:   url.Values{},
+	}
+}
+
+// CONNECT returns a new CONNECT request for path.
+func (c *Client) CONNECT(path string) *Request {
+	return c.Request(vodka.CONNECT, path)
+}
+
+// DELETE returns a new DELETE request for path.
+func (c *Client) DELETE(path string) *Request {
+	return c.Request(vodka.DELETE, path)
+}
+
+// GET returns a new GET request for path.
+func (c *Client) GET(path string) *Request {
+	return c.Request(vodka.GET, path)
+}
+
+// HEAD returns a new HEAD request for path.
+func (c *Client) HEAD(path string) *Request {
+	return c.Request(vodka.HEAD, path)
+}
+
+// OPTIONS returns a new OPTIONS request for path.
+func (c *Client) OPTIONS(path string) *Request {
+	return c.Request(vodka.OPTIONS, path)
+}
+
+// PATCH returns a new PATCH request for path.
+func (c *Client) PATCH(path string) *Request {
+	return c.Request(vodka.PATCH, path)
+}
+
+// POST returns a new POST request for path.
+func (c *Client) POST(path string) *Request {
+	return c.Request(vodka.POST, path)
+}
+
+// PUT returns a new PUT request for path.
+func (c *Client) PUT(path string) *Request {
+	return c.Request(vodka.PUT, path)
+}
+
+// WithHeader adds a request header.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter.
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithCookie adds a cookie to the request, besides those in the cookie jar.
+func (r *Request) WithCookie(name, value string) *Request {
+	c := &http.Cookie{Name: name, Value: value}
+	if v := r.header.Get(vodka.HeaderCookie); v != "" {
+		r.header.Set(vodka.HeaderCookie, v+"; "+c.String())
+	} else {
+		r.header.Set(vodka.HeaderCookie, c.String())
+	}
+	return r
+}
+
+// WithBody sets the request body.
+func (r *Request) WithBody(body io.Reader) *Request {
+	r.body = body
+	return r
+}
+
+// WithJSON sets the request body to v encoded as JSON.
+func (r *Request) WithJSON(v interface{}) *Request {
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.header.Set(vodka.HeaderContentType, vodka.MIMEApplicationJSONCharsetUTF8)
+	return r.WithBody(bytes.NewReader(b))
+}
+
+// WithFormField adds a form field. The request body is URL encoded, or
+// multipart if files are added.
+func (r *Request) WithFormField(key, value string) *Request {
+	r.form.Add(key, value)
+	return r
+}
+
+// WithFile adds a file to the multipart request body.
+func (r *Request) WithFile(field, filename string, content []byte) *Request {
+	r.files = append(r.files, file{field: field, filename: filename, content: content})
+	return r
+}
+
+// Expect sends the request and returns its response. The test fails if the
+// request can't be sent.
+func (r *Request) Expect() *Response {
+	r.t.Helper()
+	req, err := r.build()
+	if err != nil {
+		r.t.Fatalf("vodkatest: %s %s: %v", r.method, r.path, err)
+	}
+	res, err := r.client.client.Do(req)
+	if err != nil {
+		r.t.Fatalf("vodkatest: %s %s: %v", r.method, r.path, err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		r.t.Fatalf("vodkatest: %s %s: %v", r.method, r.path, err)
+	}
+	return &Response{t: r.t, response: res, body: b}
+}
+
+func (r *Request) build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.body != nil && (len(r.form) > 0 || len(r.files) > 0) {
+		return nil, errors.New("both body and form set")
+	}
+	u, err := r.client.baseURL.Parse(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.query) > 0 {
+		q := u.Query()
+		for k, vv := range r.query {
+			for _, v := range vv {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	body := r.body
+	header := http.Header{}
+	if len(r.files) > 0 {
+		buf := new(bytes.Buffer)
+		mw := multipart.NewWriter(buf)
+		for k, vv := range r.form {
+			for _, v := range vv {
+				mw.WriteField(k, v)
+			}
+		}
+		for _, f := range r.files {
+			w, err := mw.CreateFormFile(f.field, f.filename)
+			if err != nil {
+				return nil, err
+			}
+			w.Write(f.content)
+		}
+		if err = mw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf
+		header.Set(vodka.HeaderContentType, mw.FormDataContentType())
+	} else if len(r.form) > 0 {
+		body = strings.NewReader(r.form.Encode())
+		header.Set(vodka.HeaderContentType, vodka.MIMEApplicationForm)
+	}
+
+	req, err := http.NewRequest(r.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vv := range header {
+		req.Header[k] = vv
+	}
+	for k, vv := range r.header {
+		req.Header[k] = vv
+	}
+	return req, nil
+}
+
+// Raw returns the `*http.Response`, its body is already read, see `Response#Bytes()`.
+func (r *Response) Raw() *http.Response {
+	return r.response
+}
+
+// Bytes returns the response body.
+func (r *Response) Bytes() []byte {
+	return r.body
+}
+
+// DecodeJSON decodes the JSON response body into v. The test fails on error.
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		r.t.Errorf("vodkatest: invalid JSON response %q: %v", r.body, err)
+	}
+	return r
+}
+
+// Status asserts the response status code.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.response.StatusCode != code {
+		r.t.Errorf("vodkatest: expected status %d, got %d", code, r.response.StatusCode)
+	}
+	return r
+}
+
+// Header asserts the first value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if v := r.response.Header.Get(key); v != value {
+		r.t.Errorf("vodkatest: expected header %s %q, got %q", key, value, v)
+	}
+	return r
+}
+
+// Body asserts the response body.
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if string(r.body) != body {
+		r.t.Errorf("vodkatest: expected body %q, got %q", body, r.body)
+	}
+	return r
+}
+
+// BodyContains asserts the response body contains s.
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+	if !bytes.Contains(r.body, []byte(s)) {
+		r.t.Errorf("vodkatest: expected body to contain %q, got %q", s, r.body)
+	}
+	return r
+}
+
+// JSON asserts the response body is JSON equal to v encoded as JSON.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+	return r.JSONPath("$", v)
+}
+
+// JSONPath asserts the value at path of the JSON response body equals
+// expected. Supported is a subset of JSONPath: the root `$`, object members as
+// `.name` or `['name']` and array elements as `[index]`, e.g.
+// `$.users[0].name`. expected is compared after encoding it as JSON.
+func (r *Response) JSONPath(path string, expected interface{}) *Response {
+	r.t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(r.body, &v); err != nil {
+		r.t.Errorf("vodkatest: invalid JSON response %q: %v", r.body, err)
+		return r
+	}
+	actual, err := jsonPath(v, path)
+	if err != nil {
+		r.t.Errorf("vodkatest: %s: %v", path, err)
+		return r
+	}
+	b, err := json.Marshal(expected)
+	if err != nil {
+		r.t.Errorf("vodkatest: %s: %v", path, err)
+		return r
+	}
+	var e interface{}
+	json.Unmarshal(b, &e)
+	if !reflect.DeepEqual(e, actual) {
+		r.t.Errorf("vodkatest: expected %s to be %v, got %v", path, e, actual)
+	}
+	return r
+}
+
+// Cookie asserts the response sets the cookie name to value.
+func (r *Response) Cookie(name, value string) *Response {
+	r.t.Helper()
+	for _, c := range r.response.Cookies() {
+		if c.Name == name {
+			if c.Value != value {
+				r.t.Errorf("vodkatest: expected cookie %s %q, got %q", name, value, c.Value)
+			}
+			return r
+		}
+	}
+	r.t.Errorf("vodkatest: expected cookie %s, not set", name)
+	return r
+}
@@ -0,0 +1,171 @@
+package vodkatest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/insionng/vodka"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   string `json:"id" form:"id"`
+	Name string `json:"name" form:"name"`
+}
+
+func newVodka() *vodka.Vodka {
+	e := vodka.New()
+	e.Pre(func(next vodka.HandlerFunc) vodka.HandlerFunc {
+		return func(c vodka.Context) error {
+			c.Response().Header().Set("X-Pre", "vodka")
+			return next(c)
+		}
+	})
+	e.GET("/users/:id", func(c vodka.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"id":    c.Param("id"),
+			"name":  "bob",
+			"q":     c.QueryParam("q"),
+			"roles": []string{"admin", "user"},
+		})
+	})
+	e.POST("/users", func(c vodka.Context) error {
+		u := new(user)
+		if err := c.Bind(u); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, u)
+	})
+	e.POST("/login", func(c vodka.Context) error {
+		cookie := new(vodka.Cookie)
+		cookie.SetName("session")
+		cookie.SetValue(c.FormValue("name"))
+		cookie.SetPath("/")
+		c.SetCookie(cookie)
+		return c.Redirect(http.StatusFound, "/me")
+	})
+	e.GET("/me", func(c vodka.Context) error {
+		cookie, err := c.Cookie("session")
+		if err != nil {
+			return vodka.ErrUnauthorized
+		}
+		return c.String(http.StatusOK, cookie.Value())
+	})
+	e.POST("/echo", func(c vodka.Context) error {
+		b, err := c.BodyBytes()
+		if err != nil {
+			return err
+		}
+		u := new(user)
+		if err = c.Bind(u); err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, u.Name+":"+string(b))
+	})
+	e.POST("/upload", func(c vodka.Context) error {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return err
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		return c.String(http.StatusOK, c.FormValue("title")+":"+fh.Filename+":"+string(b))
+	})
+	return e
+}
+
+func TestClient(t *testing.T) {
+	Run(t, newVodka(), func(t *testing.T, vt *Client) {
+		vt.GET("/users/1").WithQuery("q", "vodka").Expect().
+			Status(http.StatusOK).
+			Header("X-Pre", "vodka").
+			Header(vodka.HeaderContentType, vodka.MIMEApplicationJSONCharsetUTF8).
+			JSONPath("$.id", "1").
+			JSONPath("$.name", "bob").
+			JSONPath("$['q']", "vodka").
+			JSONPath("$.roles[1]", "user").
+			JSONPath("$.roles", []string{"admin", "user"})
+
+		vt.POST("/users").WithJSON(user{Name: "Jon Snow"}).Expect().
+			Status(http.StatusCreated).
+			JSON(user{Name: "Jon Snow"})
+
+		vt.GET("/nothing").Expect().Status(http.StatusNotFound)
+	})
+}
+
+func TestClientCookies(t *testing.T) {
+	Run(t, newVodka(), func(t *testing.T, vt *Client) {
+		vt.GET("/me").Expect().Status(http.StatusUnauthorized)
+		vt.GET("/me").WithCookie("session", "arya").Expect().Body("arya")
+
+		// Cookie jar
+		vt.POST("/login").WithFormField("name", "jon").Expect().
+			Status(http.StatusFound).
+			Header(vodka.HeaderLocation, "/me").
+			Cookie("session", "jon")
+		if assert.Len(t, vt.Cookies(), 1) {
+			assert.Equal(t, "jon", vt.Cookies()[0].Value)
+		}
+		vt.GET("/me").Expect().Status(http.StatusOK).Body("jon")
+	})
+
+	vt := NewWithConfig(t, newVodka(), Config{DisableCookieJar: true})
+	vt.POST("/login").WithFormField("name", "jon").Expect().Cookie("session", "jon")
+	assert.Empty(t, vt.Cookies())
+	vt.GET("/me").Expect().Status(http.StatusUnauthorized)
+}
+
+func TestClientRedirect(t *testing.T) {
+	RunWithConfig(t, newVodka(), Config{FollowRedirects: true}, func(t *testing.T, vt *Client) {
+		vt.POST("/login").WithFormField("name", "jon").Expect().
+			Status(http.StatusOK).
+			Body("jon")
+	})
+}
+
+func TestClientMultipart(t *testing.T) {
+	Run(t, newVodka(), func(t *testing.T, vt *Client) {
+		vt.POST("/upload").
+			WithFormField("title", "notes").
+			WithFile("file", "notes.txt", []byte("winter is coming")).
+			Expect().
+			Status(http.StatusOK).
+			Body("notes:notes.txt:winter is coming").
+			BodyContains("winter")
+	})
+}
+
+func TestClientBodyBytes(t *testing.T) {
+	Run(t, newVodka(), func(t *testing.T, vt *Client) {
+		vt.POST("/echo").WithFormField("name", "jon").Expect().Body("jon:name=jon")
+		vt.POST("/echo").WithJSON(user{Name: "jon"}).Expect().Body(`jon:{"id":"","name":"jon"}`)
+	})
+}
+
+func TestJSONPath(t *testing.T) {
+	var v interface{} = map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "bob"},
+		},
+	}
+	for path, expected := range map[string]interface{}{
+		"$":                  v,
+		"$.users[0].name":    "bob",
+		"$['users'][0].name": "bob",
+	} {
+		actual, err := jsonPath(v, path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, expected, actual, path)
+		}
+	}
+	for _, path := range []string{"users", "$.", "$.users[1]", "$.users.name", "$.users[x]", "$[0]", "$.users[0"} {
+		_, err := jsonPath(v, path)
+		assert.Error(t, err, path)
+	}
+}
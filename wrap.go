@@ -0,0 +1,299 @@
+package vodka
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/insionng/vodka/engine"
+)
+
+type (
+	// stdRequester is implemented by engine requests backed by `*http.Request`,
+	// e.g. `standard.Request`.
+	stdRequester interface {
+		StdRequest() *http.Request
+	}
+
+	// stdResponseWriter is implemented by engine responses backed by
+	// `http.ResponseWriter`, e.g. `standard.Response`.
+	stdResponseWriter interface {
+		StdResponseWriter() http.ResponseWriter
+	}
+
+	// responseWriter adapts `engine.Response` to `http.ResponseWriter`. Without a
+	// native response writer, headers are kept in a map which is synchronized
+	// with the engine response whenever control passes between net/http and
+	// vodka code.
+	responseWriter struct {
+		res    engine.Response
+		native http.ResponseWriter
+		header http.Header
+		synced http.Header
+		writer io.Writer
+		// wrapped is true while the response writer set on `engine.Response`
+		// writes into this one, see `WrapHTTPMiddleware()`.
+		wrapped bool
+	}
+)
+
+// WrapHTTPHandler wraps `http.Handler` into `vodka.HandlerFunc`. It works with
+// every engine: engines backed by net/http pass their native request, for the
+// others the request is converted, with `Context#StdContext()` as its context
+// in both cases. Writing to the response, headers, cookies, trailers,
+// `http.Flusher`, `http.Hijacker` and `http.Pusher` are mapped onto
+// `engine.Response`.
+func WrapHTTPHandler(h http.Handler) HandlerFunc {
+	return func(c Context) error {
+		r, err := newStdRequest(c)
+		if err != nil {
+			return err
+		}
+		w := newResponseWriter(c.Response())
+		h.ServeHTTP(w, r)
+		w.finish()
+		return nil
+	}
+}
+
+// WrapHTTPMiddleware wraps `func(http.Handler) http.Handler` into
+// `vodka.MiddlewareFunc`. It works with every engine, like `WrapHTTPHandler()`.
+// If the middleware replaces the `http.ResponseWriter`, the response of the next
+// handler is written through it. If it replaces the `*http.Request`, its context
+// and headers are passed on.
+func WrapHTTPMiddleware(m func(http.Handler) http.Handler) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c Context) (err error) {
+			r, err := newStdRequest(c)
+			if err != nil {
+				return err
+			}
+			res := c.Response()
+			w := newResponseWriter(res)
+			m(http.HandlerFunc(func(nw http.ResponseWriter, nr *http.Request) {
+				if nr != r {
+					c.SetStdContext(nr.Context())
+					if _, ok := c.Request().(stdRequester); !ok {
+						syncRequestHeader(c.Request().Header(), nr.Header)
+					}
+				}
+				w.sync()
+				if rw, ok := nw.(*responseWriter); !ok || rw != w {
+					writer := res.Writer()
+					res.SetWriter(nw)
+					w.wrapped = true
+					defer func() {
+						res.SetWriter(writer)
+						w.wrapped = false
+					}()
+				}
+				err = next(c)
+				w.sync()
+			})).ServeHTTP(w, r)
+			w.finish()
+			return
+		}
+	}
+}
+
+// newStdRequest returns the native `*http.Request` of the engine or converts the
+// request. Either way its context is `Context#StdContext()`.
+func newStdRequest(c Context) (*http.Request, error) {
+	req := c.Request()
+	if r, ok := req.(stdRequester); ok {
+		return r.StdRequest().WithContext(c.StdContext()), nil
+	}
+
+	uri := req.URI()
+	if uri == "" {
+		uri = req.URL().Path()
+		if q := req.URL().QueryString(); q != "" {
+			uri += "?" + q
+		}
+	}
+	r, err := http.NewRequest(req.Method(), uri, ioutil.NopCloser(req.Body()))
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(c.StdContext())
+	r.Proto = req.Proto()
+	r.ProtoMajor = req.ProtoMajor()
+	r.ProtoMinor = req.ProtoMinor()
+	r.Host = req.Host()
+	r.RequestURI = uri
+	r.RemoteAddr = req.RemoteAddress()
+	r.ContentLength = req.ContentLength()
+	r.TLS = req.TLSState()
+	h := req.Header()
+	for _, k := range h.Keys() {
+		r.Header[http.CanonicalHeaderKey(k)] = h.Values(k)
+	}
+	r.Header.Del("Host")
+	return r, nil
+}
+
+// syncRequestHeader applies the changes of a converted request's header to the
+// engine request.
+func syncRequestHeader(h engine.Header, header http.Header) {
+	for _, k := range h.Keys() {
+		if k = http.CanonicalHeaderKey(k); k != "Host" && header[k] == nil {
+			h.Del(k)
+		}
+	}
+	for k, vv := range header {
+		if !equalValues(vv, h.Values(k)) {
+			setValues(h, k, vv)
+		}
+	}
+}
+
+func newResponseWriter(res engine.Response) *responseWriter {
+	w := &responseWriter{
+		res:    res,
+		writer: res.Writer(),
+	}
+	if n, ok := res.(stdResponseWriter); ok {
+		w.native = n.StdResponseWriter()
+	} else {
+		w.header = http.Header{}
+		w.sync()
+	}
+	return w
+}
+
+func (w *responseWriter) Header() http.Header {
+	if w.native != nil {
+		return w.native.Header()
+	}
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.res.Committed() {
+		return
+	}
+	w.sync()
+	w.res.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.res.Committed() {
+		if w.Header().Get(HeaderContentType) == "" {
+			w.Header().Set(HeaderContentType, http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.wrapped {
+		// `engine.Response#Write()` is the caller, don't count the bytes twice.
+		return w.writer.Write(b)
+	}
+	return w.res.Write(b)
+}
+
+// Flush implements `http.Flusher`.
+func (w *responseWriter) Flush() {
+	w.sync()
+	w.res.Flush()
+}
+
+// Hijack implements `http.Hijacker`.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, rw, err := w.res.Hijack()
+	if err == engine.ErrNotSupported {
+		err = http.ErrNotSupported
+	}
+	return c, rw, err
+}
+
+// Push implements `http.Pusher`.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	var header map[string][]string
+	if opts != nil {
+		header = opts.Header
+	}
+	err := w.res.Push(target, header)
+	if err == engine.ErrNotSupported {
+		err = http.ErrNotSupported
+	}
+	return err
+}
+
+// Unwrap returns the native response writer for `http.ResponseController`.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.native
+}
+
+// sync applies the changes made through `Header()` to the engine response and
+// reloads the header from it, picking up changes made through the engine.
+func (w *responseWriter) sync() {
+	if w.native != nil {
+		return
+	}
+	h := w.res.Header()
+	for k := range w.synced {
+		if _, ok := w.header[k]; !ok {
+			h.Del(k)
+		}
+	}
+	for k, vv := range w.header {
+		if !strings.HasPrefix(k, http.TrailerPrefix) && !equalValues(vv, w.synced[k]) {
+			setValues(h, k, vv)
+		}
+	}
+
+	trailers := http.Header{}
+	for k, vv := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			trailers[k] = vv
+		}
+	}
+	for k := range w.header {
+		delete(w.header, k)
+	}
+	for _, k := range h.Keys() {
+		w.header[http.CanonicalHeaderKey(k)] = h.Values(k)
+	}
+	w.synced = make(http.Header, len(w.header))
+	for k, vv := range w.header {
+		w.synced[k] = append([]string(nil), vv...)
+	}
+	for k, vv := range trailers {
+		w.header[k] = vv
+	}
+}
+
+// finish applies the header set by the handler and sends the trailers set with
+// `http.TrailerPrefix`.
+func (w *responseWriter) finish() {
+	if w.native != nil {
+		return
+	}
+	w.sync()
+	for k, vv := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) && len(vv) > 0 {
+			w.res.SetTrailer(strings.TrimPrefix(k, http.TrailerPrefix), vv[0])
+		}
+	}
+}
+
+func setValues(h engine.Header, key string, values []string) {
+	h.Del(key)
+	for _, v := range values {
+		h.Add(key, v)
+	}
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
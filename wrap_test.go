@@ -0,0 +1,139 @@
+package vodka
+
+import (
+	"bytes"
+	kontext "context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/insionng/vodka/engine"
+	"github.com/insionng/vodka/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// genericRequest and genericResponse hide the native request and response
+	// writer, like engines not based on net/http.
+	genericRequest struct {
+		engine.Request
+	}
+
+	genericResponse struct {
+		engine.Response
+	}
+
+	wrapContextKey struct{}
+)
+
+func testWrapHTTPHandler(t *testing.T, native bool) {
+	e := New()
+	var req engine.Request = test.NewRequest(POST, "/users?id=1", strings.NewReader("Jon Snow"))
+	req.Header().Set(HeaderCookie, "session=vodka")
+	rec := test.NewResponseRecorder()
+	var res engine.Response = rec
+	if !native {
+		req = genericRequest{req}
+		res = genericResponse{res}
+	}
+	c := e.NewContext(req, res)
+	c.SetStdContext(kontext.WithValue(c.StdContext(), wrapContextKey{}, "vodka"))
+	c.Response().Header().Set("X-Vodka", "vodka")
+	h := WrapHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "vodka", r.Context().Value(wrapContextKey{}))
+		assert.Equal(t, POST, r.Method)
+		assert.Equal(t, "/users", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("id"))
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "Jon Snow", string(b))
+		if cookie, err := r.Cookie("session"); assert.NoError(t, err) {
+			assert.Equal(t, "vodka", cookie.Value)
+		}
+		assert.Equal(t, "vodka", w.Header().Get("X-Vodka"))
+		http.SetCookie(w, &http.Cookie{Name: "user", Value: "jon"})
+		w.Header().Set(HeaderContentType, MIMETextPlain)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+		w.(http.Flusher).Flush()
+	}))
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Status())
+		assert.Equal(t, "created", rec.Body.String())
+		assert.Equal(t, int64(7), rec.Size())
+		assert.Equal(t, MIMETextPlain, rec.Header().Get(HeaderContentType))
+		assert.Equal(t, "user=jon", rec.Header().Get(HeaderSetCookie))
+	}
+}
+
+func TestWrapHTTPHandler(t *testing.T) {
+	testWrapHTTPHandler(t, true)
+	testWrapHTTPHandler(t, false)
+}
+
+func testWrapHTTPMiddleware(t *testing.T, native bool) {
+	e := New()
+	var req engine.Request = test.NewRequest(GET, "/", nil)
+	rec := test.NewResponseRecorder()
+	var res engine.Response = rec
+	if !native {
+		req = genericRequest{req}
+		res = genericResponse{res}
+	}
+	c := e.NewContext(req, res)
+	c.SetStdContext(kontext.WithValue(c.StdContext(), wrapContextKey{}, "vodka"))
+	buf := new(bytes.Buffer)
+	mw := WrapHTTPMiddleware(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "vodka", r.Context().Value(wrapContextKey{}))
+			w.Header().Set("X-Middleware", "mw")
+			r.Header.Set("X-Request", "mw")
+			h.ServeHTTP(&upperWriter{w}, r.WithContext(r.Context()))
+			buf.WriteString(w.Header().Get("X-Handler"))
+		})
+	})
+	h := mw(func(c Context) error {
+		assert.Equal(t, "mw", c.Request().Header().Get("X-Request"))
+		assert.Equal(t, "mw", c.Response().Header().Get("X-Middleware"))
+		c.Response().Header().Set("X-Handler", "handler")
+		return c.String(http.StatusOK, "vodka")
+	})
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, "handler", buf.String())
+		assert.Equal(t, "VODKA", rec.Body.String())
+		assert.Equal(t, int64(5), rec.Size())
+		assert.Equal(t, "mw", rec.Header().Get("X-Middleware"))
+	}
+}
+
+type upperWriter struct {
+	http.ResponseWriter
+}
+
+func (w *upperWriter) Write(b []byte) (int, error) {
+	return w.ResponseWriter.Write(bytes.ToUpper(b))
+}
+
+func TestWrapHTTPMiddleware(t *testing.T) {
+	testWrapHTTPMiddleware(t, true)
+	testWrapHTTPMiddleware(t, false)
+
+	// Middleware responding itself
+	e := New()
+	rec := test.NewResponseRecorder()
+	c := e.NewContext(genericRequest{test.NewRequest(GET, "/", nil)}, genericResponse{rec})
+	mw := WrapHTTPMiddleware(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "denied", http.StatusForbidden)
+		})
+	})
+	h := mw(func(c Context) error {
+		t.Error("next handler called")
+		return nil
+	})
+	if assert.NoError(t, h(c)) {
+		assert.Equal(t, http.StatusForbidden, rec.Status())
+		assert.Equal(t, "denied\n", rec.Body.String())
+		assert.Equal(t, "nosniff", rec.Header().Get(HeaderXContentTypeOptions))
+	}
+}